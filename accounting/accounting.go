@@ -0,0 +1,441 @@
+// Package accounting computes the cost basis and the realized and unrealized PnL of an account from its user trades
+// and ledger entries, in a quote currency (usually MXN), with FIFO, LIFO or average cost lots. Fees are part of the
+// cost basis: the fee of a buy raises the cost of what was received and the fee of a sell lowers the proceeds.
+package accounting
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+type Method string
+
+const (
+	Method_FIFO 	Method = "fifo"
+	Method_LIFO 	Method = "lifo"
+	Method_AVERAGE 	Method = "average"
+)
+
+// OPERATION_TRADE is the operation of the disposals made by user trades, the others use the ledger operation
+const OPERATION_TRADE = "trade"
+
+// Lot is an amount of a currency acquired at once. With average cost there is a single lot per currency.
+type Lot struct {
+	Currency 	bitso.CurrencyCode
+	Amount 		decimal.Decimal // units: Currency
+	Cost 		decimal.Decimal // units: quote, fees included
+	AcquiredAt 	time.Time
+	Reference 	string // tid of the trade or eid of the ledger entry
+}
+
+// Disposal is an amount of a currency sold, traded for another one or paid as a fee, with its realized gain
+type Disposal struct {
+	Time 		time.Time
+	Operation 	string // OPERATION_TRADE or a ledger operation
+	Reference 	string
+	Currency 	bitso.CurrencyCode
+	Amount 		decimal.Decimal // units: Currency
+	Proceeds 	decimal.Decimal // units: quote, net of fees
+	CostBasis 	decimal.Decimal // units: quote
+	Fees 		decimal.Decimal // units: quote, the fees of the trade, already out of the proceeds
+	Gain 		decimal.Decimal // units: quote, proceeds minus cost basis
+	AcquiredAt 	time.Time // of the first lot used, zero with average cost
+	Unmatched 	decimal.Decimal // units: Currency, disposed without lots (ex. missing history), at a zero cost basis
+}
+
+// Holding is the amount of a currency held and its cost basis
+type Holding struct {
+	Currency 	bitso.CurrencyCode
+	Amount 		decimal.Decimal // units: Currency
+	Cost 		decimal.Decimal // units: quote
+	AverageCost decimal.Decimal // units: quote per unit of Currency
+}
+
+// Pricer returns the price of a currency in the quote currency at a given time. It is needed to value trades of
+// books without the quote currency (ex. eth_btc when the quote is MXN) and the cost basis of fundings.
+type Pricer func(currency bitso.CurrencyCode, at time.Time) (decimal.Decimal, bool)
+
+// Account keeps the lots of every currency and the disposals of an account, in a quote currency
+type Account struct {
+	method 		Method
+	quote 		bitso.CurrencyCode
+
+	mu 			sync.Mutex
+	pricer 		Pricer
+	lots 		map[bitso.CurrencyCode][]Lot
+	disposals 	[]Disposal
+	fees 		map[bitso.CurrencyCode]decimal.Decimal
+	seenTrades 	map[int64]bool
+	seenEntries map[string]bool
+}
+
+func NewAccount(method Method, quote bitso.CurrencyCode) (*Account, error) {
+	if method != Method_FIFO && method != Method_LIFO && method != Method_AVERAGE {
+		return nil, fmt.Errorf("unknown cost basis method %q", method)
+	}
+
+	return &Account{
+		method: method,
+		quote: quote,
+		lots: make(map[bitso.CurrencyCode][]Lot),
+		disposals: make([]Disposal, 0),
+		fees: make(map[bitso.CurrencyCode]decimal.Decimal),
+		seenTrades: make(map[int64]bool),
+		seenEntries: make(map[string]bool),
+	}, nil
+}
+
+func (a *Account) SetPricer(pricer Pricer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.pricer = pricer
+}
+
+// Import adds user trades and ledger entries, in any order, merged by time. Trade entries of the ledger, and the fee
+// entries of trades, are skipped: the user trades carry their details and fees. Trades and entries already added
+// are ignored.
+func (a *Account) Import(trades []bitso.UserTrade, entries []bitso.LedgerEntry) error {
+	type event struct {
+		at 		time.Time
+		trade 	*bitso.UserTrade
+		entry 	*bitso.LedgerEntry
+	}
+
+	events := make([]event, 0, len(trades) + len(entries))
+	for i := range trades {
+		events = append(events, event{at: trades[i].CreatedAt, trade: &trades[i]})
+	}
+	for i := range entries {
+		events = append(events, event{at: entries[i].CreatedAt, entry: &entries[i]})
+	}
+
+	// oldest first, the trades of a same time by tid
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].at.Equal(events[j].at) {
+			return events[i].at.Before(events[j].at)
+		}
+		if events[i].trade != nil && events[j].trade != nil {
+			return events[i].trade.Tid < events[j].trade.Tid
+		}
+		return false
+	})
+
+	for _, e := range events {
+		var err error
+		if e.trade != nil {
+			err = a.AddTrade(*e.trade)
+		} else {
+			err = a.AddLedgerEntry(*e.entry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddTrade adds a user trade, trades must be added oldest first
+func (a *Account) AddTrade(t bitso.UserTrade) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.seenTrades[t.Tid] {
+		return nil
+	}
+
+	parts := strings.SplitN(string(t.Book), "_", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid book code %s in trade %d", t.Book, t.Tid)
+	}
+	major, minor := bitso.CurrencyCode(parts[0]), bitso.CurrencyCode(parts[1])
+
+	// the fee and the lots are shared in proportion to the amounts
+	if t.Major.IsZero() || t.Minor.IsZero() {
+		return fmt.Errorf("trade %d without an amount of %s or %s", t.Tid, major, minor)
+	}
+
+	// what was given and received, the fee is charged in the currency received
+	gave, gaveAmount := minor, t.Minor.Abs()
+	received, receivedAmount := major, t.Major.Abs()
+	if t.Major.IsNegative() {
+		gave, gaveAmount = major, t.Major.Abs()
+		received, receivedAmount = minor, t.Minor.Abs()
+	}
+
+	net := receivedAmount
+	switch t.FeesCurrency {
+	case received:
+		net = receivedAmount.Sub(t.FeesAmount)
+	case gave:
+		gaveAmount = gaveAmount.Add(t.FeesAmount)
+	}
+
+	// the value of the trade in the quote currency: the cost of what was received and the proceeds of what was given
+	var value decimal.Decimal
+	switch a.quote {
+	case gave:
+		value = gaveAmount
+	case received:
+		value = net
+	default:
+		price, ok := a.price(gave, t.CreatedAt)
+		if !ok {
+			return fmt.Errorf("no %s price in %s to value trade %d", gave, a.quote, t.Tid)
+		}
+		value = gaveAmount.Mul(price)
+	}
+
+	feeValue := decimal.Zero
+	if t.FeesAmount.IsPositive() {
+		switch t.FeesCurrency {
+		case a.quote:
+			feeValue = t.FeesAmount
+		case received:
+			feeValue = t.FeesAmount.Mul(value).Div(receivedAmount)
+		case gave:
+			feeValue = t.FeesAmount.Mul(value).Div(gaveAmount)
+		}
+		a.fees[t.FeesCurrency] = a.fees[t.FeesCurrency].Add(t.FeesAmount)
+	}
+
+	reference := strconv.FormatInt(t.Tid, 10)
+
+	if gave != a.quote {
+		a.dispose(gave, gaveAmount, value, feeValue, t.CreatedAt, OPERATION_TRADE, reference)
+	}
+	if received != a.quote {
+		a.acquire(Lot{Currency: received, Amount: net, Cost: value, AcquiredAt: t.CreatedAt, Reference: reference})
+	}
+
+	a.seenTrades[t.Tid] = true
+
+	return nil
+}
+
+// AddLedgerEntry adds a ledger entry, entries must be added oldest first. Fundings are acquired at the price of
+// the Pricer, or at a zero cost basis without one; withdrawals take their lots out without realizing a gain, and
+// fees (ex. of withdrawals) are disposed of for nothing. Trades are skipped, and so are the fees with a tid in their
+// details: AddTrade already takes them out of the trade, add the user trade for them.
+func (a *Account) AddLedgerEntry(e bitso.LedgerEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.seenEntries[e.Eid] {
+		return nil
+	}
+
+	if _, ok := e.Details["tid"]; ok && e.Operation == bitso.LedgerOperation_FEE {
+		a.seenEntries[e.Eid] = true
+		return nil
+	}
+
+	for _, update := range e.BalanceUpdates {
+		if update.Currency == a.quote || update.Amount.IsZero() {
+			continue
+		}
+
+		amount := update.Amount.Abs()
+
+		switch e.Operation {
+		case bitso.LedgerOperation_FUNDING:
+			if update.Amount.IsNegative() {
+				continue
+			}
+			cost := decimal.Zero
+			if price, ok := a.price(update.Currency, e.CreatedAt); ok {
+				cost = amount.Mul(price)
+			}
+			a.acquire(Lot{Currency: update.Currency, Amount: amount, Cost: cost, AcquiredAt: e.CreatedAt, Reference: e.Eid})
+
+		case bitso.LedgerOperation_WITHDRAWAL:
+			if update.Amount.IsPositive() {
+				continue
+			}
+			a.take(update.Currency, amount)
+
+		case bitso.LedgerOperation_FEE:
+			if update.Amount.IsPositive() {
+				continue
+			}
+			a.fees[update.Currency] = a.fees[update.Currency].Add(amount)
+			a.dispose(update.Currency, amount, decimal.Zero, decimal.Zero, e.CreatedAt, string(e.Operation), e.Eid)
+		}
+	}
+
+	a.seenEntries[e.Eid] = true
+
+	return nil
+}
+
+// price must be called with the lock held
+func (a *Account) price(currency bitso.CurrencyCode, at time.Time) (decimal.Decimal, bool) {
+	if a.pricer == nil {
+		return decimal.Zero, false
+	}
+	return a.pricer(currency, at)
+}
+
+// acquire must be called with the lock held
+func (a *Account) acquire(lot Lot) {
+	lots := a.lots[lot.Currency]
+
+	if a.method == Method_AVERAGE && len(lots) > 0 {
+		lots[0].Amount = lots[0].Amount.Add(lot.Amount)
+		lots[0].Cost = lots[0].Cost.Add(lot.Cost)
+		return
+	}
+
+	a.lots[lot.Currency] = append(lots, lot)
+}
+
+// take removes an amount from the lots of a currency, FIFO or LIFO, and returns its cost, the amount missing from
+// the lots and when the first lot used was acquired. Must be called with the lock held.
+func (a *Account) take(currency bitso.CurrencyCode, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal, time.Time) {
+	lots := a.lots[currency]
+	cost := decimal.Zero
+	var acquiredAt time.Time
+
+	for amount.IsPositive() && len(lots) > 0 {
+		i := 0
+		if a.method == Method_LIFO {
+			i = len(lots) - 1
+		}
+		lot := &lots[i]
+
+		if acquiredAt.IsZero() && a.method != Method_AVERAGE {
+			acquiredAt = lot.AcquiredAt
+		}
+
+		if amount.LessThan(lot.Amount) {
+			part := lot.Cost.Mul(amount).Div(lot.Amount)
+			cost = cost.Add(part)
+			lot.Cost = lot.Cost.Sub(part)
+			lot.Amount = lot.Amount.Sub(amount)
+			amount = decimal.Zero
+			break
+		}
+
+		cost = cost.Add(lot.Cost)
+		amount = amount.Sub(lot.Amount)
+		if a.method == Method_LIFO {
+			lots = lots[:i]
+		} else {
+			lots = lots[1:]
+		}
+	}
+
+	if len(lots) == 0 {
+		delete(a.lots, currency)
+	} else {
+		a.lots[currency] = lots
+	}
+
+	return cost, amount, acquiredAt
+}
+
+// dispose must be called with the lock held
+func (a *Account) dispose(currency bitso.CurrencyCode, amount, proceeds, fees decimal.Decimal, at time.Time, operation, reference string) {
+	cost, unmatched, acquiredAt := a.take(currency, amount)
+
+	a.disposals = append(a.disposals, Disposal{
+		Time: at,
+		Operation: operation,
+		Reference: reference,
+		Currency: currency,
+		Amount: amount,
+		Proceeds: proceeds,
+		CostBasis: cost,
+		Fees: fees,
+		Gain: proceeds.Sub(cost),
+		AcquiredAt: acquiredAt,
+		Unmatched: unmatched,
+	})
+}
+
+// Disposals returns every disposal, oldest first
+func (a *Account) Disposals() []Disposal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	disposals := make([]Disposal, len(a.disposals))
+	copy(disposals, a.disposals)
+	return disposals
+}
+
+// Lots returns the lots held of a currency, oldest first
+func (a *Account) Lots(currency bitso.CurrencyCode) []Lot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lots := make([]Lot, len(a.lots[currency]))
+	copy(lots, a.lots[currency])
+	return lots
+}
+
+// Holdings returns the amount held and the cost basis of every currency but the quote
+func (a *Account) Holdings() map[bitso.CurrencyCode]Holding {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	holdings := make(map[bitso.CurrencyCode]Holding, len(a.lots))
+	for currency, lots := range a.lots {
+		h := Holding{Currency: currency}
+		for _, lot := range lots {
+			h.Amount = h.Amount.Add(lot.Amount)
+			h.Cost = h.Cost.Add(lot.Cost)
+		}
+		if h.Amount.IsPositive() {
+			h.AverageCost = h.Cost.Div(h.Amount)
+		}
+		holdings[currency] = h
+	}
+
+	return holdings
+}
+
+// Fees returns the fees paid in each currency
+func (a *Account) Fees() map[bitso.CurrencyCode]decimal.Decimal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fees := make(map[bitso.CurrencyCode]decimal.Decimal, len(a.fees))
+	for currency, fee := range a.fees {
+		fees[currency] = fee
+	}
+	return fees
+}
+
+// Realized returns the realized gain of each currency disposed of, in the quote currency
+func (a *Account) Realized() map[bitso.CurrencyCode]decimal.Decimal {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	realized := make(map[bitso.CurrencyCode]decimal.Decimal)
+	for _, d := range a.disposals {
+		realized[d.Currency] = realized[d.Currency].Add(d.Gain)
+	}
+	return realized
+}
+
+// Unrealized returns the gain of each currency held if it were sold at the given prices, in the quote currency.
+// Currencies without a price are left out.
+func (a *Account) Unrealized(prices map[bitso.CurrencyCode]decimal.Decimal) map[bitso.CurrencyCode]decimal.Decimal {
+	unrealized := make(map[bitso.CurrencyCode]decimal.Decimal)
+	for currency, h := range a.Holdings() {
+		price, ok := prices[currency]
+		if !ok {
+			continue
+		}
+		unrealized[currency] = h.Amount.Mul(price).Sub(h.Cost)
+	}
+	return unrealized
+}
@@ -0,0 +1,193 @@
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+var start = time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+func TestImport(t *testing.T) {
+	// 1 BTC bought for 100000 MXN, 1 BTC for 200000 MXN and 1.5 BTC sold for 450000 MXN with a 2250 MXN fee, which
+	// the ledger repeats, then a withdrawal fee of 0.001 BTC
+	trades := []bitso.UserTrade{
+		{Book: "btc_mxn", Tid: 3, Major: decimal.RequireFromString("-1.5"), Minor: decimal.NewFromInt(450000), FeesAmount: decimal.NewFromInt(2250), FeesCurrency: "mxn", CreatedAt: start.Add(2 * time.Hour)},
+		{Book: "btc_mxn", Tid: 2, Major: decimal.NewFromInt(1), Minor: decimal.NewFromInt(-200000), CreatedAt: start.Add(time.Hour)},
+		{Book: "btc_mxn", Tid: 1, Major: decimal.NewFromInt(1), Minor: decimal.NewFromInt(-100000), CreatedAt: start},
+	}
+	entries := []bitso.LedgerEntry{
+		{Eid: "fee3", Operation: bitso.LedgerOperation_FEE, CreatedAt: start.Add(2 * time.Hour),
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "mxn", Amount: decimal.NewFromInt(-2250)}},
+			Details: map[string]interface{}{"tid": float64(3)}},
+		{Eid: "withdrawal-fee", Operation: bitso.LedgerOperation_FEE, CreatedAt: start.Add(3 * time.Hour),
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "btc", Amount: decimal.RequireFromString("-0.001")}},
+			Details: map[string]interface{}{"wid": "wid"}},
+	}
+
+	tests := []struct {
+		method 		Method
+		costBasis 	string
+		holding 	string // cost of the 0.499 BTC left
+	}{
+		{Method_FIFO, "200000", "99800"},
+		{Method_LIFO, "250000", "49900"},
+		{Method_AVERAGE, "225000", "74850"},
+	}
+
+	for _, tt := range tests {
+		account, err := NewAccount(tt.method, bitso.CurrencyCode_MXN)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// imported twice, ex. overlapping pages
+		for i := 0; i < 2; i++ {
+			if err := account.Import(trades, entries); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		disposals := account.Disposals()
+		if len(disposals) != 2 || disposals[0].Reference != "3" || disposals[1].Reference != "withdrawal-fee" {
+			t.Fatalf("%s: disposals %v, expecting the sale and the withdrawal fee", tt.method, disposals)
+		}
+		if sale := disposals[0]; !sale.Proceeds.Equal(decimal.NewFromInt(447750)) || !sale.CostBasis.Equal(decimal.RequireFromString(tt.costBasis)) {
+			t.Errorf("%s: sale for %s at a cost of %s, expecting 447750 at %s", tt.method, sale.Proceeds, sale.CostBasis, tt.costBasis)
+		}
+
+		if fees := account.Fees(); fees[bitso.CurrencyCode_BTC].String() != "0.001" || fees[bitso.CurrencyCode_MXN].String() != "2250" {
+			t.Errorf("%s: fees %v, expecting 0.001 BTC and 2250 MXN", tt.method, fees)
+		}
+		if h := account.Holdings()[bitso.CurrencyCode_BTC]; h.Amount.String() != "0.499" || !h.Cost.Equal(decimal.RequireFromString(tt.holding)) {
+			t.Errorf("%s: holding %s BTC at %s, expecting 0.499 at %s", tt.method, h.Amount, h.Cost, tt.holding)
+		}
+	}
+}
+
+func TestAddTradeWithoutAmount(t *testing.T) {
+	account, _ := NewAccount(Method_FIFO, bitso.CurrencyCode_MXN)
+
+	for _, trade := range []bitso.UserTrade{
+		{Book: "btc_mxn", Tid: 1, Minor: decimal.NewFromInt(-100), CreatedAt: start},
+		{Book: "btc_mxn", Tid: 2, Major: decimal.NewFromInt(-1), CreatedAt: start},
+	} {
+		if err := account.AddTrade(trade); err == nil {
+			t.Errorf("trade %d added, expecting an error", trade.Tid)
+		}
+	}
+	if disposals := account.Disposals(); len(disposals) != 0 {
+		t.Errorf("%d disposals, expecting none", len(disposals))
+	}
+}
+
+func TestFundingsAndWithdrawals(t *testing.T) {
+	// 1 BTC funded at 300000, 1 BTC bought for 200000, 1 BTC sold for 250000 and 0.5 BTC withdrawn
+	trades := []bitso.UserTrade{
+		{Book: "btc_mxn", Tid: 1, Major: decimal.NewFromInt(1), Minor: decimal.NewFromInt(-200000), CreatedAt: start.Add(time.Hour)},
+		{Book: "btc_mxn", Tid: 2, Major: decimal.NewFromInt(-1), Minor: decimal.NewFromInt(250000), CreatedAt: start.Add(2 * time.Hour)},
+	}
+	entries := []bitso.LedgerEntry{
+		{Eid: "funding", Operation: bitso.LedgerOperation_FUNDING, CreatedAt: start,
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "btc", Amount: decimal.NewFromInt(1)}}},
+		{Eid: "withdrawal", Operation: bitso.LedgerOperation_WITHDRAWAL, CreatedAt: start.Add(3 * time.Hour),
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "btc", Amount: decimal.RequireFromString("-0.5")}}},
+	}
+
+	tests := []struct {
+		method 		Method
+		priced 		bool
+		costBasis 	int64
+		holding 	int64 // cost of the 0.5 BTC left
+	}{
+		{Method_FIFO, true, 300000, 100000},
+		{Method_LIFO, true, 200000, 150000},
+		{Method_AVERAGE, true, 250000, 125000},
+		// without prices the funding has no cost basis
+		{Method_FIFO, false, 0, 100000},
+	}
+
+	for _, tt := range tests {
+		account, _ := NewAccount(tt.method, bitso.CurrencyCode_MXN)
+		if tt.priced {
+			account.SetPricer(func(currency bitso.CurrencyCode, at time.Time) (decimal.Decimal, bool) {
+				return decimal.NewFromInt(300000), true
+			})
+		}
+
+		if err := account.Import(trades, entries); err != nil {
+			t.Fatal(err)
+		}
+
+		// the withdrawal is not a disposal
+		disposals := account.Disposals()
+		if len(disposals) != 1 || disposals[0].Reference != "2" {
+			t.Fatalf("%s: %d disposals, expecting the sale only", tt.method, len(disposals))
+		}
+		if sale := disposals[0]; !sale.CostBasis.Equal(decimal.NewFromInt(tt.costBasis)) {
+			t.Errorf("%s: cost basis %s, expecting %d", tt.method, sale.CostBasis, tt.costBasis)
+		}
+		if h := account.Holdings()[bitso.CurrencyCode_BTC]; h.Amount.String() != "0.5" || !h.Cost.Equal(decimal.NewFromInt(tt.holding)) {
+			t.Errorf("%s: holding %s BTC at %s, expecting 0.5 at %d", tt.method, h.Amount, h.Cost, tt.holding)
+		}
+	}
+}
+
+func TestCrossBookTrade(t *testing.T) {
+	// 10 ETH for 0.5 BTC, with a 0.05 ETH fee, once BTC is worth 500000
+	trades := []bitso.UserTrade{
+		{Book: "eth_btc", Tid: 1, Major: decimal.NewFromInt(10), Minor: decimal.RequireFromString("-0.5"), FeesAmount: decimal.RequireFromString("0.05"), FeesCurrency: "eth", CreatedAt: start.Add(time.Hour)},
+	}
+	entries := []bitso.LedgerEntry{
+		{Eid: "funding", Operation: bitso.LedgerOperation_FUNDING, CreatedAt: start,
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "btc", Amount: decimal.NewFromInt(1)}}},
+	}
+
+	account, _ := NewAccount(Method_FIFO, bitso.CurrencyCode_MXN)
+	if err := account.Import(trades, nil); err == nil {
+		t.Error("cross book trade valued without a pricer")
+	}
+
+	account, _ = NewAccount(Method_FIFO, bitso.CurrencyCode_MXN)
+	account.SetPricer(func(currency bitso.CurrencyCode, at time.Time) (decimal.Decimal, bool) {
+		if currency != bitso.CurrencyCode_BTC {
+			return decimal.Zero, false
+		}
+		if at.Before(start.Add(time.Hour)) {
+			return decimal.NewFromInt(400000), true
+		}
+		return decimal.NewFromInt(500000), true
+	})
+	if err := account.Import(trades, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// half of the BTC funded at 400000, given for 250000
+	disposals := account.Disposals()
+	if len(disposals) != 1 {
+		t.Fatalf("%d disposals, expecting the BTC given", len(disposals))
+	}
+	if btc := disposals[0]; btc.Currency != bitso.CurrencyCode_BTC || btc.Proceeds.String() != "250000" || btc.CostBasis.String() != "200000" || btc.Fees.String() != "1250" {
+		t.Errorf("disposed %s for %s at a cost of %s with %s of fees, expecting btc for 250000 at 200000 with 1250", btc.Currency, btc.Proceeds, btc.CostBasis, btc.Fees)
+	}
+	if eth := account.Holdings()[bitso.CurrencyCode_ETH]; eth.Amount.String() != "9.95" || eth.Cost.String() != "250000" {
+		t.Errorf("holding %s ETH at %s, expecting 9.95 at 250000", eth.Amount, eth.Cost)
+	}
+}
+
+func TestUnrealized(t *testing.T) {
+	account, _ := NewAccount(Method_FIFO, bitso.CurrencyCode_MXN)
+	if err := account.AddTrade(bitso.UserTrade{Book: "btc_mxn", Tid: 1, Major: decimal.NewFromInt(1), Minor: decimal.NewFromInt(-100000), CreatedAt: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	unrealized := account.Unrealized(map[bitso.CurrencyCode]decimal.Decimal{bitso.CurrencyCode_BTC: decimal.NewFromInt(300000), bitso.CurrencyCode_ETH: decimal.NewFromInt(50000)})
+	if len(unrealized) != 1 || unrealized[bitso.CurrencyCode_BTC].String() != "200000" {
+		t.Errorf("unrealized %v, expecting 200000 on btc only", unrealized)
+	}
+	if unrealized := account.Unrealized(nil); len(unrealized) != 0 {
+		t.Errorf("unrealized %v without prices, expecting none", unrealized)
+	}
+}
@@ -0,0 +1,65 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+
+	"github.com/angle/gobitso"
+)
+
+// CSV_TIME_LAYOUT is the format of the dates of the CSV export
+const CSV_TIME_LAYOUT = "2006-01-02 15:04:05"
+
+var csvHeader = []string{
+	"date", "operation", "reference", "currency", "amount", "acquired", "proceeds", "cost_basis", "fees", "gain",
+	"quote", "unmatched",
+}
+
+// WriteCSV writes the disposals of a year, or of every year when zero, one row each, with the dates in loc and the
+// amounts in the quote currency rounded to its precision. For Mexican tax reporting use the MXN quote and the
+// America/Mexico_City location: the gain of each row is the ganancia (or pérdida) of the enajenación.
+func (a *Account) WriteCSV(w io.Writer, year int, loc *time.Location) error {
+	precision := int32(bitso.DEFAULT_MINOR_PRECISION)
+	if c, ok := bitso.CurrencyList()[a.quote]; ok {
+		precision = int32(c.Precision)
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, d := range a.Disposals() {
+		at := d.Time.In(loc)
+		if year != 0 && at.Year() != year {
+			continue
+		}
+
+		acquired := ""
+		if !d.AcquiredAt.IsZero() {
+			acquired = d.AcquiredAt.In(loc).Format(CSV_TIME_LAYOUT)
+		}
+
+		row := []string{
+			at.Format(CSV_TIME_LAYOUT),
+			d.Operation,
+			d.Reference,
+			string(d.Currency),
+			d.Amount.String(),
+			acquired,
+			d.Proceeds.Round(precision).StringFixed(precision),
+			d.CostBasis.Round(precision).StringFixed(precision),
+			d.Fees.Round(precision).StringFixed(precision),
+			d.Gain.Round(precision).StringFixed(precision),
+			string(a.quote),
+			d.Unmatched.String(),
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,50 @@
+package accounting
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteCSV(t *testing.T) {
+	// 1 BTC bought for 200000 MXN, half of it sold for 150000 MXN with a 750 MXN fee, then a withdrawal fee
+	account, _ := NewAccount(Method_FIFO, bitso.CurrencyCode_MXN)
+	trades := []bitso.UserTrade{
+		{Book: "btc_mxn", Tid: 1, Major: decimal.NewFromInt(1), Minor: decimal.NewFromInt(-200000), CreatedAt: start},
+		{Book: "btc_mxn", Tid: 2, Major: decimal.RequireFromString("-0.5"), Minor: decimal.NewFromInt(150000), FeesAmount: decimal.NewFromInt(750), FeesCurrency: "mxn", CreatedAt: start.Add(2 * time.Hour)},
+	}
+	entries := []bitso.LedgerEntry{
+		{Eid: "withdrawal-fee", Operation: bitso.LedgerOperation_FEE, CreatedAt: start.Add(3 * time.Hour),
+			BalanceUpdates: []bitso.LedgerBalanceUpdate{{Currency: "btc", Amount: decimal.RequireFromString("-0.001")}}},
+	}
+	if err := account.Import(trades, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "date,operation,reference,currency,amount,acquired,proceeds,cost_basis,fees,gain,quote,unmatched\n"
+	mexicoCity := time.FixedZone("CST", -6 * 60 * 60)
+
+	tests := []struct {
+		name 		string
+		year 		int
+		expected 	string
+	}{
+		{"every year", 0, header +
+			"2024-01-02 06:00:00,trade,2,btc,0.5,2024-01-02 04:00:00,149250.00,100000.00,750.00,49250.00,mxn,0\n" +
+			"2024-01-02 07:00:00,fee,withdrawal-fee,btc,0.001,2024-01-02 04:00:00,0.00,200.00,0.00,-200.00,mxn,0\n"},
+		{"another year", 2023, header},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := account.WriteCSV(&buf, tt.year, mexicoCity); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.expected {
+			t.Errorf("%s: wrote\n%s\nexpecting\n%s", tt.name, buf.String(), tt.expected)
+		}
+	}
+}
@@ -8,14 +8,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const API_ENDPOINT = "https://api.bitso.com"
+
+// Page sizes of the paged endpoints (trades, user trades, ledger), when no limit is given and at most
+const (
+	DEFAULT_PAGE_LIMIT 	= 25
+	MAX_PAGE_LIMIT 		= 100
+)
 // Common API functions
 
 
@@ -23,10 +29,41 @@ const API_ENDPOINT = "https://api.bitso.com"
 // error code 0 means no error
 // error code >0 is a Bitso error
 func (client *Client) httpGet(private bool, endpoint string, items []string, query map[string]string) ([]byte, error) {
-	u, _ := url.Parse(API_ENDPOINT)
+	return client.httpWithoutBody("GET", private, endpoint, items, query, false)
+}
+
+// httpGetOptional is httpGet for the requests whose failures the caller expects and handles, they are only logged
+// at DEBUG level
+func (client *Client) httpGetOptional(private bool, endpoint string, items []string, query map[string]string) ([]byte, error) {
+	return client.httpWithoutBody("GET", private, endpoint, items, query, true)
+}
+
+// error code -1 means unknown error (not bitso)
+// error code 0 means no error
+// error code >0 is a Bitso error
+func (client *Client) httpDelete(private bool, endpoint string, items []string, query map[string]string) ([]byte, error) {
+	return client.httpWithoutBody("DELETE", private, endpoint, items, query, false)
+}
+
+// httpWithoutBody builds the request path from the endpoint, followed by the items as path segments (ex. order ids)
+// and the query string, which are all part of the signed message
+func (client *Client) httpWithoutBody(method string, private bool, endpoint string, items []string, query map[string]string, optional bool) ([]byte, error) {
+	u, _ := url.Parse(client.endpoint)
 	u.Path = endpoint
 
-	request, err := http.NewRequest("GET", u.String(), nil)
+	if len(items) > 0 {
+		u.Path = strings.TrimSuffix(endpoint, "/") + "/" + strings.Join(items, "/") + "/"
+	}
+
+	if len(query) > 0 {
+		q := url.Values{}
+		for k, v := range query {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	request, err := http.NewRequest(method, u.String(), nil)
 	if err != nil {
 		// error building the request from the given parameters
 	}
@@ -41,33 +78,13 @@ func (client *Client) httpGet(private bool, endpoint string, items []string, que
 			return []byte(""), NewHTTPError("client's private key/secret pair is not set")
 		}
 
-		authHeader := client.buildSignature("GET", endpoint, "")
+		authHeader := client.buildSignature(method, u.RequestURI(), "")
 
 		// Add custom headers
 		request.Header.Add("Authorization", authHeader)
 	}
 
-	response, err := client.httpClient.Do(request)
-	if err != nil {
-		return []byte(""), NewHTTPError(fmt.Sprintf("http request error: %v", err))
-	}
-	defer response.Body.Close()
-
-	/*
-	fmt.Println("response Status:", response.Status)
-	fmt.Println("response Headers:", response.Header)
-	body, _ := ioutil.ReadAll(response.Body)
-	fmt.Println("response Body:", string(body))
-	*/
-
-	// Attempt to parse payload
-	responsePayload, err := parseResponse(response)
-
-	if err != nil {
-		return []byte(""), err
-	}
-
-	return responsePayload, nil
+	return client.send(request, endpoint, optional)
 }
 
 
@@ -75,7 +92,7 @@ func (client *Client) httpGet(private bool, endpoint string, items []string, que
 // error code 0 means no error
 // error code >0 is a Bitso error
 func (client *Client) httpPost(private bool, endpoint string, payload map[string]string) ([]byte, error) {
-	u, _ := url.Parse(API_ENDPOINT)
+	u, _ := url.Parse(client.endpoint)
 	u.Path = endpoint
 
 	// Convert the Payload to a json string
@@ -106,8 +123,18 @@ func (client *Client) httpPost(private bool, endpoint string, payload map[string
 		request.Header.Add("Authorization", authHeader)
 	}
 
+	return client.send(request, endpoint, false)
+}
+
+// send executes the request and parses the response, logging and measuring the outcome and latency of the call.
+// The failures of optional requests are logged at DEBUG level.
+func (client *Client) send(request *http.Request, endpoint string, optional bool) ([]byte, error) {
+	start := time.Now()
+
 	response, err := client.httpClient.Do(request)
 	if err != nil {
+		client.logger.Log(LogLevel_ERROR, "http request error", Field("method", request.Method), Field("endpoint", endpoint), Field("latency", time.Since(start)), Field("error", err))
+		client.metrics.ObserveRequest(request.Method, endpoint, 0, "-1", time.Since(start))
 		return []byte(""), NewHTTPError(fmt.Sprintf("http request error: %v", err))
 	}
 	defer response.Body.Close()
@@ -120,19 +147,45 @@ func (client *Client) httpPost(private bool, endpoint string, payload map[string
 	*/
 
 	// Attempt to parse payload
-	responsePayload, err := parseResponse(response)
+	responsePayload, err := client.parseResponse(response)
+
+	latency := time.Since(start)
 
 	if err != nil {
+		apiErrLevel, invalidLevel := LogLevel_WARN, LogLevel_ERROR
+		if optional {
+			apiErrLevel, invalidLevel = LogLevel_DEBUG, LogLevel_DEBUG
+		}
+
+		if apiErr, ok := err.(ApiError); ok {
+			client.logger.Log(apiErrLevel, "api error", Field("method", request.Method), Field("endpoint", endpoint), Field("status", response.StatusCode), Field("latency", latency), Field("error_code", apiErr.Code), Field("error", apiErr.Message))
+			client.metrics.ObserveRequest(request.Method, endpoint, response.StatusCode, apiErr.Code, latency)
+		} else {
+			client.logger.Log(invalidLevel, "invalid response", Field("method", request.Method), Field("endpoint", endpoint), Field("status", response.StatusCode), Field("latency", latency), Field("error", err))
+			client.metrics.ObserveRequest(request.Method, endpoint, response.StatusCode, "-1", latency)
+		}
 		return []byte(""), err
 	}
 
+	client.metrics.ObserveRequest(request.Method, endpoint, response.StatusCode, "", latency)
+	client.logger.Log(LogLevel_DEBUG, "request ok", Field("method", request.Method), Field("endpoint", endpoint), Field("status", response.StatusCode), Field("latency", latency))
+
 	return responsePayload, nil
 }
 
 func (client *Client) buildSignature(method, endpoint, payload string) string {
 
-	// Generate a Nonce from the current nano time
-	nonce := strconv.FormatInt(time.Now().UnixNano() / int64(time.Millisecond), 10)
+	// Generate a Nonce from the current nano time, it must always increase so two requests signed within the
+	// same millisecond get consecutive values
+	client.nonceMu.Lock()
+	n := time.Now().UnixNano() / int64(time.Millisecond)
+	if n <= client.lastNonce {
+		n = client.lastNonce + 1
+	}
+	client.lastNonce = n
+	client.nonceMu.Unlock()
+
+	nonce := strconv.FormatInt(n, 10)
 
 	// fmt.Println("nonce", nonce)
 
@@ -166,7 +219,7 @@ func (client *Client) buildSignature(method, endpoint, payload string) string {
 
 // error -1 means unknown error, could not parse the response body
 // error 0 means no error
-func parseResponse(response *http.Response) (payload []byte, err error) {
+func (client *Client) parseResponse(response *http.Response) (payload []byte, err error) {
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		// cannot even read the response body, error with the reader interface
@@ -181,7 +234,7 @@ func parseResponse(response *http.Response) (payload []byte, err error) {
 	err = json.Unmarshal(body, &msg)
 	if err != nil {
 		// could not parse to json
-		log.Println(err)
+		client.logger.Log(LogLevel_DEBUG, "cannot parse JSON in response body", Field("status", response.StatusCode), Field("error", err))
 		return []byte(""), NewHTTPError("cannot parse JSON in response body")
 	}
 
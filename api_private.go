@@ -1,6 +1,12 @@
 package bitso
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
 
 func (client *Client) AccountBalance() (map[CurrencyCode]Balance, error) {
 	endpoint := "/v3/balance/"
@@ -28,27 +34,243 @@ func (client *Client) AccountBalance() (map[CurrencyCode]Balance, error) {
 }
 
 
+// https://bitso.com/api_info#fees
 func (client *Client) AccountFees() (map[BookCode]Fee, error) {
+	rawFees, err := client.accountFees()
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the output map
+	m := make(map[BookCode]Fee)
+
+	for _, f := range rawFees.Fees {
+		m[f.BookCode] = f
+	}
+
+	return m, nil
+}
+
+// WithdrawalFees returns the fee charged for withdrawing each currency, in the same currency
+// https://bitso.com/api_info#fees
+func (client *Client) WithdrawalFees() (map[CurrencyCode]decimal.Decimal, error) {
+	rawFees, err := client.accountFees()
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the output map
+	m := make(map[CurrencyCode]decimal.Decimal)
+
+	for c, f := range rawFees.WithdrawalFees {
+		m[c] = f
+	}
+
+	return m, nil
+}
+
+func (client *Client) accountFees() (PrivateAccountFeesPayload, error) {
 	endpoint := "/v3/fees/"
 
 	payload, err := client.httpGet(true, endpoint, nil, nil)
 	if err != nil {
-		return nil, err
+		return PrivateAccountFeesPayload{}, err
 	}
 
 	// Parse the response body
 	rawFees := PrivateAccountFeesPayload{}
 	err = json.Unmarshal(payload, &rawFees)
+	if err != nil {
+		return PrivateAccountFeesPayload{}, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return rawFees, nil
+}
+
+// https://bitso.com/api_info#place-an-order
+func (client *Client) PlaceOrder(order OrderRequest) (string, error) {
+	endpoint := "/v3/orders/"
+
+	request := map[string]string{
+		"book": string(order.Book),
+		"side": order.Side.apiString(),
+		"type": string(order.Type),
+	}
+
+	if !order.Major.IsZero() {
+		request["major"] = order.Major.String()
+	} else if !order.Minor.IsZero() {
+		request["minor"] = order.Minor.String()
+	}
+
+	if order.Type == OrderType_LIMIT {
+		request["price"] = order.Price.String()
+	}
+
+	if order.OriginId != "" {
+		request["origin_id"] = order.OriginId
+	}
+
+	payload, err := client.httpPost(true, endpoint, request)
+	if err != nil {
+		return "", err
+	}
+
+	// Parse the response body
+	placed := PrivatePlaceOrderPayload{}
+	err = json.Unmarshal(payload, &placed)
+	if err != nil {
+		return "", NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return placed.Oid, nil
+}
+
+
+// https://bitso.com/api_info#cancel-order
+func (client *Client) CancelOrder(oid string) error {
+	endpoint := "/v3/orders/"
+
+	_, err := client.httpDelete(true, endpoint, []string{oid}, nil)
+	return err
+}
+
+
+// https://bitso.com/api_info#open-orders
+// an empty book returns the open orders of every book
+func (client *Client) OpenOrders(book BookCode) ([]Order, error) {
+	endpoint := "/v3/open_orders/"
+
+	query := map[string]string{}
+	if book != "" {
+		query["book"] = string(book)
+	}
+
+	payload, err := client.httpGet(true, endpoint, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	orders := make([]Order, 0)
+	err = json.Unmarshal(payload, &orders)
 	if err != nil {
 		return nil, NewHTTPError("cannot parse response payload JSON")
 	}
 
-	// Initialize the output map
-	m := make(map[BookCode]Fee)
+	return orders, nil
+}
 
-	for _, f := range rawFees.Fees {
-		m[f.BookCode] = f
+
+// https://bitso.com/api_info#lookup-orders
+func (client *Client) LookupOrders(oids ...string) ([]Order, error) {
+	endpoint := "/v3/orders/"
+
+	if len(oids) == 0 {
+		return []Order{}, nil
 	}
 
-	return m, nil
-}
\ No newline at end of file
+	payload, err := client.httpGet(true, endpoint, []string{strings.Join(oids, "-")}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	orders := make([]Order, 0)
+	err = json.Unmarshal(payload, &orders)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return orders, nil
+}
+
+// https://bitso.com/api_info#lookup-orders
+// LookupOrdersByOrigin returns the orders placed with the given origin ids, in any state. Unknown ids are skipped.
+func (client *Client) LookupOrdersByOrigin(originIds ...string) ([]Order, error) {
+	endpoint := "/v3/orders/"
+
+	if len(originIds) == 0 {
+		return []Order{}, nil
+	}
+
+	query := map[string]string{
+		"origin_ids": strings.Join(originIds, ","),
+	}
+
+	payload, err := client.httpGet(true, endpoint, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	orders := make([]Order, 0)
+	err = json.Unmarshal(payload, &orders)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return orders, nil
+}
+
+
+// https://bitso.com/api_info#user-trades
+// UserTrades returns the fills of a book, or of every book when empty, newest first. A non zero marker returns the
+// trades older than that tid, to page through the history, and a zero limit uses the API default.
+func (client *Client) UserTrades(book BookCode, marker int64, limit int) ([]UserTrade, error) {
+	endpoint := "/v3/user_trades/"
+
+	query := map[string]string{}
+	if book != "" {
+		query["book"] = string(book)
+	}
+	if marker != 0 {
+		query["marker"] = strconv.FormatInt(marker, 10)
+	}
+	if limit != 0 {
+		query["limit"] = strconv.Itoa(limit)
+	}
+
+	payload, err := client.httpGet(true, endpoint, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	trades := make([]UserTrade, 0)
+	err = json.Unmarshal(payload, &trades)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return trades, nil
+}
+
+// https://bitso.com/api_info#ledger
+// Ledger returns the entries of every operation on the account, newest first. A non empty marker returns the
+// entries older than that eid, to page through the history, and a zero limit uses the API default.
+func (client *Client) Ledger(marker string, limit int) ([]LedgerEntry, error) {
+	endpoint := "/v3/ledger/"
+
+	query := map[string]string{}
+	if marker != "" {
+		query["marker"] = marker
+	}
+	if limit != 0 {
+		query["limit"] = strconv.Itoa(limit)
+	}
+
+	payload, err := client.httpGet(true, endpoint, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	entries := make([]LedgerEntry, 0)
+	err = json.Unmarshal(payload, &entries)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return entries, nil
+}
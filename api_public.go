@@ -3,11 +3,20 @@ package bitso
 import (
 	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // https://bitso.com/api_info#available-books
+// Currencies missing from CurrencyList are accepted, with their precision inferred from the book limits.
 func (client *Client) AvailableBooks() (map[BookCode]Book, error) {
+	return client.availableBooks(CurrencyList())
+}
+
+// availableBooks resolves the currencies of the books from the given list, unknown currencies are inferred and
+// added to it
+func (client *Client) availableBooks(currencyList map[CurrencyCode]Currency) (map[BookCode]Book, error) {
 	endpoint := "/v3/available_books/"
 
 	payload, err := client.httpGet(false, endpoint, nil, nil)
@@ -15,57 +24,65 @@ func (client *Client) AvailableBooks() (map[BookCode]Book, error) {
 		return nil, err
 	}
 
-	//fmt.Println(payload)
-
 	// Parse the response body
 	rawBooks := make([]PublicAvailableBooksPayload, 0)
 	err = json.Unmarshal(payload, &rawBooks)
+	if err != nil {
+		return nil, err
+	}
 
-	//log.Printf("Got %d books!", len(rawBooks))
-	//log.Println(rawBooks)
-
-	// Pull the "constant" currency list map
-	currencyList := CurrencyList()
+	// Currencies inferred from this response, the precision of a currency is the largest inferred from any book
+	inferred := make(map[CurrencyCode]Currency)
 
-	books := make(map[BookCode]Book)
+	type parsedBook struct {
+		raw 	PublicAvailableBooksPayload
+		major 	CurrencyCode
+		minor 	CurrencyCode
+	}
+	parsed := make([]parsedBook, 0, len(rawBooks))
 
 	for _, rawBook := range rawBooks {
 		// Check the book code, determine the currencies from it
 		parts := strings.Split(rawBook.Book, "_")
 
-		if len(parts) != 2 {
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
 			// The book code pulled from the API is not in a valid format "major_minor"
 			return nil, errors.New("invalid book code string, expecting 'maj_min', got: " + rawBook.Book)
 		}
 
-		majorStr := parts[0]
-		minorStr := parts[1]
+		major := CurrencyCode(parts[0])
+		minor := CurrencyCode(parts[1])
 
-		// Check that both currencies are registered in this library
-		if _, exists := currencyList[CurrencyCode(majorStr)]; !exists {
-			// major currency code is not registered
-			return nil, errors.New("invalid major currency code '" + majorStr + "'")
+		// Currencies not registered in this library are inferred from the book limits
+		if _, exists := currencyList[major]; !exists {
+			inferred[major] = mergeInferred(inferred[major], inferMajorCurrency(major, rawBook))
 		}
-		if _, exists := currencyList[CurrencyCode(minorStr)]; !exists {
-			// minor currency code is not registered
-			return nil, errors.New("invalid minor currency code '" + minorStr + "'")
+		if _, exists := currencyList[minor]; !exists {
+			inferred[minor] = mergeInferred(inferred[minor], inferMinorCurrency(minor, rawBook))
 		}
 
-		major := currencyList[CurrencyCode(majorStr)]
-		minor := currencyList[CurrencyCode(minorStr)]
+		parsed = append(parsed, parsedBook{raw: rawBook, major: major, minor: minor})
+	}
+
+	for code, c := range inferred {
+		currencyList[code] = c
+	}
+
+	books := make(map[BookCode]Book)
 
+	for _, p := range parsed {
 		// Create a book from the rawBook
 		book := Book {
-			BookCode: BookCode(rawBook.Book),
-			Major: major,
-			Minor: minor,
-
-			MinimumAmount: 	rawBook.MinimumAmount,
-			MaximumAmount: 	rawBook.MaximumAmount,
-			MinimumPrice: 	rawBook.MinimumPrice,
-			MaximumPrice: 	rawBook.MaximumPrice,
-			MinimumValue: 	rawBook.MinimumValue,
-			MaximumValue: 	rawBook.MaximumValue,
+			BookCode: BookCode(p.raw.Book),
+			Major: currencyList[p.major],
+			Minor: currencyList[p.minor],
+
+			MinimumAmount: 	p.raw.MinimumAmount,
+			MaximumAmount: 	p.raw.MaximumAmount,
+			MinimumPrice: 	p.raw.MinimumPrice,
+			MaximumPrice: 	p.raw.MaximumPrice,
+			MinimumValue: 	p.raw.MinimumValue,
+			MaximumValue: 	p.raw.MaximumValue,
 		}
 
 		// Add it to our Book map
@@ -74,3 +91,170 @@ func (client *Client) AvailableBooks() (map[BookCode]Book, error) {
 
 	return books, nil
 }
+
+// Catalogue lists the currencies known by Bitso with their precision. Not every deployment of the API serves it,
+// see Catalog which falls back to inferring the currencies from the books.
+func (client *Client) Catalogue() (map[CurrencyCode]Currency, error) {
+	return client.catalogue(false)
+}
+
+// catalogue requests the catalogue, optional when the caller falls back to something else without it
+func (client *Client) catalogue(optional bool) (map[CurrencyCode]Currency, error) {
+	endpoint := "/v3/catalogues/"
+
+	get := client.httpGet
+	if optional {
+		get = client.httpGetOptional
+	}
+
+	payload, err := get(false, endpoint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	rawCurrencies := make([]PublicCatalogueCurrencyPayload, 0)
+	err = json.Unmarshal(payload, &rawCurrencies)
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make(map[CurrencyCode]Currency)
+	for _, c := range rawCurrencies {
+		if c.Currency == "" {
+			continue
+		}
+
+		currencies[c.Currency] = Currency{
+			Code: c.Currency,
+			Name: c.Name,
+			Precision: c.Precision,
+		}
+	}
+
+	return currencies, nil
+}
+
+// https://bitso.com/api_info#ticker
+func (client *Client) Ticker(book BookCode) (Ticker, error) {
+	endpoint := "/v3/ticker/"
+
+	query := map[string]string{
+		"book": string(book),
+	}
+
+	payload, err := client.httpGet(false, endpoint, nil, query)
+	if err != nil {
+		return Ticker{}, err
+	}
+
+	// Parse the response body
+	ticker := Ticker{}
+	err = json.Unmarshal(payload, &ticker)
+	if err != nil {
+		return Ticker{}, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return ticker, nil
+}
+
+// https://bitso.com/api_info#ticker
+// Tickers returns the ticker of every book in a single request
+func (client *Client) Tickers() ([]Ticker, error) {
+	endpoint := "/v3/ticker/"
+
+	payload, err := client.httpGet(false, endpoint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	tickers := make([]Ticker, 0)
+	err = json.Unmarshal(payload, &tickers)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return tickers, nil
+}
+
+// https://bitso.com/api_info#order-book
+// OrderBook returns the bids and asks of a book, best first, and the sequence of the snapshot. Aggregated books have
+// one offer per price.
+func (client *Client) OrderBook(book BookCode, aggregate bool) (Orders, int64, error) {
+	rawBook, err := client.OrderBookOffers(book, aggregate)
+	if err != nil {
+		return Orders{}, 0, err
+	}
+
+	orders := Orders{
+		Bids: make([]Offer, 0, len(rawBook.Bids)),
+		Asks: make([]Offer, 0, len(rawBook.Asks)),
+	}
+	millis := rawBook.UpdatedAt.UnixNano() / int64(time.Millisecond)
+	for _, o := range rawBook.Bids {
+		orders.Bids = append(orders.Bids, Offer{Rate: o.Price, Amount: o.Amount, Value: o.Price.Mul(o.Amount), Side: Side_BUY, UnixMillis: millis})
+	}
+	for _, o := range rawBook.Asks {
+		orders.Asks = append(orders.Asks, Offer{Rate: o.Price, Amount: o.Amount, Value: o.Price.Mul(o.Amount), Side: Side_SELL, UnixMillis: millis})
+	}
+
+	return orders, rawBook.Sequence, nil
+}
+
+// https://bitso.com/api_info#order-book
+// OrderBookOffers returns the order book as sent by Bitso. Books that are not aggregated keep the id of every order,
+// to seed an OrderBook kept up to date from the Diff-Orders channel.
+func (client *Client) OrderBookOffers(book BookCode, aggregate bool) (PublicOrderBookPayload, error) {
+	endpoint := "/v3/order_book/"
+
+	query := map[string]string{
+		"book": string(book),
+		"aggregate": strconv.FormatBool(aggregate),
+	}
+
+	payload, err := client.httpGet(false, endpoint, nil, query)
+	if err != nil {
+		return PublicOrderBookPayload{}, err
+	}
+
+	// Parse the response body
+	rawBook := PublicOrderBookPayload{}
+	err = json.Unmarshal(payload, &rawBook)
+	if err != nil {
+		return PublicOrderBookPayload{}, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return rawBook, nil
+}
+
+// https://bitso.com/api_info#trades
+// Trades returns the latest trades of a book, newest first. A non zero marker returns the trades older than that
+// tid, to page through the history, and a zero limit uses the API default.
+func (client *Client) Trades(book BookCode, marker int64, limit int) ([]PublicTrade, error) {
+	endpoint := "/v3/trades/"
+
+	query := map[string]string{
+		"book": string(book),
+	}
+	if marker != 0 {
+		query["marker"] = strconv.FormatInt(marker, 10)
+	}
+	if limit != 0 {
+		query["limit"] = strconv.Itoa(limit)
+	}
+
+	payload, err := client.httpGet(false, endpoint, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response body
+	trades := make([]PublicTrade, 0)
+	err = json.Unmarshal(payload, &trades)
+	if err != nil {
+		return nil, NewHTTPError("cannot parse response payload JSON")
+	}
+
+	return trades, nil
+}
@@ -0,0 +1,347 @@
+package bitso
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ArbitrageOpportunity is a profitable cycle of three conversions starting and ending in the same currency, ex.
+// MXN to BTC to ETH and back to MXN, at the top of the books and after fees
+type ArbitrageOpportunity struct {
+	Currency 	CurrencyCode // the currency the cycle starts and ends in
+	Legs 		[]RouteLeg
+	Edge 		decimal.Decimal // units of Currency gained per unit invested, after fees
+	EdgeBps 	decimal.Decimal
+	MinSize 	decimal.Decimal // units: Currency, the smallest size meeting the book minimums of every leg
+	MaxSize 	decimal.Decimal // units: Currency, the largest size available at the top of every book
+	Profit 		decimal.Decimal // units: Currency, expected at MaxSize
+	DetectedAt 	time.Time
+}
+
+// ArbitrageDetector watches the top of the books and detects triangular arbitrage opportunities
+type ArbitrageDetector struct {
+	books 		map[BookCode]Book
+	fees 		map[BookCode]Fee
+	bases 		map[CurrencyCode]bool
+	triangles 	[]triangle
+	byBook 		map[BookCode][]triangle // the triangles trading each book
+
+	mu 			sync.RWMutex
+	tops 		map[BookCode]topOfBook
+	role 		FeeRole
+	minEdgeBps 	decimal.Decimal
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(opportunity ArbitrageOpportunity)
+}
+
+// NewArbitrageDetector returns a detector over the given books. Cycles start and end in one of the base currencies;
+// without bases every cycle is reported once, starting from its first currency in alphabetical order.
+func NewArbitrageDetector(books map[BookCode]Book, fees map[BookCode]Fee, bases ...CurrencyCode) *ArbitrageDetector {
+	d := &ArbitrageDetector{
+		books: books,
+		fees: fees,
+		bases: make(map[CurrencyCode]bool),
+		tops: make(map[BookCode]topOfBook),
+		role: FeeRole_TAKER,
+	}
+
+	for _, c := range bases {
+		d.bases[c] = true
+	}
+	d.index()
+
+	return d
+}
+
+// triangle is a cycle of three conversions, its legs only have the book, side and currencies until they are priced
+type triangle struct {
+	start 	CurrencyCode
+	legs 	[]RouteLeg
+}
+
+// index finds every triangle once, the books never change
+func (d *ArbitrageDetector) index() {
+	d.triangles = make([]triangle, 0)
+	d.byBook = make(map[BookCode][]triangle)
+	seen := make(map[string]bool)
+
+	for _, start := range d.currencies() {
+		for _, first := range d.conversions(start) {
+			for _, second := range d.conversions(first.To) {
+				if second.To == start || second.Book == first.Book {
+					continue
+				}
+
+				for _, third := range d.conversions(second.To) {
+					if third.To != start || third.Book == second.Book {
+						continue
+					}
+
+					t := triangle{start: start, legs: []RouteLeg{first, second, third}}
+
+					key := cycleKey(t.legs, len(d.bases) > 0)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+
+					d.triangles = append(d.triangles, t)
+					for _, leg := range t.legs {
+						d.byBook[leg.Book] = append(d.byBook[leg.Book], t)
+					}
+				}
+			}
+		}
+	}
+}
+
+// conversions returns the unpriced legs converting from into another currency, one per book trading it
+func (d *ArbitrageDetector) conversions(from CurrencyCode) []RouteLeg {
+	legs := make([]RouteLeg, 0)
+
+	for code, book := range d.books {
+		switch from {
+		case book.Major.Code:
+			legs = append(legs, RouteLeg{Book: code, Side: Side_SELL, From: from, To: book.Minor.Code})
+		case book.Minor.Code:
+			legs = append(legs, RouteLeg{Book: code, Side: Side_BUY, From: from, To: book.Major.Code})
+		}
+	}
+
+	return legs
+}
+
+// SetFeeRole sets the fee charged on every leg, taker by default
+func (d *ArbitrageDetector) SetFeeRole(role FeeRole) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.role = role
+}
+
+// SetMinEdge ignores opportunities with an edge below the given basis points, zero by default
+func (d *ArbitrageDetector) SetMinEdge(bps decimal.Decimal) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.minEdgeBps = bps
+}
+
+// OnOpportunity registers a handler called with every opportunity found after an update of the books
+func (d *ArbitrageDetector) OnOpportunity(handler func(opportunity ArbitrageOpportunity)) {
+	d.handlersMu.Lock()
+	defer d.handlersMu.Unlock()
+
+	d.handlers = append(d.handlers, handler)
+}
+
+// Attach keeps the top of the books up to date from the Orders channel of a websocket, the caller still has to
+// subscribe to it for every book
+func (d *ArbitrageDetector) Attach(ws *Websocket) {
+	ws.OnOrders(d.UpdateOrders)
+}
+
+// UpdateOrders takes the top of a book from an Orders snapshot and reports the opportunities involving that book
+func (d *ArbitrageDetector) UpdateOrders(book BookCode, orders Orders) {
+	d.mu.Lock()
+	d.tops[book] = newTopOfBook(orders)
+	d.mu.Unlock()
+
+	opportunities := d.scan(d.byBook[book])
+	if len(opportunities) == 0 {
+		return
+	}
+
+	d.handlersMu.RLock()
+	handlers := make([]func(opportunity ArbitrageOpportunity), len(d.handlers))
+	copy(handlers, d.handlers)
+	d.handlersMu.RUnlock()
+
+	for _, o := range opportunities {
+		for _, h := range handlers {
+			h(o)
+		}
+	}
+}
+
+// Scan returns every current opportunity, the best edge first
+func (d *ArbitrageDetector) Scan() []ArbitrageOpportunity {
+	return d.scan(d.triangles)
+}
+
+// scan prices the given triangles at the top of the books and returns the profitable ones, the best edge first
+func (d *ArbitrageDetector) scan(triangles []triangle) []ArbitrageOpportunity {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	now := time.Now()
+	one := decimal.NewFromInt(1)
+	opportunities := make([]ArbitrageOpportunity, 0)
+
+	for _, t := range triangles {
+		legs, ok := d.price(t)
+		if !ok {
+			continue
+		}
+
+		edge := legs[0].Factor.Mul(legs[1].Factor).Mul(legs[2].Factor).Sub(one)
+		edgeBps := edge.Mul(bpsPerUnit).Round(2)
+		if !edge.IsPositive() || edgeBps.LessThan(d.minEdgeBps) {
+			continue
+		}
+
+		minSize, maxSize := d.sizes(legs)
+		if maxSize.LessThan(minSize) || !maxSize.IsPositive() {
+			continue
+		}
+
+		opportunities = append(opportunities, ArbitrageOpportunity{
+			Currency: t.start,
+			Legs: legs,
+			Edge: edge,
+			EdgeBps: edgeBps,
+			MinSize: minSize,
+			MaxSize: maxSize,
+			Profit: maxSize.Mul(edge).Truncate(int32(d.startCurrency(legs).Precision)),
+			DetectedAt: now,
+		})
+	}
+
+	sort.Slice(opportunities, func(i, j int) bool { return opportunities[i].Edge.GreaterThan(opportunities[j].Edge) })
+
+	return opportunities
+}
+
+// currencies returns the start currencies, sorted so each cycle is first found from the same currency. Must be
+// called with the lock held.
+func (d *ArbitrageDetector) currencies() []CurrencyCode {
+	set := make(map[CurrencyCode]bool)
+	for _, book := range d.books {
+		for _, c := range []CurrencyCode{book.Major.Code, book.Minor.Code} {
+			if len(d.bases) == 0 || d.bases[c] {
+				set[c] = true
+			}
+		}
+	}
+
+	currencies := make([]CurrencyCode, 0, len(set))
+	for c := range set {
+		currencies = append(currencies, c)
+	}
+	sort.Slice(currencies, func(i, j int) bool { return currencies[i] < currencies[j] })
+
+	return currencies
+}
+
+// cycleKey identifies a cycle regardless of the currency it starts from, unless perStart is set: rotations
+// starting from different base currencies are different opportunities, since their profit is in another currency
+func cycleKey(legs []RouteLeg, perStart bool) string {
+	parts := make([]string, len(legs))
+	for i, leg := range legs {
+		parts[i] = string(leg.Book) + ":" + leg.Side.String()
+	}
+	sort.Strings(parts)
+
+	key := strings.Join(parts, ",")
+	if perStart {
+		key = string(legs[0].From) + "|" + key
+	}
+	return key
+}
+
+// price returns the legs of a triangle at the top of their books, false when one of them is empty. Must be called
+// with the lock held.
+func (d *ArbitrageDetector) price(t triangle) ([]RouteLeg, bool) {
+	legs := make([]RouteLeg, 0, len(t.legs))
+
+	for _, l := range t.legs {
+		fee := d.fees[l.Book]
+		feeRate := fee.TakerFeeDecimal
+		if d.role == FeeRole_MAKER {
+			feeRate = fee.MakerFeeDecimal
+		}
+
+		leg, ok := conversionLeg(d.books[l.Book], feeRate, d.tops[l.Book], l.From)
+		if !ok {
+			return nil, false
+		}
+		legs = append(legs, leg)
+	}
+
+	return legs, true
+}
+
+// sizes returns the range of starting amounts, in the start currency, that every leg can fill at the top of its
+// book within the book limits. Must be called with the lock held.
+func (d *ArbitrageDetector) sizes(legs []RouteLeg) (decimal.Decimal, decimal.Decimal) {
+	minSize := decimal.Zero
+	maxSize := decimal.Zero
+	bounded := false
+
+	// units of the leg's From currency per unit of the start currency
+	prefix := decimal.NewFromInt(1)
+
+	lower := func(bound decimal.Decimal) {
+		if bound.GreaterThan(minSize) {
+			minSize = bound
+		}
+	}
+	upper := func(bound decimal.Decimal) {
+		if !bounded || bound.LessThan(maxSize) {
+			maxSize = bound
+			bounded = true
+		}
+	}
+
+	for _, leg := range legs {
+		book := d.books[leg.Book]
+		top := d.tops[leg.Book]
+
+		// the traded amount (major) and value (minor) per unit of the start currency
+		var major, minor decimal.Decimal
+		var available decimal.Decimal
+		if leg.Side == Side_SELL {
+			major = prefix
+			minor = prefix.Mul(leg.Rate)
+			available = top.bid.Amount
+		} else {
+			minor = prefix
+			major = prefix.Div(leg.Rate)
+			available = top.ask.Amount
+		}
+
+		lower(book.MinimumAmount.Div(major))
+		lower(book.MinimumValue.Div(minor))
+		upper(available.Div(major))
+		if book.MaximumAmount.IsPositive() {
+			upper(book.MaximumAmount.Div(major))
+		}
+		if book.MaximumValue.IsPositive() {
+			upper(book.MaximumValue.Div(minor))
+		}
+
+		prefix = prefix.Mul(leg.Factor)
+	}
+
+	// round the minimum up and the maximum down
+	precision := int32(d.startCurrency(legs).Precision)
+	rounded := minSize.Truncate(precision)
+	if rounded.LessThan(minSize) {
+		rounded = rounded.Add(decimal.New(1, -precision))
+	}
+
+	return rounded, maxSize.Truncate(precision)
+}
+
+func (d *ArbitrageDetector) startCurrency(legs []RouteLeg) Currency {
+	book := d.books[legs[0].Book]
+	if legs[0].Side == Side_SELL {
+		return book.Major
+	}
+	return book.Minor
+}
@@ -0,0 +1,123 @@
+package bitso_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/angle/gobitso"
+)
+
+func TestArbitrageDetector(t *testing.T) {
+	currencies := bitso.CurrencyList()
+	books := map[bitso.BookCode]bitso.Book{
+		bitso.BookCode_BTC_MXN: btcMxn,
+		bitso.BookCode_ETH_MXN: {BookCode: bitso.BookCode_ETH_MXN, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_MXN]},
+		bitso.BookCode_ETH_BTC: {BookCode: bitso.BookCode_ETH_BTC, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_BTC]},
+		bitso.BookCode_XRP_MXN: {BookCode: bitso.BookCode_XRP_MXN, Major: currencies[bitso.CurrencyCode_XRP], Minor: currencies[bitso.CurrencyCode_MXN]},
+	}
+	// only makers trade for free
+	fees := make(map[bitso.BookCode]bitso.Fee)
+	for code := range books {
+		fees[code] = bitso.Fee{BookCode: code, TakerFeeDecimal: d("0.01")}
+	}
+
+	tests := []struct {
+		name 		string
+		bases 		[]bitso.CurrencyCode
+		role 		bitso.FeeRole
+		minEdge 	string
+		legs 		[]string // book and side of the single opportunity, empty when there is none
+		currency 	bitso.CurrencyCode
+	}{
+		// buy btc at 900000 mxn, eth at 0.05 btc and sell it at 46000 mxn: 46000 / 45000
+		{"from a base", []bitso.CurrencyCode{bitso.CurrencyCode_MXN}, bitso.FeeRole_MAKER, "0", []string{"btc_mxn BUY", "eth_btc BUY", "eth_mxn SELL"}, bitso.CurrencyCode_MXN},
+		{"without bases", nil, bitso.FeeRole_MAKER, "0", []string{"eth_btc BUY", "eth_mxn SELL", "btc_mxn BUY"}, bitso.CurrencyCode_BTC},
+		{"below the minimum edge", []bitso.CurrencyCode{bitso.CurrencyCode_MXN}, bitso.FeeRole_MAKER, "300", nil, ""},
+		{"eaten by the taker fees", []bitso.CurrencyCode{bitso.CurrencyCode_MXN}, bitso.FeeRole_TAKER, "0", nil, ""},
+	}
+
+	for _, tt := range tests {
+		detector := bitso.NewArbitrageDetector(books, fees, tt.bases...)
+		detector.SetFeeRole(tt.role)
+		detector.SetMinEdge(d(tt.minEdge))
+
+		reported := make([]bitso.ArbitrageOpportunity, 0)
+		detector.OnOpportunity(func(o bitso.ArbitrageOpportunity) {
+			reported = append(reported, o)
+		})
+
+		detector.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: d("899000"), Amount: d("1")}},
+			Asks: []bitso.Offer{{Rate: d("900000"), Amount: d("1")}},
+		})
+		detector.UpdateOrders(bitso.BookCode_ETH_BTC, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: d("0.0499"), Amount: d("10")}},
+			Asks: []bitso.Offer{{Rate: d("0.05"), Amount: d("10")}},
+		})
+		detector.UpdateOrders(bitso.BookCode_ETH_MXN, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: d("46000"), Amount: d("5")}},
+			Asks: []bitso.Offer{{Rate: d("46100"), Amount: d("5")}},
+		})
+		// no triangle trades xrp
+		detector.UpdateOrders(bitso.BookCode_XRP_MXN, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: d("10"), Amount: d("100")}},
+			Asks: []bitso.Offer{{Rate: d("11"), Amount: d("100")}},
+		})
+
+		opportunities := detector.Scan()
+		if tt.legs == nil {
+			if len(opportunities) != 0 || len(reported) != 0 {
+				t.Errorf("%s: found %d and reported %d opportunities, expecting none", tt.name, len(opportunities), len(reported))
+			}
+			continue
+		}
+		if len(opportunities) != 1 {
+			t.Errorf("%s: found %d opportunities, expecting one", tt.name, len(opportunities))
+			continue
+		}
+		// only the update completing the triangle reports it
+		if len(reported) != 1 {
+			t.Errorf("%s: reported %d opportunities, expecting one", tt.name, len(reported))
+		}
+
+		o := opportunities[0]
+		legs := make([]string, 0, len(o.Legs))
+		for _, leg := range o.Legs {
+			legs = append(legs, fmt.Sprintf("%s %s", leg.Book, leg.Side))
+		}
+		if fmt.Sprint(legs) != fmt.Sprint(tt.legs) || o.Currency != tt.currency {
+			t.Errorf("%s: %v from %s, expecting %v from %s", tt.name, legs, o.Currency, tt.legs, tt.currency)
+		}
+		if !o.EdgeBps.Equal(d("222.22")) {
+			t.Errorf("%s: edge of %s bps, expecting 222.22", tt.name, o.EdgeBps)
+		}
+	}
+}
+
+func TestArbitrageSizes(t *testing.T) {
+	currencies := bitso.CurrencyList()
+	books := map[bitso.BookCode]bitso.Book{
+		bitso.BookCode_BTC_MXN: btcMxn,
+		bitso.BookCode_ETH_MXN: {BookCode: bitso.BookCode_ETH_MXN, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_MXN]},
+		bitso.BookCode_ETH_BTC: {BookCode: bitso.BookCode_ETH_BTC, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_BTC]},
+	}
+
+	detector := bitso.NewArbitrageDetector(books, nil, bitso.CurrencyCode_MXN)
+	detector.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{Asks: []bitso.Offer{{Rate: d("900000"), Amount: d("1")}}})
+	detector.UpdateOrders(bitso.BookCode_ETH_BTC, bitso.Orders{Asks: []bitso.Offer{{Rate: d("0.05"), Amount: d("10")}}})
+	detector.UpdateOrders(bitso.BookCode_ETH_MXN, bitso.Orders{Bids: []bitso.Offer{{Rate: d("46000"), Amount: d("5")}}})
+
+	opportunities := detector.Scan()
+	if len(opportunities) != 1 {
+		t.Fatalf("found %d opportunities, expecting one", len(opportunities))
+	}
+	o := opportunities[0]
+
+	// the 10 mxn minimum value of btc_mxn, and the 5 eth bid worth 225000 mxn at 45000 mxn per eth
+	if !o.MinSize.Equal(d("10")) || !o.MaxSize.Equal(d("225000")) {
+		t.Errorf("sizes from %s to %s, expecting 10 to 225000", o.MinSize, o.MaxSize)
+	}
+	if o.Profit.LessThan(d("4999.99")) || o.Profit.GreaterThan(d("5000")) {
+		t.Errorf("profit of %s, expecting 5000 mxn", o.Profit)
+	}
+}
@@ -0,0 +1,328 @@
+// Package backtest runs a strategy offline against recorded market data (see bitso.Recorder). Orders go through a
+// paper.Trader, so fills, fees and book limits behave as in paper trading, and the run ends with a Report of the
+// fills, PnL, drawdown and turnover.
+package backtest
+
+import (
+	"io"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/paper"
+	"github.com/shopspring/decimal"
+)
+
+// Event is a market data message and the time it was received
+type Event struct {
+	Time time.Time
+	bitso.FeedMessage
+}
+
+// Strategy is called after every event has been applied to the simulated market
+type Strategy func(ctx *Context, event Event)
+
+// Context gives the strategy access to the simulated account and market
+type Context struct {
+	engine *Engine
+}
+
+// Time returns the time of the event being processed
+func (ctx *Context) Time() time.Time {
+	return ctx.engine.now
+}
+
+// Trader returns the simulated account, the same interface a live strategy would use with bitso.Client
+func (ctx *Context) Trader() bitso.Trader {
+	return ctx.engine.trader
+}
+
+// OrderBook returns the current local order book of a book
+func (ctx *Context) OrderBook(book bitso.BookCode) bitso.Orders {
+	if ob, ok := ctx.engine.orderBooks[book]; ok {
+		return ob.Snapshot(0)
+	}
+	return bitso.Orders{}
+}
+
+// LastPrice returns the rate of the last trade of a book, zero before the first one
+func (ctx *Context) LastPrice(book bitso.BookCode) decimal.Decimal {
+	return ctx.engine.lastPrices[book]
+}
+
+// Engine feeds events to a paper.Trader and a Strategy and keeps the statistics of the run
+type Engine struct {
+	books 		map[bitso.BookCode]bitso.Book
+	quote 		bitso.CurrencyCode
+	strategy 	Strategy
+	trader 		*paper.Trader
+	ctx 		*Context
+
+	now 		time.Time
+	orderBooks 	map[bitso.BookCode]*bitso.OrderBook
+	lastPrices 	map[bitso.BookCode]decimal.Decimal
+	snapshots 	map[bitso.BookCode]bitso.Orders // last Orders snapshot of each book
+	depth 		map[bitso.BookCode]bool // books whose local book was built from Diff-Orders
+
+	report 		Report
+	peak 		decimal.Decimal
+	marked 		bool
+}
+
+// Report summarizes a run. Equity, PnL, drawdown and turnover are in the quote currency given to New, the equity is
+// tracked from the first event where every held currency has a price in it.
+type Report struct {
+	Start 				time.Time
+	End 				time.Time
+	Events 				int
+	SkippedFrames 		int // frames that could not be parsed
+	SequenceGaps 		int // Diff-Orders gaps, the book is seeded again from the last Orders snapshot
+
+	Fills 				[]bitso.UserTrade // oldest first
+	Fees 				map[bitso.CurrencyCode]decimal.Decimal
+	Balances 			map[bitso.CurrencyCode]bitso.Balance
+
+	StartingEquity 		decimal.Decimal
+	EndingEquity 		decimal.Decimal
+	PnL 				decimal.Decimal
+	MaxDrawdown 		decimal.Decimal // largest drop from a previous equity peak
+	MaxDrawdownPercent 	decimal.Decimal
+	Turnover 			decimal.Decimal // total value of the fills
+}
+
+// New returns an Engine for the given books and fees (see Client.AvailableBooks and Client.AccountFees), starting
+// balances and quote currency
+func New(books map[bitso.BookCode]bitso.Book, fees map[bitso.BookCode]bitso.Fee, balances map[bitso.CurrencyCode]decimal.Decimal, quote bitso.CurrencyCode, strategy Strategy) *Engine {
+	e := &Engine{
+		books: books,
+		quote: quote,
+		strategy: strategy,
+		trader: paper.NewTrader(books, fees, balances),
+		orderBooks: make(map[bitso.BookCode]*bitso.OrderBook),
+		lastPrices: make(map[bitso.BookCode]decimal.Decimal),
+		snapshots: make(map[bitso.BookCode]bitso.Orders),
+		depth: make(map[bitso.BookCode]bool),
+		report: Report{
+			Fees: make(map[bitso.CurrencyCode]decimal.Decimal),
+		},
+	}
+
+	e.ctx = &Context{engine: e}
+	e.trader.SetClock(func() time.Time { return e.now })
+	e.trader.OnFill(e.recordFill)
+
+	return e
+}
+
+// Run feeds every frame of a recording and returns the report. The replay speed is ignored, the recording is
+// processed as fast as possible.
+func (e *Engine) Run(replayer *bitso.Replayer) (Report, error) {
+	defer replayer.Close()
+
+	for {
+		f, err := replayer.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return e.Report(), err
+		}
+
+		msg, ok, err := bitso.ParseFrame([]byte(f.Frame))
+		if err != nil {
+			e.report.SkippedFrames++
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		e.Feed(Event{Time: f.Time(), FeedMessage: msg})
+	}
+
+	return e.Report(), nil
+}
+
+// Feed processes a single event, for data that does not come from a recording. Events must be fed in time order.
+func (e *Engine) Feed(event Event) {
+	e.now = event.Time
+	if e.report.Start.IsZero() {
+		e.report.Start = event.Time
+	}
+	e.report.End = event.Time
+	e.report.Events++
+
+	if orders, ok := event.Orders(); ok {
+		// the Orders channel only carries the top of the book, it seeds the local book but never replaces the depth
+		// built from Diff-Orders
+		e.snapshots[event.Book] = orders
+		if !e.depth[event.Book] {
+			e.seed(event.Book)
+			e.trader.UpdateOrders(event.Book, orders)
+		}
+	}
+
+	if diffs, ok := event.DiffOrders(); ok {
+		ob := e.orderBook(event.Book)
+		if err := ob.ApplyDiff(event.Sequence, diffs); err != nil {
+			// the missed diffs are lost, the book starts over from the last snapshot, or empty without one
+			e.report.SequenceGaps++
+			e.seed(event.Book)
+			ob.ApplyDiff(event.Sequence, diffs)
+		}
+		e.depth[event.Book] = true
+		e.trader.UpdateOrders(event.Book, ob.Snapshot(0))
+	}
+
+	if trades, ok := event.Trades(); ok {
+		e.trader.UpdateTrades(event.Book, trades)
+		if len(trades) > 0 {
+			e.lastPrices[event.Book] = trades[len(trades) - 1].Rate
+		}
+	}
+
+	if e.strategy != nil {
+		e.strategy(e.ctx, event)
+	}
+
+	e.mark()
+}
+
+func (e *Engine) orderBook(book bitso.BookCode) *bitso.OrderBook {
+	ob, ok := e.orderBooks[book]
+	if !ok {
+		// recordings without Orders snapshots build the book from the diffs alone
+		ob = bitso.NewOrderBook(book)
+		e.orderBooks[book] = ob
+	}
+	return ob
+}
+
+// seed resets the local book to the levels of the last Orders snapshot. Its sequence numbers are not the
+// Diff-Orders ones, the book takes the sequence of the first diff that follows.
+func (e *Engine) seed(book bitso.BookCode) {
+	orders := e.snapshots[book]
+	e.orderBook(book).Reset(0, levels(book, orders.Bids), levels(book, orders.Asks))
+}
+
+// levels converts the offers of an Orders snapshot, which carry no order ids
+func levels(book bitso.BookCode, offers []bitso.Offer) []bitso.PublicOrderBookOffer {
+	levels := make([]bitso.PublicOrderBookOffer, 0, len(offers))
+	for _, o := range offers {
+		levels = append(levels, bitso.PublicOrderBookOffer{Book: book, Price: o.Rate, Amount: o.Amount})
+	}
+	return levels
+}
+
+func (e *Engine) recordFill(fill bitso.UserTrade) {
+	e.report.Fills = append(e.report.Fills, fill)
+	e.report.Fees[fill.FeesCurrency] = e.report.Fees[fill.FeesCurrency].Add(fill.FeesAmount)
+
+	if book, ok := e.books[fill.Book]; ok {
+		if value, ok := e.value(book.Minor.Code, fill.Minor.Abs()); ok {
+			e.report.Turnover = e.report.Turnover.Add(value)
+		}
+	}
+}
+
+// mark updates the equity and the drawdown, once every held currency has a price
+func (e *Engine) mark() {
+	equity, complete := e.equity()
+	if !complete {
+		return
+	}
+
+	if !e.marked {
+		e.marked = true
+		e.report.StartingEquity = equity
+		e.peak = equity
+	}
+
+	if equity.GreaterThan(e.peak) {
+		e.peak = equity
+	}
+
+	drawdown := e.peak.Sub(equity)
+	if drawdown.GreaterThan(e.report.MaxDrawdown) {
+		e.report.MaxDrawdown = drawdown
+		if e.peak.IsPositive() {
+			e.report.MaxDrawdownPercent = drawdown.Div(e.peak).Mul(decimal.NewFromInt(100)).Round(2)
+		}
+	}
+
+	e.report.EndingEquity = equity
+	e.report.PnL = equity.Sub(e.report.StartingEquity)
+}
+
+func (e *Engine) equity() (decimal.Decimal, bool) {
+	balances, _ := e.trader.AccountBalance()
+
+	equity := decimal.Zero
+	for c, b := range balances {
+		if b.Total.IsZero() {
+			continue
+		}
+
+		value, ok := e.value(c, b.Total)
+		if !ok {
+			return decimal.Zero, false
+		}
+		equity = equity.Add(value)
+	}
+
+	return equity, true
+}
+
+// value converts an amount to the quote currency with the last price of a book between both currencies
+func (e *Engine) value(currency bitso.CurrencyCode, amount decimal.Decimal) (decimal.Decimal, bool) {
+	if currency == e.quote {
+		return amount, true
+	}
+
+	book, ok := bitso.FindBookFromTwoCurrencies(e.books, currency, e.quote)
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	price := e.price(book.BookCode)
+	if !price.IsPositive() {
+		return decimal.Zero, false
+	}
+
+	if book.Major.Code == currency {
+		return amount.Mul(price), true
+	}
+	return amount.Div(price), true
+}
+
+// price is the last trade rate of the book, or the middle of the local book before the first trade
+func (e *Engine) price(book bitso.BookCode) decimal.Decimal {
+	if price, ok := e.lastPrices[book]; ok {
+		return price
+	}
+
+	if ob, ok := e.orderBooks[book]; ok {
+		top := ob.Snapshot(1)
+		if len(top.Bids) > 0 && len(top.Asks) > 0 {
+			return top.Bids[0].Rate.Add(top.Asks[0].Rate).Div(decimal.NewFromInt(2))
+		}
+	}
+
+	return decimal.Zero
+}
+
+// Report returns the statistics of the run so far
+func (e *Engine) Report() Report {
+	r := e.report
+
+	r.Fills = make([]bitso.UserTrade, len(e.report.Fills))
+	copy(r.Fills, e.report.Fills)
+
+	r.Fees = make(map[bitso.CurrencyCode]decimal.Decimal, len(e.report.Fees))
+	for c, fee := range e.report.Fees {
+		r.Fees[c] = fee
+	}
+
+	r.Balances, _ = e.trader.AccountBalance()
+
+	return r
+}
@@ -0,0 +1,80 @@
+package backtest
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+func TestOrderBookReplay(t *testing.T) {
+	// an Orders snapshot or a diff with a single ask, the two channels number their messages independently
+	type message struct {
+		channel 	bitso.Channel
+		sequence 	int64
+		rate 		string
+	}
+
+	tests := []struct {
+		name 		string
+		messages 	[]message
+		asks 		[]string // rates of the local book asks after the messages
+		gaps 		int
+	}{
+		{"snapshots keep the diff depth", []message{
+			{bitso.Channel_ORDERS, 1523, "101"},
+			{bitso.Channel_DIFF_ORDERS, 84721, "105"},
+			{bitso.Channel_DIFF_ORDERS, 84722, "103"},
+			{bitso.Channel_ORDERS, 1524, "101"},
+			{bitso.Channel_DIFF_ORDERS, 84720, "104"}, // stale
+		}, []string{"101", "103", "105"}, 0},
+		{"gap rebuilt from the last snapshot", []message{
+			{bitso.Channel_ORDERS, 1523, "101"},
+			{bitso.Channel_DIFF_ORDERS, 84721, "105"},
+			{bitso.Channel_DIFF_ORDERS, 84725, "104"},
+			{bitso.Channel_DIFF_ORDERS, 84726, "106"},
+		}, []string{"101", "104", "106"}, 1},
+		{"gaps without snapshots", []message{
+			{bitso.Channel_DIFF_ORDERS, 84721, "101"},
+			{bitso.Channel_DIFF_ORDERS, 84725, "103"},
+			{bitso.Channel_DIFF_ORDERS, 84730, "105"},
+			{bitso.Channel_DIFF_ORDERS, 84731, "106"},
+		}, []string{"105", "106"}, 2},
+	}
+
+	currencies := bitso.CurrencyList()
+	books := map[bitso.BookCode]bitso.Book{
+		bitso.BookCode_BTC_MXN: {BookCode: bitso.BookCode_BTC_MXN, Major: currencies[bitso.CurrencyCode_BTC], Minor: currencies[bitso.CurrencyCode_MXN]},
+	}
+
+	for _, tt := range tests {
+		var asks []bitso.Offer
+		engine := New(books, nil, nil, bitso.CurrencyCode_MXN, func(ctx *Context, event Event) {
+			asks = ctx.OrderBook(bitso.BookCode_BTC_MXN).Asks
+		})
+
+		for _, m := range tt.messages {
+			rate := decimal.RequireFromString(m.rate)
+			var payload interface{} = bitso.Orders{Asks: []bitso.Offer{{Rate: rate, Amount: decimal.NewFromInt(1)}}}
+			if m.channel == bitso.Channel_DIFF_ORDERS {
+				payload = []bitso.DiffOrder{{OrderId: "o" + strconv.FormatInt(m.sequence, 10), Rate: rate, Side: bitso.Side_SELL, Amount: decimal.NewFromInt(1), Status: "open"}}
+			}
+
+			engine.Feed(Event{Time: time.Now(), FeedMessage: bitso.FeedMessage{Channel: m.channel, Book: bitso.BookCode_BTC_MXN, Sequence: m.sequence, Payload: payload}})
+		}
+
+		rates := make([]string, 0, len(asks))
+		for _, a := range asks {
+			rates = append(rates, a.Rate.String())
+		}
+		if fmt.Sprint(rates) != fmt.Sprint(tt.asks) {
+			t.Errorf("%s: asks at %v, expecting %v", tt.name, rates, tt.asks)
+		}
+		if gaps := engine.Report().SequenceGaps; gaps != tt.gaps {
+			t.Errorf("%s: %d sequence gaps, expecting %d", tt.name, gaps, tt.gaps)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Package bitsoprom implements the bitso.Metrics hooks and exposes them in the Prometheus text exposition format,
+// without depending on the Prometheus client library.
+package bitsoprom
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angle/gobitso"
+)
+
+var _ bitso.Metrics = (*Exporter)(nil)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request latency histogram
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	method 		string
+	endpoint 	string
+	status 		int
+	code 		string
+}
+
+type endpointKey struct {
+	method 		string
+	endpoint 	string
+}
+
+type messageKey struct {
+	channel bitso.Channel
+	book 	bitso.BookCode
+}
+
+type histogram struct {
+	counts 	[]uint64 // one per bucket, non-cumulative
+	sum 	float64
+	count 	uint64
+}
+
+// DefaultQueue is the queue label of the depth reported to the Exporter itself, see Queue
+const DefaultQueue = "default"
+
+// labelEscaper escapes a label value as the text exposition format expects it
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Exporter collects the metrics of any number of Clients and Websockets. The counters are summed across all of
+// them, while every feed queue needs its own depth gauge: give each Websocket or hub subscriber its own Queue.
+type Exporter struct {
+	mu 			sync.Mutex
+	buckets 	[]float64
+
+	requests 	map[requestKey]uint64
+	latencies 	map[endpointKey]*histogram
+	messages 	map[messageKey]uint64
+	dropped 	map[messageKey]uint64
+	reconnects 	uint64
+	queueDepth 	map[string]int
+}
+
+// queueMetrics reports to an Exporter with the queue depth under its own label
+type queueMetrics struct {
+	*Exporter
+	queue string
+}
+
+func (m queueMetrics) ObserveQueueDepth(depth int) {
+	m.setQueueDepth(m.queue, depth)
+}
+
+// New returns an empty Exporter using DefaultBuckets
+func New() *Exporter {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets returns an empty Exporter with custom latency histogram buckets (in seconds, ascending)
+func NewWithBuckets(buckets []float64) *Exporter {
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &Exporter{
+		buckets: b,
+		requests: make(map[requestKey]uint64),
+		latencies: make(map[endpointKey]*histogram),
+		messages: make(map[messageKey]uint64),
+		dropped: make(map[messageKey]uint64),
+		queueDepth: make(map[string]int),
+	}
+}
+
+// Queue returns a bitso.Metrics that shares every counter of the Exporter but reports the depth of its feed queue
+// with the given queue label, ex. for WithMetrics or HubSubscriber.SetMetrics
+func (e *Exporter) Queue(name string) bitso.Metrics {
+	return queueMetrics{Exporter: e, queue: name}
+}
+
+func (e *Exporter) ObserveRequest(method, endpoint string, status int, errorCode string, latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.requests[requestKey{method: method, endpoint: endpoint, status: status, code: errorCode}]++
+
+	k := endpointKey{method: method, endpoint: endpoint}
+	h, ok := e.latencies[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(e.buckets))}
+		e.latencies[k] = h
+	}
+
+	seconds := latency.Seconds()
+	for i, upper := range e.buckets {
+		if seconds <= upper {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (e *Exporter) ObserveMessage(channel bitso.Channel, book bitso.BookCode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.messages[messageKey{channel: channel, book: book}]++
+}
+
+func (e *Exporter) ObserveDropped(channel bitso.Channel, book bitso.BookCode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.dropped[messageKey{channel: channel, book: book}]++
+}
+
+func (e *Exporter) ObserveReconnect() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.reconnects++
+}
+
+// ObserveQueueDepth sets the depth of the DefaultQueue
+func (e *Exporter) ObserveQueueDepth(depth int) {
+	e.setQueueDepth(DefaultQueue, depth)
+}
+
+func (e *Exporter) setQueueDepth(queue string, depth int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.queueDepth[queue] = depth
+}
+
+// ServeHTTP writes every metric, it can be mounted directly as the /metrics handler
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.WriteTo(w)
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString("# HELP bitso_http_requests_total REST requests by endpoint, status and Bitso error code.\n")
+	b.WriteString("# TYPE bitso_http_requests_total counter\n")
+	for _, line := range e.requestLines() {
+		b.WriteString(line)
+	}
+
+	b.WriteString("# HELP bitso_http_request_duration_seconds REST request latency.\n")
+	b.WriteString("# TYPE bitso_http_request_duration_seconds histogram\n")
+	for _, line := range e.latencyLines() {
+		b.WriteString(line)
+	}
+
+	b.WriteString("# HELP bitso_websocket_messages_total Websocket messages received by channel and book.\n")
+	b.WriteString("# TYPE bitso_websocket_messages_total counter\n")
+	for _, line := range messageLines("bitso_websocket_messages_total", e.messages) {
+		b.WriteString(line)
+	}
+
+	b.WriteString("# HELP bitso_websocket_dropped_messages_total Websocket messages discarded by the feed queue.\n")
+	b.WriteString("# TYPE bitso_websocket_dropped_messages_total counter\n")
+	for _, line := range messageLines("bitso_websocket_dropped_messages_total", e.dropped) {
+		b.WriteString(line)
+	}
+
+	b.WriteString("# HELP bitso_websocket_reconnects_total Successful websocket reconnections.\n")
+	b.WriteString("# TYPE bitso_websocket_reconnects_total counter\n")
+	b.WriteString(fmt.Sprintf("bitso_websocket_reconnects_total %d\n", e.reconnects))
+
+	b.WriteString("# HELP bitso_websocket_queue_depth Messages waiting for the feed consumer by queue.\n")
+	b.WriteString("# TYPE bitso_websocket_queue_depth gauge\n")
+	for _, line := range e.queueLines() {
+		b.WriteString(line)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// must be called with the lock held
+func (e *Exporter) requestLines() []string {
+	lines := make([]string, 0, len(e.requests))
+	for k, n := range e.requests {
+		lines = append(lines, fmt.Sprintf("bitso_http_requests_total{method=\"%s\",endpoint=\"%s\",status=\"%d\",code=\"%s\"} %d\n", escape(k.method), escape(k.endpoint), k.status, escape(k.code), n))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// must be called with the lock held
+func (e *Exporter) latencyLines() []string {
+	keys := make([]endpointKey, 0, len(e.latencies))
+	for k := range e.latencies {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].endpoint != keys[j].endpoint {
+			return keys[i].endpoint < keys[j].endpoint
+		}
+		return keys[i].method < keys[j].method
+	})
+
+	lines := make([]string, 0)
+	for _, k := range keys {
+		h := e.latencies[k]
+		labels := fmt.Sprintf("method=\"%s\",endpoint=\"%s\"", escape(k.method), escape(k.endpoint))
+
+		var cumulative uint64
+		for i, upper := range e.buckets {
+			cumulative += h.counts[i]
+			lines = append(lines, fmt.Sprintf("bitso_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(upper, 'g', -1, 64), cumulative))
+		}
+		lines = append(lines, fmt.Sprintf("bitso_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count))
+		lines = append(lines, fmt.Sprintf("bitso_http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64)))
+		lines = append(lines, fmt.Sprintf("bitso_http_request_duration_seconds_count{%s} %d\n", labels, h.count))
+	}
+	return lines
+}
+
+func messageLines(name string, counters map[messageKey]uint64) []string {
+	lines := make([]string, 0, len(counters))
+	for k, n := range counters {
+		lines = append(lines, fmt.Sprintf("%s{channel=\"%s\",book=\"%s\"} %d\n", name, escape(string(k.channel)), escape(string(k.book)), n))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// must be called with the lock held
+func (e *Exporter) queueLines() []string {
+	lines := make([]string, 0, len(e.queueDepth))
+	for queue, depth := range e.queueDepth {
+		lines = append(lines, fmt.Sprintf("bitso_websocket_queue_depth{queue=\"%s\"} %d\n", escape(queue), depth))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// escape returns a label value with its backslashes, double quotes and line feeds escaped, Go's %q escapes more
+// than the format allows
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,68 @@
+package bitsoprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+)
+
+func TestExposition(t *testing.T) {
+	e := NewWithBuckets([]float64{0.1, 1})
+
+	e.ObserveRequest("GET", "/v3/ticker/", 200, "", 50*time.Millisecond)
+	e.ObserveRequest("GET", "/v3/ticker/", 200, "", 500*time.Millisecond)
+	e.ObserveRequest("POST", "/v3/orders/", 400, "0379", 2*time.Second)
+	e.ObserveMessage(bitso.Channel_TRADES, "btc_mxn")
+	e.ObserveMessage(bitso.Channel_TRADES, "btc_mxn")
+	e.ObserveDropped(bitso.Channel_ORDERS, "eth_mxn")
+	e.ObserveReconnect()
+
+	// one gauge per queue, the views share every counter
+	e.ObserveQueueDepth(1)
+	e.Queue("hub \"a\"\\b\nc").ObserveQueueDepth(7)
+	e.Queue("hub").ObserveQueueDepth(3)
+	e.Queue("hub").ObserveReconnect()
+
+	var b strings.Builder
+	if _, err := e.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP bitso_http_requests_total REST requests by endpoint, status and Bitso error code.
+# TYPE bitso_http_requests_total counter
+bitso_http_requests_total{method="GET",endpoint="/v3/ticker/",status="200",code=""} 2
+bitso_http_requests_total{method="POST",endpoint="/v3/orders/",status="400",code="0379"} 1
+# HELP bitso_http_request_duration_seconds REST request latency.
+# TYPE bitso_http_request_duration_seconds histogram
+bitso_http_request_duration_seconds_bucket{method="POST",endpoint="/v3/orders/",le="0.1"} 0
+bitso_http_request_duration_seconds_bucket{method="POST",endpoint="/v3/orders/",le="1"} 0
+bitso_http_request_duration_seconds_bucket{method="POST",endpoint="/v3/orders/",le="+Inf"} 1
+bitso_http_request_duration_seconds_sum{method="POST",endpoint="/v3/orders/"} 2
+bitso_http_request_duration_seconds_count{method="POST",endpoint="/v3/orders/"} 1
+bitso_http_request_duration_seconds_bucket{method="GET",endpoint="/v3/ticker/",le="0.1"} 1
+bitso_http_request_duration_seconds_bucket{method="GET",endpoint="/v3/ticker/",le="1"} 2
+bitso_http_request_duration_seconds_bucket{method="GET",endpoint="/v3/ticker/",le="+Inf"} 2
+bitso_http_request_duration_seconds_sum{method="GET",endpoint="/v3/ticker/"} 0.55
+bitso_http_request_duration_seconds_count{method="GET",endpoint="/v3/ticker/"} 2
+# HELP bitso_websocket_messages_total Websocket messages received by channel and book.
+# TYPE bitso_websocket_messages_total counter
+bitso_websocket_messages_total{channel="trades",book="btc_mxn"} 2
+# HELP bitso_websocket_dropped_messages_total Websocket messages discarded by the feed queue.
+# TYPE bitso_websocket_dropped_messages_total counter
+bitso_websocket_dropped_messages_total{channel="orders",book="eth_mxn"} 1
+# HELP bitso_websocket_reconnects_total Successful websocket reconnections.
+# TYPE bitso_websocket_reconnects_total counter
+bitso_websocket_reconnects_total 2
+# HELP bitso_websocket_queue_depth Messages waiting for the feed consumer by queue.
+# TYPE bitso_websocket_queue_depth gauge
+bitso_websocket_queue_depth{queue="default"} 1
+bitso_websocket_queue_depth{queue="hub \"a\"\\b\nc"} 7
+bitso_websocket_queue_depth{queue="hub"} 3
+`
+
+	if b.String() != expected {
+		t.Errorf("received\n%s\nexpecting\n%s", b.String(), expected)
+	}
+}
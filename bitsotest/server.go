@@ -0,0 +1,871 @@
+// Package bitsotest provides in-process fakes of the Bitso REST and websocket APIs, so code built on the bitso
+// package can be tested without reaching api.bitso.com.
+package bitsotest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+// Error codes returned by the fake server
+const (
+	ErrorCode_UNKNOWN 			= "0101"
+	ErrorCode_INVALID_SIGNATURE = "0201"
+	ErrorCode_UNKNOWN_BOOK 		= "0301"
+	ErrorCode_INVALID_PARAMETER = "0302"
+	ErrorCode_ORDER_NOT_FOUND 	= "0404"
+)
+
+const DEFAULT_KEY = "bitsotest-key"
+const DEFAULT_SECRET = "bitsotest-secret"
+
+// TIME_LAYOUT is the format Bitso uses for the created_at and updated_at fields
+const TIME_LAYOUT = "2006-01-02T15:04:05.000-07:00"
+
+// Order is the wire representation of an order, as returned by the orders endpoints
+type Order struct {
+	Book 			bitso.BookCode 	`json:"book"`
+	Oid 			string 			`json:"oid"`
+	OriginId 		string 			`json:"origin_id,omitempty"`
+	Side 			string 			`json:"side"`
+	Type 			string 			`json:"type"`
+	Status 			string 			`json:"status"`
+	OriginalAmount 	decimal.Decimal `json:"original_amount"`
+	UnfilledAmount 	decimal.Decimal `json:"unfilled_amount"`
+	OriginalValue 	decimal.Decimal `json:"original_value"`
+	Price 			decimal.Decimal `json:"price"`
+	CreatedAt 		string 			`json:"created_at"`
+	UpdatedAt 		string 			`json:"updated_at"`
+}
+
+// UserTrade is the wire representation of a fill, as returned by the user_trades endpoint
+type UserTrade struct {
+	Book 			bitso.BookCode 	`json:"book"`
+	Tid 			int64 			`json:"tid"`
+	Oid 			string 			`json:"oid"`
+	Side 			string 			`json:"side"`
+	Major 			decimal.Decimal `json:"major"`
+	Minor 			decimal.Decimal `json:"minor"`
+	Price 			decimal.Decimal `json:"price"`
+	FeesAmount 		decimal.Decimal `json:"fees_amount"`
+	FeesCurrency 	string 			`json:"fees_currency"`
+	MakerSide 		string 			`json:"maker_side"`
+	CreatedAt 		string 			`json:"created_at"`
+}
+
+// LedgerEntry is the wire representation of a ledger entry, as returned by the ledger endpoint
+type LedgerEntry struct {
+	Eid 			string 					`json:"eid"`
+	Operation 		string 					`json:"operation"`
+	CreatedAt 		string 					`json:"created_at"`
+	BalanceUpdates 	[]LedgerBalanceUpdate 	`json:"balance_updates"`
+	Details 		map[string]interface{} 	`json:"details"`
+}
+
+type LedgerBalanceUpdate struct {
+	Currency 	string 			`json:"currency"`
+	Amount 		decimal.Decimal `json:"amount"`
+}
+
+// OrderBook is the wire representation of an aggregated order book, as returned by the order_book endpoint
+type OrderBook struct {
+	Asks 		[]OrderBookOffer 	`json:"asks"`
+	Bids 		[]OrderBookOffer 	`json:"bids"`
+	UpdatedAt 	string 				`json:"updated_at"`
+	Sequence 	string 				`json:"sequence"`
+}
+
+type OrderBookOffer struct {
+	Book 	bitso.BookCode 	`json:"book"`
+	Price 	decimal.Decimal `json:"price"`
+	Amount 	decimal.Decimal `json:"amount"`
+}
+
+// Ticker is the wire representation of a ticker, as returned by the ticker endpoint
+type Ticker struct {
+	Book 		bitso.BookCode 	`json:"book"`
+	Volume 		decimal.Decimal `json:"volume"`
+	High 		decimal.Decimal `json:"high"`
+	Last 		decimal.Decimal `json:"last"`
+	Low 		decimal.Decimal `json:"low"`
+	Vwap 		decimal.Decimal `json:"vwap"`
+	Ask 		decimal.Decimal `json:"ask"`
+	Bid 		decimal.Decimal `json:"bid"`
+	CreatedAt 	string 			`json:"created_at"`
+}
+
+// PublicTrade is the wire representation of a market trade, as returned by the public trades endpoint
+type PublicTrade struct {
+	Book 		bitso.BookCode 	`json:"book"`
+	Tid 		int64 			`json:"tid"`
+	Amount 		decimal.Decimal `json:"amount"`
+	Price 		decimal.Decimal `json:"price"`
+	MakerSide 	string 			`json:"maker_side"`
+	CreatedAt 	string 			`json:"created_at"`
+}
+
+// Server is a fake of the Bitso v3 REST API. It serves books, balances, fees, orders and trades from memory and
+// verifies the Authorization header of private calls exactly as Bitso does. Orders are never matched, tests
+// drive fills with FillOrder.
+type Server struct {
+	*httptest.Server
+
+	Key 	string
+	Secret 	string
+
+	mu 				sync.Mutex
+	books 			[]bitso.PublicAvailableBooksPayload
+	catalogue 		[]bitso.PublicCatalogueCurrencyPayload
+	balances 		map[bitso.CurrencyCode]bitso.Balance
+	fees 			map[bitso.BookCode]bitso.Fee
+	withdrawalFees 	map[bitso.CurrencyCode]decimal.Decimal
+	orders 			map[string]*Order
+	orderIds 		[]string // in placement order
+	orderSeq 		int64
+	userTrades 		[]UserTrade
+	trades 			map[bitso.BookCode][]PublicTrade
+	tickers 		map[bitso.BookCode]Ticker
+	orderBooks 		map[bitso.BookCode]OrderBook
+	ledger 			[]LedgerEntry
+	ledgerSeq 		int64
+	tradeSeq 		int64
+	lastNonce 		int64
+	requests 		[]string
+}
+
+// NewServer starts a fake REST server with a few default books, balances and fees, using DEFAULT_KEY and
+// DEFAULT_SECRET as the API credentials. Close must be called when done.
+func NewServer() *Server {
+	s := &Server{
+		Key: DEFAULT_KEY,
+		Secret: DEFAULT_SECRET,
+		balances: make(map[bitso.CurrencyCode]bitso.Balance),
+		fees: make(map[bitso.BookCode]bitso.Fee),
+		withdrawalFees: make(map[bitso.CurrencyCode]decimal.Decimal),
+		orders: make(map[string]*Order),
+		trades: make(map[bitso.BookCode][]PublicTrade),
+		tickers: make(map[bitso.BookCode]Ticker),
+		orderBooks: make(map[bitso.BookCode]OrderBook),
+		catalogue: make([]bitso.PublicCatalogueCurrencyPayload, 0),
+	}
+
+	s.books = []bitso.PublicAvailableBooksPayload{
+		book("btc_mxn", "0.00001", "500", "1", "10000000", "10", "10000000"),
+		book("eth_mxn", "0.0001", "5000", "1", "1000000", "10", "10000000"),
+		book("xrp_mxn", "0.5", "500000", "0.0001", "5000", "10", "10000000"),
+		book("eth_btc", "0.0001", "5000", "0.00000001", "1", "0.00001", "100"),
+		book("xrp_btc", "0.5", "500000", "0.00000001", "1", "0.00001", "100"),
+	}
+
+	for _, b := range s.books {
+		s.fees[bitso.BookCode(b.Book)] = bitso.Fee{
+			BookCode: bitso.BookCode(b.Book),
+			TakerFeeDecimal: decimal.RequireFromString("0.0065"),
+			TakerFeePercent: decimal.RequireFromString("0.65"),
+			MakerFeeDecimal: decimal.RequireFromString("0.005"),
+			MakerFeePercent: decimal.RequireFromString("0.5"),
+		}
+	}
+
+	s.SetBalance(bitso.CurrencyCode_MXN, decimal.NewFromInt(100000), decimal.Zero)
+	s.SetBalance(bitso.CurrencyCode_BTC, decimal.NewFromInt(1), decimal.Zero)
+	s.SetBalance(bitso.CurrencyCode_ETH, decimal.NewFromInt(10), decimal.Zero)
+	s.SetBalance(bitso.CurrencyCode_XRP, decimal.NewFromInt(1000), decimal.Zero)
+
+	s.withdrawalFees[bitso.CurrencyCode_BTC] = decimal.RequireFromString("0.0001")
+	s.withdrawalFees[bitso.CurrencyCode_ETH] = decimal.RequireFromString("0.005")
+	s.withdrawalFees[bitso.CurrencyCode_XRP] = decimal.RequireFromString("0.02")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/available_books/", s.public(s.handleAvailableBooks))
+	mux.HandleFunc("/v3/catalogues/", s.public(s.handleCatalogue))
+	mux.HandleFunc("/v3/ticker/", s.public(s.handleTicker))
+	mux.HandleFunc("/v3/order_book/", s.public(s.handleOrderBook))
+	mux.HandleFunc("/v3/trades/", s.public(s.handleTrades))
+	mux.HandleFunc("/v3/balance/", s.private(s.handleBalance))
+	mux.HandleFunc("/v3/fees/", s.private(s.handleFees))
+	mux.HandleFunc("/v3/orders/", s.private(s.handleOrders))
+	mux.HandleFunc("/v3/open_orders/", s.private(s.handleOpenOrders))
+	mux.HandleFunc("/v3/user_trades/", s.private(s.handleUserTrades))
+	mux.HandleFunc("/v3/ledger/", s.private(s.handleLedger))
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+func book(code, minAmount, maxAmount, minPrice, maxPrice, minValue, maxValue string) bitso.PublicAvailableBooksPayload {
+	return bitso.PublicAvailableBooksPayload{
+		Book: code,
+		MinimumAmount: decimal.RequireFromString(minAmount),
+		MaximumAmount: decimal.RequireFromString(maxAmount),
+		MinimumPrice: decimal.RequireFromString(minPrice),
+		MaximumPrice: decimal.RequireFromString(maxPrice),
+		MinimumValue: decimal.RequireFromString(minValue),
+		MaximumValue: decimal.RequireFromString(maxValue),
+	}
+}
+
+// Client returns a bitso.Client pointed at the fake server and using its credentials
+func (s *Server) Client() *bitso.Client {
+	client := bitso.NewClient()
+	client.SetAPIEndpoint(s.URL)
+	client.SetPrivateKey(s.Key, s.Secret)
+	return client
+}
+
+// SetBooks replaces the books served by available_books
+func (s *Server) SetBooks(books []bitso.PublicAvailableBooksPayload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.books = books
+}
+
+// SetCatalogue replaces the currencies served by catalogues, empty by default
+func (s *Server) SetCatalogue(currencies []bitso.PublicCatalogueCurrencyPayload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.catalogue = currencies
+}
+
+// SetBalance sets the available and locked amounts of a currency, the total is their sum
+func (s *Server) SetBalance(currency bitso.CurrencyCode, available, locked decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.balances[currency] = bitso.Balance{
+		Currency: currency,
+		Available: available,
+		Locked: locked,
+		Total: available.Add(locked),
+	}
+}
+
+// SetFee sets the maker and taker fees of a book
+func (s *Server) SetFee(fee bitso.Fee) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fees[fee.BookCode] = fee
+}
+
+// SetWithdrawalFee sets the withdrawal fee of a currency
+func (s *Server) SetWithdrawalFee(currency bitso.CurrencyCode, fee decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.withdrawalFees[currency] = fee
+}
+
+// SetTicker sets the best bid and ask and the last price of a book, the 24 hour statistics are left at zero
+func (s *Server) SetTicker(book bitso.BookCode, bid, ask, last decimal.Decimal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tickers[book] = Ticker{
+		Book: book,
+		Last: last,
+		Ask: ask,
+		Bid: bid,
+		CreatedAt: time.Now().Format(TIME_LAYOUT),
+	}
+}
+
+// SetOrderBook sets the offers served by order_book for a book, best first, and its sequence. Books without one
+// are served empty.
+func (s *Server) SetOrderBook(book bitso.BookCode, orders bitso.Orders, sequence int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ob := OrderBook{
+		Asks: make([]OrderBookOffer, 0, len(orders.Asks)),
+		Bids: make([]OrderBookOffer, 0, len(orders.Bids)),
+		UpdatedAt: time.Now().Format(TIME_LAYOUT),
+		Sequence: strconv.FormatInt(sequence, 10),
+	}
+	for _, o := range orders.Asks {
+		ob.Asks = append(ob.Asks, OrderBookOffer{Book: book, Price: o.Rate, Amount: o.Amount})
+	}
+	for _, o := range orders.Bids {
+		ob.Bids = append(ob.Bids, OrderBookOffer{Book: book, Price: o.Rate, Amount: o.Amount})
+	}
+
+	s.orderBooks[book] = ob
+}
+
+// AddTrade appends a market trade to the public trades of a book and returns its tid
+func (s *Server) AddTrade(book bitso.BookCode, makerSide bitso.Side, amount, price decimal.Decimal, at time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tradeSeq++
+	s.trades[book] = append(s.trades[book], PublicTrade{
+		Book: book,
+		Tid: s.tradeSeq,
+		Amount: amount,
+		Price: price,
+		MakerSide: strings.ToLower(makerSide.String()),
+		CreatedAt: at.Format(TIME_LAYOUT),
+	})
+
+	return s.tradeSeq
+}
+
+// AddLedgerEntry appends an entry to the ledger, ex. a funding or a withdrawal, and returns its eid. Balances are
+// not updated, fills recorded with FillOrder do not show in the ledger either.
+func (s *Server) AddLedgerEntry(operation bitso.LedgerOperation, currency bitso.CurrencyCode, amount decimal.Decimal, at time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ledgerSeq++
+	eid := "eid" + strconv.FormatInt(s.ledgerSeq, 10)
+	s.ledger = append(s.ledger, LedgerEntry{
+		Eid: eid,
+		Operation: string(operation),
+		CreatedAt: at.Format(TIME_LAYOUT),
+		BalanceUpdates: []LedgerBalanceUpdate{{Currency: string(currency), Amount: amount}},
+		Details: map[string]interface{}{},
+	})
+
+	return eid
+}
+
+// Order returns a copy of a placed order
+func (s *Server) Order(oid string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[oid]
+	if !ok {
+		return Order{}, false
+	}
+	return *o, true
+}
+
+// FillOrder fills (part of) an open order at its price, recording a user trade with the book's maker fee. The
+// order is completed when nothing is left unfilled.
+func (s *Server) FillOrder(oid string, amount decimal.Decimal) (UserTrade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[oid]
+	if !ok || (o.Status != "open" && o.Status != "partially filled") {
+		return UserTrade{}, fmt.Errorf("order %s is not open", oid)
+	}
+
+	if amount.GreaterThan(o.UnfilledAmount) {
+		amount = o.UnfilledAmount
+	}
+
+	o.UnfilledAmount = o.UnfilledAmount.Sub(amount)
+	if o.UnfilledAmount.IsZero() {
+		o.Status = "completed"
+	} else {
+		o.Status = "partially filled"
+	}
+	o.UpdatedAt = time.Now().Format(TIME_LAYOUT)
+
+	minor := amount.Mul(o.Price)
+	feeRate := s.fees[o.Book].MakerFeeDecimal
+	parts := strings.SplitN(string(o.Book), "_", 2)
+
+	// fees are charged in the currency received
+	var feesAmount decimal.Decimal
+	var feesCurrency string
+	if o.Side == "buy" {
+		feesAmount = amount.Mul(feeRate)
+		feesCurrency = parts[0]
+	} else {
+		feesAmount = minor.Mul(feeRate)
+		feesCurrency = parts[1]
+	}
+
+	// major and minor are signed from the account's point of view
+	major := amount
+	if o.Side == "sell" {
+		major = major.Neg()
+	} else {
+		minor = minor.Neg()
+	}
+
+	s.tradeSeq++
+	t := UserTrade{
+		Book: o.Book,
+		Tid: s.tradeSeq,
+		Oid: o.Oid,
+		Side: o.Side,
+		Major: major,
+		Minor: minor,
+		Price: o.Price,
+		FeesAmount: feesAmount,
+		FeesCurrency: feesCurrency,
+		MakerSide: o.Side,
+		CreatedAt: o.UpdatedAt,
+	}
+	s.userTrades = append(s.userTrades, t)
+
+	return t, nil
+}
+
+// Requests returns the "METHOD /path" of every request received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]string, len(s.requests))
+	copy(out, s.requests)
+	return out
+}
+
+///////////////////////////////
+// HANDLERS
+
+func (s *Server) public(handler func(w http.ResponseWriter, r *http.Request, body []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.record(r)
+		handler(w, r, body)
+	}
+}
+
+func (s *Server) private(handler func(w http.ResponseWriter, r *http.Request, body []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.record(r)
+
+		if err := s.verifySignature(r, body); err != nil {
+			writeError(w, http.StatusUnauthorized, ErrorCode_INVALID_SIGNATURE, err.Error())
+			return
+		}
+
+		handler(w, r, body)
+	}
+}
+
+func (s *Server) record(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method + " " + r.URL.RequestURI())
+}
+
+// verifySignature checks the "Bitso <key>:<nonce>:<signature>" header, where the signature is the hex encoded
+// HMAC-SHA256 of nonce + method + request path + body using the secret, and the nonce must always increase
+func (s *Server) verifySignature(r *http.Request, body []byte) error {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bitso ") {
+		return fmt.Errorf("missing Bitso Authorization header")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(header, "Bitso "), ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed Authorization header")
+	}
+
+	key, nonceStr, signature := parts[0], parts[1], parts[2]
+	if key != s.Key {
+		return fmt.Errorf("unknown API key")
+	}
+
+	nonce, err := strconv.ParseInt(nonceStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid nonce")
+	}
+
+	h := hmac.New(sha256.New, []byte(s.Secret))
+	h.Write([]byte(nonceStr + r.Method + r.URL.RequestURI() + string(body)))
+	expected := hex.EncodeToString(h.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if nonce <= s.lastNonce {
+		return fmt.Errorf("invalid nonce, it must be greater than %d", s.lastNonce)
+	}
+	s.lastNonce = nonce
+
+	return nil
+}
+
+func writePayload(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"payload": payload,
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"error": bitso.ApiError{Code: code, Message: message},
+	})
+}
+
+func (s *Server) handleAvailableBooks(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writePayload(w, s.books)
+}
+
+func (s *Server) handleCatalogue(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writePayload(w, s.catalogue)
+}
+
+func (s *Server) hasBook(code bitso.BookCode) bool {
+	for _, b := range s.books {
+		if bitso.BookCode(b.Book) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTicker serves the ticker of a book, or of every book with a ticker set when no book is given
+func (s *Server) handleTicker(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book := bitso.BookCode(r.URL.Query().Get("book"))
+	if book == "" {
+		tickers := make([]Ticker, 0, len(s.tickers))
+		for _, t := range s.tickers {
+			tickers = append(tickers, t)
+		}
+		sort.Slice(tickers, func(i, j int) bool { return tickers[i].Book < tickers[j].Book })
+
+		writePayload(w, tickers)
+		return
+	}
+
+	t, ok := s.tickers[book]
+	if !s.hasBook(book) || !ok {
+		writeError(w, http.StatusBadRequest, ErrorCode_UNKNOWN_BOOK, "unknown book " + string(book))
+		return
+	}
+
+	writePayload(w, t)
+}
+
+func (s *Server) handleOrderBook(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book := bitso.BookCode(r.URL.Query().Get("book"))
+	if !s.hasBook(book) {
+		writeError(w, http.StatusBadRequest, ErrorCode_UNKNOWN_BOOK, "unknown book " + string(book))
+		return
+	}
+
+	ob, ok := s.orderBooks[book]
+	if !ok {
+		ob = OrderBook{
+			Asks: []OrderBookOffer{},
+			Bids: []OrderBookOffer{},
+			UpdatedAt: time.Now().Format(TIME_LAYOUT),
+			Sequence: "0",
+		}
+	}
+
+	writePayload(w, ob)
+}
+
+func (s *Server) handleTrades(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book := bitso.BookCode(r.URL.Query().Get("book"))
+	if !s.hasBook(book) {
+		writeError(w, http.StatusBadRequest, ErrorCode_UNKNOWN_BOOK, "unknown book " + string(book))
+		return
+	}
+
+	marker, _ := strconv.ParseInt(r.URL.Query().Get("marker"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = bitso.DEFAULT_PAGE_LIMIT
+	}
+
+	trades := make([]PublicTrade, 0, len(s.trades[book]))
+	for _, t := range s.trades[book] {
+		if marker == 0 || t.Tid < marker {
+			trades = append(trades, t)
+		}
+	}
+
+	// newest first, as Bitso does by default
+	sort.Slice(trades, func(i, j int) bool { return trades[i].Tid > trades[j].Tid })
+	if len(trades) > limit {
+		trades = trades[:limit]
+	}
+
+	writePayload(w, trades)
+}
+
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	balances := make([]bitso.Balance, 0, len(s.balances))
+	for _, b := range s.balances {
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Currency < balances[j].Currency })
+
+	writePayload(w, bitso.PrivateAccountBalancePayload{Balances: balances})
+}
+
+func (s *Server) handleFees(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fees := make([]bitso.Fee, 0, len(s.fees))
+	for _, f := range s.fees {
+		fees = append(fees, f)
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].BookCode < fees[j].BookCode })
+
+	writePayload(w, bitso.PrivateAccountFeesPayload{Fees: fees, WithdrawalFees: s.withdrawalFees})
+}
+
+// handleOrders serves POST /v3/orders/ (place), GET /v3/orders/<oid>/ (lookup) and DELETE /v3/orders/<oid>/ (cancel)
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request, body []byte) {
+	oid := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v3/orders/"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && oid == "":
+		s.placeOrder(w, body)
+	case r.Method == http.MethodGet && oid != "":
+		s.lookupOrder(w, oid)
+	case r.Method == http.MethodGet && r.URL.Query().Get("origin_ids") != "":
+		s.lookupOrigin(w, r.URL.Query().Get("origin_ids"))
+	case r.Method == http.MethodDelete && oid != "":
+		s.cancelOrder(w, oid)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ErrorCode_UNKNOWN, "unsupported method")
+	}
+}
+
+func (s *Server) placeOrder(w http.ResponseWriter, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req := map[string]string{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "invalid JSON body")
+		return
+	}
+
+	book := bitso.BookCode(req["book"])
+	if !s.hasBook(book) {
+		writeError(w, http.StatusBadRequest, ErrorCode_UNKNOWN_BOOK, "unknown book " + string(book))
+		return
+	}
+
+	side := req["side"]
+	if side != "buy" && side != "sell" {
+		writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "side must be buy or sell")
+		return
+	}
+
+	orderType := req["type"]
+	if orderType != "limit" && orderType != "market" {
+		writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "type must be limit or market")
+		return
+	}
+
+	// market orders may be given in minor instead
+	amount := decimal.Zero
+	value := decimal.Zero
+	var err error
+	if _, hasMinor := req["minor"]; hasMinor && orderType == "market" {
+		value, err = decimal.NewFromString(req["minor"])
+		if err != nil || !value.IsPositive() {
+			writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "minor must be a positive amount")
+			return
+		}
+	} else {
+		amount, err = decimal.NewFromString(req["major"])
+		if err != nil || !amount.IsPositive() {
+			writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "major must be a positive amount")
+			return
+		}
+	}
+
+	price := decimal.Zero
+	if orderType == "limit" {
+		price, err = decimal.NewFromString(req["price"])
+		if err != nil || !price.IsPositive() {
+			writeError(w, http.StatusBadRequest, ErrorCode_INVALID_PARAMETER, "price must be a positive amount")
+			return
+		}
+	}
+
+	s.orderSeq++
+	now := time.Now().Format(TIME_LAYOUT)
+	o := &Order{
+		Book: book,
+		Oid: "fake" + strconv.FormatInt(s.orderSeq, 10),
+		OriginId: req["origin_id"],
+		Side: side,
+		Type: orderType,
+		Status: "open",
+		OriginalAmount: amount,
+		UnfilledAmount: amount,
+		OriginalValue: decimal.Max(value, amount.Mul(price)),
+		Price: price,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.orders[o.Oid] = o
+	s.orderIds = append(s.orderIds, o.Oid)
+
+	writePayload(w, map[string]string{"oid": o.Oid})
+}
+
+// lookupOrder accepts several oids separated by dashes, unknown oids are skipped
+func (s *Server) lookupOrder(w http.ResponseWriter, oids string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]Order, 0)
+	for _, oid := range strings.Split(oids, "-") {
+		if o, ok := s.orders[oid]; ok {
+			orders = append(orders, *o)
+		}
+	}
+
+	if len(orders) == 0 {
+		writeError(w, http.StatusNotFound, ErrorCode_ORDER_NOT_FOUND, "order not found")
+		return
+	}
+
+	writePayload(w, orders)
+}
+
+// lookupOrigin accepts several origin ids separated by commas, unknown ids are skipped
+func (s *Server) lookupOrigin(w http.ResponseWriter, originIds string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make([]Order, 0)
+	for _, id := range strings.Split(originIds, ",") {
+		for _, oid := range s.orderIds {
+			if o := s.orders[oid]; o.OriginId == id {
+				orders = append(orders, *o)
+			}
+		}
+	}
+
+	writePayload(w, orders)
+}
+
+func (s *Server) cancelOrder(w http.ResponseWriter, oid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[oid]
+	if !ok || (o.Status != "open" && o.Status != "partially filled") {
+		writeError(w, http.StatusNotFound, ErrorCode_ORDER_NOT_FOUND, "order not found")
+		return
+	}
+
+	o.Status = "cancelled"
+	o.UpdatedAt = time.Now().Format(TIME_LAYOUT)
+
+	writePayload(w, []string{oid})
+}
+
+func (s *Server) handleOpenOrders(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book := bitso.BookCode(r.URL.Query().Get("book"))
+
+	orders := make([]Order, 0)
+	for _, oid := range s.orderIds {
+		o := s.orders[oid]
+		if o.Status != "open" && o.Status != "partially filled" {
+			continue
+		}
+		if book != "" && o.Book != book {
+			continue
+		}
+		orders = append(orders, *o)
+	}
+
+	writePayload(w, orders)
+}
+
+func (s *Server) handleUserTrades(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	book := bitso.BookCode(r.URL.Query().Get("book"))
+	marker, _ := strconv.ParseInt(r.URL.Query().Get("marker"), 10, 64)
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = bitso.DEFAULT_PAGE_LIMIT
+	}
+
+	trades := make([]UserTrade, 0)
+	for i := len(s.userTrades) - 1; i >= 0 && len(trades) < limit; i-- {
+		// newest first, older than the marker if any
+		t := s.userTrades[i]
+		if (book == "" || t.Book == book) && (marker == 0 || t.Tid < marker) {
+			trades = append(trades, t)
+		}
+	}
+
+	writePayload(w, trades)
+}
+
+func (s *Server) handleLedger(w http.ResponseWriter, r *http.Request, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	marker := r.URL.Query().Get("marker")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = bitso.DEFAULT_PAGE_LIMIT
+	}
+
+	// newest first, starting after the marker if any
+	entries := make([]LedgerEntry, 0)
+	skipping := marker != ""
+	for i := len(s.ledger) - 1; i >= 0 && len(entries) < limit; i-- {
+		if skipping {
+			skipping = s.ledger[i].Eid != marker
+			continue
+		}
+		entries = append(entries, s.ledger[i])
+	}
+
+	writePayload(w, entries)
+}
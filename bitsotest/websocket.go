@@ -0,0 +1,250 @@
+package bitsotest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketServer is a fake of the Bitso websocket API. It acknowledges subscribe and unsubscribe requests, sends
+// "ka" heartbeats and lets tests publish Orders, Trades and Diff-Orders messages to the subscribed connections.
+type WebsocketServer struct {
+	*httptest.Server
+
+	upgrader 	websocket.Upgrader
+
+	mu 			sync.Mutex
+	conns 		map[*fakeConn]bool
+	keepAlive 	bool
+	quit 		chan bool
+	quitOnce 	sync.Once
+}
+
+type fakeConn struct {
+	conn 			*websocket.Conn
+	writeMu 		sync.Mutex
+	subscriptions 	map[bitso.HubFilter]bool
+}
+
+// NewWebsocketServer starts a fake websocket server sending a "ka" heartbeat every keepAliveInterval, a zero
+// interval disables the heartbeats. Close must be called when done.
+func NewWebsocketServer(keepAliveInterval time.Duration) *WebsocketServer {
+	s := &WebsocketServer{
+		conns: make(map[*fakeConn]bool),
+		keepAlive: true,
+		quit: make(chan bool),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	if keepAliveInterval > 0 {
+		go s.heartbeat(keepAliveInterval)
+	}
+
+	return s
+}
+
+// URL returns the ws:// address of the server, to be used with bitso.WithEndpoint
+func (s *WebsocketServer) URL() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http")
+}
+
+// Listener returns a bitso.Websocket pointed at the fake server, extra options are applied after the endpoint
+func (s *WebsocketServer) Listener(options ...bitso.WebsocketOption) *bitso.Websocket {
+	return bitso.NewWebsocketListener(append([]bitso.WebsocketOption{bitso.WithEndpoint(s.URL())}, options...)...)
+}
+
+// Close drops every connection and stops the server
+func (s *WebsocketServer) Close() {
+	s.quitOnce.Do(func() {
+		close(s.quit)
+	})
+
+	s.DisconnectAll()
+	s.Server.Close()
+}
+
+// SetKeepAlive pauses or resumes the "ka" heartbeats, pausing them lets tests exercise stale connection detection
+func (s *WebsocketServer) SetKeepAlive(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keepAlive = enabled
+}
+
+// DisconnectAll abruptly closes every client connection
+func (s *WebsocketServer) DisconnectAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.conn.Close()
+		delete(s.conns, c)
+	}
+}
+
+// Connections returns the number of connected clients
+func (s *WebsocketServer) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// Subscribers returns how many connections are subscribed to a channel of a book
+func (s *WebsocketServer) Subscribers(book bitso.BookCode, channel bitso.Channel) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for c := range s.conns {
+		if c.subscriptions[bitso.HubFilter{Book: book, Channel: channel}] {
+			n++
+		}
+	}
+	return n
+}
+
+// PublishOrders sends an Orders message to every connection subscribed to the book's Orders channel
+func (s *WebsocketServer) PublishOrders(book bitso.BookCode, orders bitso.Orders) {
+	s.publish(book, bitso.Channel_ORDERS, 0, orders)
+}
+
+// PublishTrades sends a Trades message to every connection subscribed to the book's Trades channel
+func (s *WebsocketServer) PublishTrades(book bitso.BookCode, trades []bitso.Trade) {
+	s.publish(book, bitso.Channel_TRADES, 0, trades)
+}
+
+// PublishDiffOrders sends a Diff-Orders message to every connection subscribed to the book's Diff-Orders channel
+func (s *WebsocketServer) PublishDiffOrders(book bitso.BookCode, sequence int64, diffs []bitso.DiffOrder) {
+	s.publish(book, bitso.Channel_DIFF_ORDERS, sequence, diffs)
+}
+
+// PublishRaw sends an arbitrary frame to every connection, ex. to test malformed messages
+func (s *WebsocketServer) PublishRaw(frame []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		c.write(frame)
+	}
+}
+
+func (s *WebsocketServer) publish(book bitso.BookCode, channel bitso.Channel, sequence int64, payload interface{}) {
+	msg := map[string]interface{}{
+		"type": channel,
+		"book": book,
+		"payload": payload,
+	}
+	if sequence != 0 {
+		msg["sequence"] = sequence
+	}
+
+	frame, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.conns {
+		if c.subscriptions[bitso.HubFilter{Book: book, Channel: channel}] {
+			c.write(frame)
+		}
+	}
+}
+
+func (s *WebsocketServer) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	frame, _ := json.Marshal(map[string]interface{}{"type": bitso.Channel_KEEP_ALIVE})
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.keepAlive {
+				for c := range s.conns {
+					c.write(frame)
+				}
+			}
+			s.mu.Unlock()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+func (s *WebsocketServer) handle(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &fakeConn{
+		conn: conn,
+		subscriptions: make(map[bitso.HubFilter]bool),
+	}
+
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		req := bitso.SubscribeRequestMessage{}
+		if err := json.Unmarshal(message, &req); err != nil {
+			// the real server ignores anything it does not understand
+			continue
+		}
+
+		f := bitso.HubFilter{Book: req.Book, Channel: req.Channel}
+
+		s.mu.Lock()
+		switch req.Action {
+		case bitso.ActionType_SUBSCRIBE:
+			c.subscriptions[f] = true
+		case bitso.ActionType_UNSUBSCRIBE:
+			delete(c.subscriptions, f)
+		default:
+			s.mu.Unlock()
+			continue
+		}
+		s.mu.Unlock()
+
+		ack, _ := json.Marshal(bitso.SubscribeResponseMessage{
+			Action: req.Action,
+			Response: "ok",
+			Time: time.Now().UnixNano() / int64(time.Millisecond),
+			Channel: req.Channel,
+		})
+		c.write(ack)
+	}
+}
+
+func (c *fakeConn) write(frame []byte) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	c.conn.WriteMessage(websocket.TextMessage, frame)
+}
@@ -1,6 +1,10 @@
 package bitso
 
-import "github.com/shopspring/decimal"
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
 
 type BookCode string
 
@@ -50,4 +54,134 @@ func FindBookFromTwoCurrencies(books map[BookCode]Book, a, b CurrencyCode) (Book
 	}
 
 	return Book{}, false
-}
\ No newline at end of file
+}
+
+type OrderLimit string
+
+const (
+	OrderLimit_MINIMUM_AMOUNT 	OrderLimit = "minimum amount"
+	OrderLimit_MAXIMUM_AMOUNT 	OrderLimit = "maximum amount"
+	OrderLimit_MINIMUM_PRICE 	OrderLimit = "minimum price"
+	OrderLimit_MAXIMUM_PRICE 	OrderLimit = "maximum price"
+	OrderLimit_MINIMUM_VALUE 	OrderLimit = "minimum value"
+	OrderLimit_MAXIMUM_VALUE 	OrderLimit = "maximum value"
+)
+
+// OrderLimitError is returned by Book.ValidateOrder when an order breaks one of the book limits
+type OrderLimitError struct {
+	Book 	BookCode
+	Limit 	OrderLimit
+	Value 	decimal.Decimal // the offending amount, price or value, after rounding
+	Bound 	decimal.Decimal // the limit of the book
+}
+
+func (e OrderLimitError) Error() string {
+	switch e.Limit {
+	case OrderLimit_MINIMUM_AMOUNT, OrderLimit_MINIMUM_PRICE, OrderLimit_MINIMUM_VALUE:
+		if !e.Value.IsPositive() {
+			return fmt.Sprintf("%s: %s must be positive", e.Book, e.Limit[len("minimum "):])
+		}
+		return fmt.Sprintf("%s: %s is below the %s of %s", e.Book, e.Value, e.Limit, e.Bound)
+	default:
+		return fmt.Sprintf("%s: %s is above the %s of %s", e.Book, e.Value, e.Limit, e.Bound)
+	}
+}
+
+// RoundAmount truncates an amount to the precision of the major currency, so it never exceeds the given amount
+func (b Book) RoundAmount(amount decimal.Decimal) decimal.Decimal {
+	return amount.Truncate(int32(b.Major.Precision))
+}
+
+// RoundPrice rounds a price to the precision of the minor currency, down for buys and up for sells, so the order
+// never pays more or receives less than the given price
+func (b Book) RoundPrice(side Side, price decimal.Decimal) decimal.Decimal {
+	if side == Side_SELL {
+		return price.RoundCeil(int32(b.Minor.Precision))
+	}
+	return price.RoundFloor(int32(b.Minor.Precision))
+}
+
+// limitCheck is one of the book limits checked by ValidateOrder and ValidateMarketOrder
+type limitCheck struct {
+	limit 	OrderLimit
+	value 	decimal.Decimal
+	bound 	decimal.Decimal
+	broken 	bool
+}
+
+// check returns an OrderLimitError for the first broken limit
+func (b Book) check(checks []limitCheck) error {
+	for _, c := range checks {
+		if c.broken {
+			return OrderLimitError{Book: b.BookCode, Limit: c.limit, Value: c.value, Bound: c.bound}
+		}
+	}
+	return nil
+}
+
+// ValidateOrder rounds the price and amount of a limit order with RoundPrice and RoundAmount and checks the rounded
+// order against the limits of the book, returning an OrderLimitError for the first one broken. A zero maximum is
+// considered unlimited.
+func (b Book) ValidateOrder(side Side, price, amount decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	price = b.RoundPrice(side, price)
+	amount = b.RoundAmount(amount)
+	value := price.Mul(amount)
+
+	return price, amount, b.check([]limitCheck{
+		{OrderLimit_MINIMUM_AMOUNT, amount, b.MinimumAmount, !amount.IsPositive() || amount.LessThan(b.MinimumAmount)},
+		{OrderLimit_MAXIMUM_AMOUNT, amount, b.MaximumAmount, b.MaximumAmount.IsPositive() && amount.GreaterThan(b.MaximumAmount)},
+		{OrderLimit_MINIMUM_PRICE, price, b.MinimumPrice, !price.IsPositive() || price.LessThan(b.MinimumPrice)},
+		{OrderLimit_MAXIMUM_PRICE, price, b.MaximumPrice, b.MaximumPrice.IsPositive() && price.GreaterThan(b.MaximumPrice)},
+		{OrderLimit_MINIMUM_VALUE, value, b.MinimumValue, value.LessThan(b.MinimumValue)},
+		{OrderLimit_MAXIMUM_VALUE, value, b.MaximumValue, b.MaximumValue.IsPositive() && value.GreaterThan(b.MaximumValue)},
+	})
+}
+
+// ValidateMarketOrder rounds the major amount, or the minor amount when major is zero, of a market order and checks
+// it against the limits of the book like ValidateOrder. The amount not given is estimated by walking orders with
+// EstimateMarketOrder, when that side of the book is empty only the given amount is checked.
+func (b Book) ValidateMarketOrder(orders Orders, side Side, major, minor decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	major = b.RoundAmount(major)
+	minor = minor.Truncate(int32(b.Minor.Precision))
+
+	e := orders.EstimateMarketOrder(b, side, major, minor)
+	estimated := e.AveragePrice.IsPositive()
+
+	amount, value := major, minor
+	if major.IsPositive() {
+		minor = decimal.Zero
+		value = major.Mul(e.AveragePrice).Round(int32(b.Minor.Precision))
+	} else {
+		major = decimal.Zero
+		if estimated {
+			amount = b.RoundAmount(minor.Div(e.AveragePrice))
+		}
+	}
+
+	amountChecks := []limitCheck{
+		{OrderLimit_MINIMUM_AMOUNT, amount, b.MinimumAmount, amount.LessThan(b.MinimumAmount)},
+		{OrderLimit_MAXIMUM_AMOUNT, amount, b.MaximumAmount, b.MaximumAmount.IsPositive() && amount.GreaterThan(b.MaximumAmount)},
+	}
+	valueChecks := []limitCheck{
+		{OrderLimit_MINIMUM_VALUE, value, b.MinimumValue, value.LessThan(b.MinimumValue)},
+		{OrderLimit_MAXIMUM_VALUE, value, b.MaximumValue, b.MaximumValue.IsPositive() && value.GreaterThan(b.MaximumValue)},
+	}
+
+	// the given amount first, then the estimated one
+	checks := []limitCheck{
+		{OrderLimit_MINIMUM_AMOUNT, amount, b.MinimumAmount, !major.IsPositive() && !minor.IsPositive()},
+	}
+	if major.IsPositive() {
+		checks = append(checks, amountChecks...)
+		if estimated {
+			checks = append(checks, valueChecks...)
+		}
+	} else {
+		checks = append(checks, valueChecks...)
+		if estimated {
+			checks = append(checks, amountChecks...)
+		}
+	}
+
+	return major, minor, b.check(checks)
+}
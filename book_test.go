@@ -0,0 +1,126 @@
+package bitso
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func testBook() Book {
+	currencies := CurrencyList()
+
+	return Book{
+		BookCode: BookCode_BTC_MXN,
+		Major: currencies[CurrencyCode_BTC],
+		Minor: currencies[CurrencyCode_MXN],
+		MinimumAmount: decimal.RequireFromString("0.00001"),
+		MaximumAmount: decimal.RequireFromString("500"),
+		MinimumPrice: decimal.RequireFromString("1"),
+		MaximumPrice: decimal.RequireFromString("10000000"),
+		MinimumValue: decimal.RequireFromString("10"),
+		MaximumValue: decimal.RequireFromString("10000000"),
+	}
+}
+
+func TestBookValidateMarketOrder(t *testing.T) {
+	d := decimal.RequireFromString
+
+	orders := Orders{
+		Bids: []Offer{{Rate: d("899000"), Amount: d("1")}},
+		Asks: []Offer{{Rate: d("900000"), Amount: d("0.5")}, {Rate: d("910000"), Amount: d("1")}},
+	}
+
+	tests := []struct {
+		name 	string
+		orders 	Orders
+		side 	Side
+		major 	string
+		minor 	string
+		limit 	OrderLimit // empty when valid
+		rounded string // major, or minor when major is zero
+	}{
+		{"buy major", orders, Side_BUY, "0.1", "0", "", "0.1"},
+		{"major truncated", orders, Side_BUY, "0.123456789", "0", "", "0.12345678"},
+		{"major below minimum amount", orders, Side_BUY, "0.000005", "0", OrderLimit_MINIMUM_AMOUNT, ""},
+		{"major value below minimum", orders, Side_BUY, "0.00001", "0", OrderLimit_MINIMUM_VALUE, ""},
+		{"major value above maximum", orders, Side_BUY, "20", "0", OrderLimit_MAXIMUM_VALUE, ""},
+		{"major above maximum amount", orders, Side_SELL, "600", "0", OrderLimit_MAXIMUM_AMOUNT, ""},
+		{"buy minor", orders, Side_BUY, "0", "100", "", "100"},
+		{"minor below minimum value", orders, Side_BUY, "0", "5", OrderLimit_MINIMUM_VALUE, ""},
+		{"minor amount below minimum", Orders{Bids: []Offer{{Rate: d("2000000"), Amount: d("1")}}}, Side_SELL, "0", "10", OrderLimit_MINIMUM_AMOUNT, ""},
+		{"minor without book", Orders{}, Side_BUY, "0", "5", OrderLimit_MINIMUM_VALUE, ""},
+		{"major without book", Orders{}, Side_BUY, "0.1", "0", "", "0.1"},
+		{"no amount", orders, Side_BUY, "0", "0", OrderLimit_MINIMUM_AMOUNT, ""},
+	}
+
+	for _, tt := range tests {
+		major, minor, err := testBook().ValidateMarketOrder(tt.orders, tt.side, d(tt.major), d(tt.minor))
+
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			rounded := major
+			if major.IsZero() {
+				rounded = minor
+			}
+			if !rounded.Equal(d(tt.rounded)) {
+				t.Errorf("%s: rounded to %s, expecting %s", tt.name, rounded, tt.rounded)
+			}
+			continue
+		}
+
+		limitErr, ok := err.(OrderLimitError)
+		if !ok || limitErr.Limit != tt.limit {
+			t.Errorf("%s: received %v, expecting the %s limit", tt.name, err, tt.limit)
+		}
+	}
+}
+
+func TestBookValidateOrder(t *testing.T) {
+	d := decimal.RequireFromString
+
+	tests := []struct {
+		name 	string
+		side 	Side
+		price 	string
+		amount 	string
+		limit 	OrderLimit // empty when valid
+		rounded []string // price and amount
+	}{
+		{"valid", Side_BUY, "900000", "0.1", "", []string{"900000", "0.1"}},
+		{"buy price rounded down", Side_BUY, "900000.129", "0.1", "", []string{"900000.12", "0.1"}},
+		{"sell price rounded up", Side_SELL, "900000.121", "0.1", "", []string{"900000.13", "0.1"}},
+		{"amount truncated", Side_SELL, "900000", "0.123456789", "", []string{"900000", "0.12345678"}},
+		{"no amount", Side_BUY, "900000", "0", OrderLimit_MINIMUM_AMOUNT, nil},
+		{"amount truncated below minimum", Side_BUY, "900000", "0.000009999", OrderLimit_MINIMUM_AMOUNT, nil},
+		{"above maximum amount", Side_SELL, "1", "600", OrderLimit_MAXIMUM_AMOUNT, nil},
+		{"no price", Side_BUY, "0", "0.1", OrderLimit_MINIMUM_PRICE, nil},
+		{"buy price rounded below minimum", Side_BUY, "0.999", "20", OrderLimit_MINIMUM_PRICE, nil},
+		{"sell price rounded to minimum", Side_SELL, "0.999", "20", "", []string{"1", "20"}},
+		{"above maximum price", Side_SELL, "10000001", "0.00001", OrderLimit_MAXIMUM_PRICE, nil},
+		{"below minimum value", Side_BUY, "900000", "0.00001", OrderLimit_MINIMUM_VALUE, nil},
+		{"above maximum value", Side_BUY, "9000000", "2", OrderLimit_MAXIMUM_VALUE, nil},
+	}
+
+	for _, tt := range tests {
+		price, amount, err := testBook().ValidateOrder(tt.side, d(tt.price), d(tt.amount))
+
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if !price.Equal(d(tt.rounded[0])) || !amount.Equal(d(tt.rounded[1])) {
+				t.Errorf("%s: rounded to %s x %s, expecting %s x %s", tt.name, price, amount, tt.rounded[0], tt.rounded[1])
+			}
+			continue
+		}
+
+		limitErr, ok := err.(OrderLimitError)
+		if !ok || limitErr.Limit != tt.limit {
+			t.Errorf("%s: received %v, expecting the %s limit", tt.name, err, tt.limit)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package bitso
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	MIN_CANDLE_INTERVAL = time.Second
+	MAX_CANDLE_INTERVAL = 24 * time.Hour
+)
+
+// Candle is an OHLCV bar of a book. Bars are aligned to multiples of the interval since the zero time, so daily bars
+// start at midnight UTC.
+type Candle struct {
+	Book 		BookCode
+	Start 		time.Time
+	Interval 	time.Duration
+	Open 		decimal.Decimal // units: minor
+	High 		decimal.Decimal
+	Low 		decimal.Decimal
+	Close 		decimal.Decimal
+	Volume 		decimal.Decimal // units: major
+	Value 		decimal.Decimal // units: minor
+	VWAP 		decimal.Decimal // units: minor, value over volume
+	Trades 		int
+	Filled 		bool // a bar without trades, added to fill a gap, with every price set to the previous close
+}
+
+func (c Candle) End() time.Time {
+	return c.Start.Add(c.Interval)
+}
+
+// bar is a candle being built, with the times of its first and last trades to set the open and close of trades
+// received out of order
+type bar struct {
+	Candle
+	first 	time.Time
+	last 	time.Time
+}
+
+func (b *bar) add(t time.Time, price, amount decimal.Decimal) {
+	if b.Trades == 0 {
+		b.Open, b.High, b.Low, b.Close = price, price, price, price
+		b.first, b.last = t, t
+	} else {
+		if t.Before(b.first) {
+			b.Open = price
+			b.first = t
+		}
+		if !t.Before(b.last) {
+			b.Close = price
+			b.last = t
+		}
+		b.High = decimal.Max(b.High, price)
+		b.Low = decimal.Min(b.Low, price)
+	}
+
+	b.Trades++
+	b.Volume = b.Volume.Add(amount)
+	b.Value = b.Value.Add(amount.Mul(price))
+}
+
+// candleSeries are the bars of a book
+type candleSeries struct {
+	open 		map[int64]*bar // keyed by start, in unix nanos
+	emitted 	time.Time // start of the last emitted bar
+	lastClose 	decimal.Decimal
+	watermark 	time.Time // time of the newest trade
+}
+
+// CandleBuilder aggregates trades into candles per book. A bar is emitted once a trade newer than its end plus
+// the allowed lateness is received, or when Flush passes that time; trades for bars already emitted are dropped.
+type CandleBuilder struct {
+	interval 	time.Duration
+	lateness 	time.Duration
+	fillGaps 	bool
+
+	mu 			sync.Mutex
+	series 		map[BookCode]*candleSeries
+	late 		int
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(candle Candle)
+}
+
+// NewCandleBuilder returns a builder of bars of the given interval, between MIN_CANDLE_INTERVAL and
+// MAX_CANDLE_INTERVAL, accepting trades received up to lateness after the end of their bar. With fillGaps, intervals
+// without trades are emitted as Filled bars.
+func NewCandleBuilder(interval, lateness time.Duration, fillGaps bool) (*CandleBuilder, error) {
+	if interval < MIN_CANDLE_INTERVAL || interval > MAX_CANDLE_INTERVAL {
+		return nil, fmt.Errorf("candle interval must be between %s and %s, got %s", MIN_CANDLE_INTERVAL, MAX_CANDLE_INTERVAL, interval)
+	}
+	if lateness < 0 {
+		return nil, fmt.Errorf("candle lateness cannot be negative")
+	}
+
+	return &CandleBuilder{
+		interval: interval,
+		lateness: lateness,
+		fillGaps: fillGaps,
+		series: make(map[BookCode]*candleSeries),
+	}, nil
+}
+
+// OnCandle registers a handler called with every completed bar, in order per book as long as trades are added
+// from a single goroutine (ex. the websocket handlers)
+func (cb *CandleBuilder) OnCandle(handler func(candle Candle)) {
+	cb.handlersMu.Lock()
+	defer cb.handlersMu.Unlock()
+
+	cb.handlers = append(cb.handlers, handler)
+}
+
+// Attach builds candles from the Trades channel of a websocket, the caller still has to subscribe to it for every
+// book. Trades without a timestamp are taken at the time they are received.
+func (cb *CandleBuilder) Attach(ws *Websocket) {
+	ws.OnTrades(cb.AddTrades)
+}
+
+// AddTrades adds the trades of a Trades channel message
+func (cb *CandleBuilder) AddTrades(book BookCode, trades []Trade) {
+	now := time.Now()
+
+	for _, t := range trades {
+		at := now
+		if t.UnixMillis != 0 {
+			at = time.Unix(0, t.UnixMillis * int64(time.Millisecond))
+		}
+		cb.AddTrade(book, at, t.Rate, t.Amount)
+	}
+}
+
+// AddPublicTrades adds trades from the REST trade history (see Client.Trades), in any order
+func (cb *CandleBuilder) AddPublicTrades(trades []PublicTrade) {
+	sorted := make([]PublicTrade, len(trades))
+	copy(sorted, trades)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Tid < sorted[j].Tid })
+
+	for _, t := range sorted {
+		cb.AddTrade(t.Book, t.CreatedAt, t.Price, t.Amount)
+	}
+}
+
+// AddTrade adds a single trade, it returns false if its bar was already emitted
+func (cb *CandleBuilder) AddTrade(book BookCode, at time.Time, price, amount decimal.Decimal) bool {
+	cb.mu.Lock()
+
+	s, ok := cb.series[book]
+	if !ok {
+		s = &candleSeries{open: make(map[int64]*bar)}
+		cb.series[book] = s
+	}
+
+	start := at.Truncate(cb.interval)
+	if !s.emitted.IsZero() && !start.After(s.emitted) {
+		cb.late++
+		cb.mu.Unlock()
+		return false
+	}
+
+	b, ok := s.open[start.UnixNano()]
+	if !ok {
+		b = &bar{Candle: Candle{Book: book, Start: start, Interval: cb.interval}}
+		s.open[start.UnixNano()] = b
+	}
+	b.add(at, price, amount)
+
+	if at.After(s.watermark) {
+		s.watermark = at
+	}
+
+	candles := cb.complete(book, s, s.watermark, false)
+	cb.mu.Unlock()
+
+	cb.emit(candles)
+
+	return true
+}
+
+// Flush emits the bars of every book that are complete at the given time, ex. called on a ticker so bars are
+// emitted even when no trades arrive
+func (cb *CandleBuilder) Flush(until time.Time) {
+	cb.mu.Lock()
+
+	candles := make([]Candle, 0)
+	for book, s := range cb.series {
+		candles = append(candles, cb.complete(book, s, until, true)...)
+	}
+
+	cb.mu.Unlock()
+
+	cb.emit(candles)
+}
+
+// LateTrades returns how many trades were dropped because their bar was already emitted
+func (cb *CandleBuilder) LateTrades() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.late
+}
+
+// Current returns the bars of a book not emitted yet, oldest first
+func (cb *CandleBuilder) Current(book BookCode) []Candle {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	s, ok := cb.series[book]
+	if !ok {
+		return []Candle{}
+	}
+
+	candles := make([]Candle, 0, len(s.open))
+	for _, b := range s.open {
+		candles = append(candles, b.finish())
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Start.Before(candles[j].Start) })
+
+	return candles
+}
+
+func (b *bar) finish() Candle {
+	c := b.Candle
+	if c.Volume.IsPositive() {
+		c.VWAP = c.Value.Div(c.Volume)
+	}
+	return c
+}
+
+// complete removes and returns the bars ending, plus the lateness, at or before until. When idle is set the gaps
+// up to until are also filled, otherwise only the gaps between bars with trades. Must be called with the lock held.
+func (cb *CandleBuilder) complete(book BookCode, s *candleSeries, until time.Time, idle bool) []Candle {
+	starts := make([]int64, 0)
+	for start, b := range s.open {
+		if !b.End().Add(cb.lateness).After(until) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	candles := make([]Candle, 0, len(starts))
+	for _, start := range starts {
+		b := s.open[start]
+		delete(s.open, start)
+
+		candles = append(candles, cb.fill(book, s, b.Start)...)
+
+		c := b.finish()
+		candles = append(candles, c)
+		s.emitted = c.Start
+		s.lastClose = c.Close
+	}
+
+	if idle {
+		// fill up to the last interval complete at until, unless an open bar comes first
+		end := until.Add(-cb.lateness).Truncate(cb.interval)
+		for _, b := range s.open {
+			if b.Start.Before(end) {
+				end = b.Start
+			}
+		}
+		candles = append(candles, cb.fill(book, s, end)...)
+	}
+
+	return candles
+}
+
+// fill returns the Filled bars between the last emitted bar and before, and marks them as emitted. Must be called
+// with the lock held.
+func (cb *CandleBuilder) fill(book BookCode, s *candleSeries, before time.Time) []Candle {
+	candles := make([]Candle, 0)
+	if !cb.fillGaps || s.emitted.IsZero() {
+		return candles
+	}
+
+	for start := s.emitted.Add(cb.interval); start.Before(before); start = start.Add(cb.interval) {
+		candles = append(candles, Candle{
+			Book: book,
+			Start: start,
+			Interval: cb.interval,
+			Open: s.lastClose,
+			High: s.lastClose,
+			Low: s.lastClose,
+			Close: s.lastClose,
+			VWAP: s.lastClose,
+			Filled: true,
+		})
+		s.emitted = start
+	}
+
+	return candles
+}
+
+func (cb *CandleBuilder) emit(candles []Candle) {
+	if len(candles) == 0 {
+		return
+	}
+
+	cb.handlersMu.RLock()
+	handlers := make([]func(candle Candle), len(cb.handlers))
+	copy(handlers, cb.handlers)
+	cb.handlersMu.RUnlock()
+
+	for _, c := range candles {
+		for _, h := range handlers {
+			h(c)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package bitso_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+)
+
+func TestCandleBuilder(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	type trade struct {
+		second 	int
+		price 	string
+	}
+
+	tests := []struct {
+		name 		string
+		fillGaps 	bool
+		trades 		[]trade // of 1 btc each, flushed at the second when the price is empty
+		candles 	[]string // minute, open, high, low, close, volume and filled
+		late 		int
+	}{
+		{"out of order", false, []trade{{10, "100"}, {5, "90"}, {30, "110"}, {20, "95"}, {75, "120"}}, []string{
+			"0 90 110 90 110 4 false",
+		}, 0},
+		{"late within the lateness", false, []trade{{10, "100"}, {65, "105"}, {50, "98"}, {71, "106"}}, []string{
+			"0 100 100 98 98 2 false",
+		}, 0},
+		{"late past a closed bar", false, []trade{{10, "100"}, {75, "105"}, {55, "99"}, {140, ""}}, []string{
+			"0 100 100 100 100 1 false",
+			"1 105 105 105 105 1 false",
+		}, 1},
+		{"gaps filled", true, []trade{{10, "100"}, {200, "110"}, {250, ""}, {400, ""}}, []string{
+			"0 100 100 100 100 1 false",
+			"1 100 100 100 100 0 true",
+			"2 100 100 100 100 0 true",
+			"3 110 110 110 110 1 false",
+			"4 110 110 110 110 0 true",
+			"5 110 110 110 110 0 true",
+		}, 0},
+		{"gaps left", false, []trade{{10, "100"}, {200, "110"}, {250, ""}, {400, ""}}, []string{
+			"0 100 100 100 100 1 false",
+			"3 110 110 110 110 1 false",
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		cb, err := bitso.NewCandleBuilder(time.Minute, 10 * time.Second, tt.fillGaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		candles := make([]string, 0)
+		cb.OnCandle(func(c bitso.Candle) {
+			candles = append(candles, fmt.Sprintf("%d %s %s %s %s %s %t", int(c.Start.Sub(start) / time.Minute), c.Open, c.High, c.Low, c.Close, c.Volume, c.Filled))
+		})
+
+		for _, tr := range tt.trades {
+			at := start.Add(time.Duration(tr.second) * time.Second)
+			if tr.price == "" {
+				cb.Flush(at)
+				continue
+			}
+			cb.AddTrade(bitso.BookCode_BTC_MXN, at, d(tr.price), d("1"))
+		}
+
+		if fmt.Sprint(candles) != fmt.Sprint(tt.candles) {
+			t.Errorf("%s: emitted %v, expecting %v", tt.name, candles, tt.candles)
+		}
+		if cb.LateTrades() != tt.late {
+			t.Errorf("%s: %d late trades, expecting %d", tt.name, cb.LateTrades(), tt.late)
+		}
+	}
+}
+
+func TestCandleBuilderInterval(t *testing.T) {
+	for _, interval := range []time.Duration{time.Millisecond, 48 * time.Hour} {
+		if _, err := bitso.NewCandleBuilder(interval, 0, false); err == nil {
+			t.Errorf("expecting an error for an interval of %s", interval)
+		}
+	}
+	if _, err := bitso.NewCandleBuilder(time.Minute, -time.Second, false); err == nil {
+		t.Error("expecting an error for a negative lateness")
+	}
+}
+
+func TestCandleVWAP(t *testing.T) {
+	cb, err := bitso.NewCandleBuilder(time.Minute, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vwap string
+	cb.OnCandle(func(c bitso.Candle) {
+		vwap = c.VWAP.String()
+	})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cb.AddTrade(bitso.BookCode_BTC_MXN, start, d("100"), d("1"))
+	cb.AddTrade(bitso.BookCode_BTC_MXN, start.Add(time.Second), d("101"), d("2"))
+	cb.Flush(start.Add(time.Minute))
+
+	// not rounded to the precision of the major
+	if expected := d("302").Div(d("3")).String(); vwap != expected {
+		t.Errorf("VWAP %s, expecting %s", vwap, expected)
+	}
+}
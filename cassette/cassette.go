@@ -0,0 +1,282 @@
+// Package cassette records the REST requests of a bitso.Client into a file and replays them later, so tests of
+// the Client methods run offline and deterministically. Authorization headers and any given secrets are redacted
+// before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+const REDACTED = "REDACTED"
+
+// headers that always carry credentials
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+type Request struct {
+	Method 	string 		`json:"method"`
+	URL 	string 		`json:"url"` // path and query, the host is not recorded
+	Header 	http.Header `json:"header"`
+	Body 	string 		`json:"body"`
+}
+
+type Response struct {
+	StatusCode 	int 		`json:"status_code"`
+	Header 		http.Header `json:"header"`
+	Body 		string 		`json:"body"`
+}
+
+type Interaction struct {
+	Request 	Request 	`json:"request"`
+	Response 	Response 	`json:"response"`
+}
+
+// Cassette is the file format, a list of interactions in the order they happened
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// redactor replaces every occurrence of its secrets by REDACTED, empty ones are ignored
+type redactor []string
+
+func newRedactor(secrets []string) redactor {
+	r := make(redactor, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			r = append(r, secret)
+		}
+	}
+	return r
+}
+
+func (r redactor) redact(s string) string {
+	for _, secret := range r {
+		s = strings.Replace(s, secret, REDACTED, -1)
+	}
+	return s
+}
+
+// Recorder is an http.RoundTripper that performs the requests through the next RoundTripper and records them
+type Recorder struct {
+	next 	http.RoundTripper
+	secrets redactor
+
+	mu 			sync.Mutex
+	cassette 	Cassette
+}
+
+// NewRecorder returns a Recorder sending the requests through next (http.DefaultTransport when nil). Every
+// occurrence of the given secrets (ex. the API key and secret) is replaced by REDACTED in the recording.
+func NewRecorder(next http.RoundTripper, secrets ...string) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{
+		next: next,
+		secrets: newRedactor(secrets),
+	}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL: r.secrets.redact(req.URL.RequestURI()),
+			Header: r.redactHeader(req.Header),
+			Body: r.secrets.redact(string(reqBody)),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header: r.redactHeader(resp.Header),
+			Body: r.secrets.redact(string(respBody)),
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	out := make(http.Header)
+	for k, values := range h {
+		for _, v := range values {
+			out.Add(k, r.secrets.redact(v))
+		}
+	}
+
+	for _, k := range sensitiveHeaders {
+		if out.Get(k) != "" {
+			out.Set(k, REDACTED)
+		}
+	}
+
+	return out
+}
+
+// Cassette returns a copy of everything recorded so far
+func (r *Recorder) Cassette() Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := Cassette{Interactions: make([]Interaction, len(r.cassette.Interactions))}
+	copy(c.Interactions, r.cassette.Interactions)
+	return c
+}
+
+// Save writes the recording to a JSON file
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Cassette(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Replayer is an http.RoundTripper that answers requests from a recording without touching the network. Each
+// interaction is used once, in order, matching the method, path, query and body of the request once redacted like
+// the recording.
+type Replayer struct {
+	secrets redactor
+
+	mu 		sync.Mutex
+	pending []Interaction
+}
+
+// NewReplayer returns a Replayer for an in-memory cassette, the secrets must be the ones given to the Recorder so
+// the requests that contained them still match
+func NewReplayer(c Cassette, secrets ...string) *Replayer {
+	pending := make([]Interaction, len(c.Interactions))
+	copy(pending, c.Interactions)
+
+	return &Replayer{secrets: newRedactor(secrets), pending: pending}
+}
+
+// Load reads a cassette file written by Recorder.Save, see NewReplayer for the secrets
+func Load(path string, secrets ...string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Cassette{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %v", path, err)
+	}
+
+	return NewReplayer(c, secrets...), nil
+}
+
+func (rp *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uri := rp.secrets.redact(req.URL.RequestURI())
+	redactedBody := rp.secrets.redact(string(body))
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for i, it := range rp.pending {
+		if it.Request.Method != req.Method || it.Request.URL != uri || it.Request.Body != redactedBody {
+			continue
+		}
+
+		rp.pending = append(rp.pending[:i], rp.pending[i + 1:]...)
+
+		// the caller may modify the header, it must not share its values with the cassette
+		header := make(http.Header)
+		for k, v := range it.Response.Header {
+			header[k] = append([]string(nil), v...)
+		}
+
+		return &http.Response{
+			Status: fmt.Sprintf("%d %s", it.Response.StatusCode, http.StatusText(it.Response.StatusCode)),
+			StatusCode: it.Response.StatusCode,
+			Proto: "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header: header,
+			Body: ioutil.NopCloser(strings.NewReader(it.Response.Body)),
+			ContentLength: int64(len(it.Response.Body)),
+			Request: req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("cassette: no recorded interaction for %s %s", req.Method, uri)
+}
+
+// Remaining returns how many recorded interactions were not replayed yet
+func (rp *Replayer) Remaining() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	return len(rp.pending)
+}
+
+// HTTPClient wraps a RoundTripper in an http.Client, to be used with bitso.Client.SetHTTPClient
+func HTTPClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{Transport: transport}
+}
+
+// exists reports whether a cassette file was already recorded
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Use replays the cassette at path if it exists, otherwise it records through next and returns a save function
+// that must be called once the test is done. It makes it easy to record a cassette once against the real API
+// and replay it from then on.
+func Use(path string, next http.RoundTripper, secrets ...string) (transport http.RoundTripper, save func() error, err error) {
+	if exists(path) {
+		rp, err := Load(path, secrets...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return rp, func() error { return nil }, nil
+	}
+
+	rec := NewRecorder(next, secrets...)
+	return rec, func() error { return rec.Save(path) }, nil
+}
@@ -0,0 +1,113 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+	"github.com/shopspring/decimal"
+)
+
+func TestRecordReplay(t *testing.T) {
+	server := bitsotest.NewServer()
+	server.SetTicker("btc_mxn", decimal.RequireFromString("900000"), decimal.RequireFromString("901000"), decimal.RequireFromString("900500"))
+	server.SetBalance(bitso.CurrencyCode_MXN, decimal.RequireFromString("1000"), decimal.Zero)
+
+	// any part of a request can be a secret, here the book of the ticker
+	secrets := []string{server.Key, server.Secret, "btc_mxn"}
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	transport, save, err := Use(path, nil, secrets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := transport.(*Recorder); !ok {
+		t.Fatalf("received a %T for a new cassette, expecting a *Recorder", transport)
+	}
+
+	client := server.Client()
+	client.SetHTTPClient(HTTPClient(transport))
+
+	recordedTicker, err := client.Ticker("btc_mxn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordedBalances, err := client.AccountBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := save(); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the cassette contains the secret %q", secret)
+		}
+	}
+
+	// the server is gone, everything comes from the cassette
+	transport, _, err = Use(path, nil, secrets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer, ok := transport.(*Replayer)
+	if !ok {
+		t.Fatalf("received a %T for a recorded cassette, expecting a *Replayer", transport)
+	}
+
+	client.SetHTTPClient(HTTPClient(replayer))
+
+	ticker, err := client.Ticker("btc_mxn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ticker.Bid.Equal(recordedTicker.Bid) || !ticker.Ask.Equal(recordedTicker.Ask) {
+		t.Errorf("replayed ticker %v, expecting %v", ticker, recordedTicker)
+	}
+
+	balances, err := client.AccountBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !balances[bitso.CurrencyCode_MXN].Available.Equal(recordedBalances[bitso.CurrencyCode_MXN].Available) {
+		t.Errorf("replayed balances %v, expecting %v", balances, recordedBalances)
+	}
+
+	if n := replayer.Remaining(); n != 0 {
+		t.Errorf("%d interactions were not replayed", n)
+	}
+
+	// each interaction is used once
+	if _, err := client.Ticker("btc_mxn"); err == nil {
+		t.Error("expecting an error for a request that was not recorded")
+	}
+}
+
+func TestReplayedHeadersAreCopies(t *testing.T) {
+	recorded := http.Header{"X-Test": {"recorded"}}
+	rp := NewReplayer(Cassette{Interactions: []Interaction{
+		{Request: Request{Method: "GET", URL: "/a"}, Response: Response{StatusCode: 200, Header: recorded}},
+	}})
+
+	req, _ := http.NewRequest("GET", "http://localhost/a", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Header["X-Test"][0] = "modified"
+
+	if v := recorded["X-Test"][0]; v != "recorded" {
+		t.Errorf("the cassette header is %q after modifying a replayed response, expecting recorded", v)
+	}
+}
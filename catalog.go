@@ -0,0 +1,206 @@
+package bitso
+
+import (
+	"sync"
+	"time"
+)
+
+// CatalogChange lists what a Catalog refresh found different from the previous one
+type CatalogChange struct {
+	Listed 				[]Book
+	Delisted 			[]Book
+	ListedCurrencies 	[]Currency
+}
+
+func (c CatalogChange) IsEmpty() bool {
+	return len(c.Listed) == 0 && len(c.Delisted) == 0 && len(c.ListedCurrencies) == 0
+}
+
+// Catalog keeps the books and currencies listed by Bitso, loaded at runtime instead of relying on the BookCode and
+// CurrencyCode constants. Currencies missing from CurrencyList are taken from the catalogue endpoint when it's
+// available, or else inferred from the book limits; once known, a currency keeps its precision.
+type Catalog struct {
+	client 		*Client
+
+	refreshMu 	sync.Mutex // one refresh at a time, so an older one never replaces a newer one
+	mu 			sync.RWMutex
+	books 		map[BookCode]Book
+	currencies 	map[CurrencyCode]Currency
+	loaded 		bool
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(change CatalogChange)
+
+	quit 		chan bool
+	quitOnce 	sync.Once
+}
+
+// NewCatalog returns an empty catalog, Refresh or Start must be called to load it
+func NewCatalog(client *Client) *Catalog {
+	return &Catalog{
+		client: client,
+		books: make(map[BookCode]Book),
+		currencies: CurrencyList(),
+		quit: make(chan bool),
+	}
+}
+
+// OnChange registers a handler called when a refresh, other than the first one, lists or delists something
+func (c *Catalog) OnChange(handler func(change CatalogChange)) {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+
+	c.handlers = append(c.handlers, handler)
+}
+
+// Refresh reloads the books and currencies and returns what changed. Concurrent refreshes wait for each other.
+func (c *Catalog) Refresh() (CatalogChange, error) {
+	c.refreshMu.Lock()
+	change, first, err := c.refresh()
+	c.refreshMu.Unlock()
+
+	if err != nil || first || change.IsEmpty() {
+		return change, err
+	}
+
+	c.client.logger.Log(LogLevel_INFO, "catalog changed", Field("listed", len(change.Listed)), Field("delisted", len(change.Delisted)))
+
+	c.handlersMu.RLock()
+	handlers := make([]func(change CatalogChange), len(c.handlers))
+	copy(handlers, c.handlers)
+	c.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(change)
+	}
+
+	return change, nil
+}
+
+// refresh loads and installs the catalog, reporting whether it was the first load. Must be called with the refresh
+// lock held.
+func (c *Catalog) refresh() (CatalogChange, bool, error) {
+	c.mu.RLock()
+	currencies := make(map[CurrencyCode]Currency, len(c.currencies))
+	for code, currency := range c.currencies {
+		currencies[code] = currency
+	}
+	c.mu.RUnlock()
+
+	// the catalogue is optional, the currencies are inferred from the books without it
+	catalogue, err := c.client.catalogue(true)
+	if err != nil {
+		c.client.logger.Log(LogLevel_DEBUG, "catalogue not available", Field("error", err))
+	}
+	for code, currency := range catalogue {
+		if _, known := currencies[code]; !known {
+			currencies[code] = currency
+		}
+	}
+
+	books, err := c.client.availableBooks(currencies)
+	if err != nil {
+		return CatalogChange{}, false, err
+	}
+
+	c.mu.Lock()
+
+	change := CatalogChange{}
+	for code, book := range books {
+		if _, ok := c.books[code]; !ok {
+			change.Listed = append(change.Listed, book)
+		}
+	}
+	for code, book := range c.books {
+		if _, ok := books[code]; !ok {
+			change.Delisted = append(change.Delisted, book)
+		}
+	}
+	for code, currency := range currencies {
+		if _, ok := c.currencies[code]; !ok {
+			change.ListedCurrencies = append(change.ListedCurrencies, currency)
+		}
+	}
+
+	first := !c.loaded
+	c.loaded = true
+	c.books = books
+	c.currencies = currencies
+
+	c.mu.Unlock()
+
+	return change, first, nil
+}
+
+// Start loads the catalog and then refreshes it every interval until Stop is called. Errors of the periodic
+// refreshes are logged and the previous catalog is kept.
+func (c *Catalog) Start(interval time.Duration) error {
+	if _, err := c.Refresh(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := c.Refresh(); err != nil {
+					c.client.logger.Log(LogLevel_WARN, "catalog refresh failed", Field("error", err))
+				}
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop ends the periodic refreshes
+func (c *Catalog) Stop() {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+// Books returns a copy of the listed books
+func (c *Catalog) Books() map[BookCode]Book {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	books := make(map[BookCode]Book, len(c.books))
+	for code, book := range c.books {
+		books[code] = book
+	}
+	return books
+}
+
+func (c *Catalog) Book(code BookCode) (Book, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	book, ok := c.books[code]
+	return book, ok
+}
+
+// Currencies returns a copy of the known currencies, including those of CurrencyList not listed anymore
+func (c *Catalog) Currencies() map[CurrencyCode]Currency {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	currencies := make(map[CurrencyCode]Currency, len(c.currencies))
+	for code, currency := range c.currencies {
+		currencies[code] = currency
+	}
+	return currencies
+}
+
+func (c *Catalog) Currency(code CurrencyCode) (Currency, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	currency, ok := c.currencies[code]
+	return currency, ok
+}
@@ -0,0 +1,159 @@
+package bitso_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+// recordingLogger keeps every entry logged
+type recordingLogger struct {
+	mu 		sync.Mutex
+	levels 	[]bitso.LogLevel
+	msgs 	[]string
+}
+
+func (l *recordingLogger) Log(level bitso.LogLevel, msg string, fields ...bitso.LogField) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.levels = append(l.levels, level)
+	l.msgs = append(l.msgs, msg)
+}
+
+// withoutCatalogue answers the catalogue endpoint as a deployment that does not serve it
+type withoutCatalogue struct{}
+
+func (withoutCatalogue) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Path != "/v3/catalogues/" {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body: ioutil.NopCloser(strings.NewReader(`{"success": false, "error": {"code": "0101", "message": "not found"}}`)),
+		Request: r,
+	}, nil
+}
+
+func TestCatalogWithoutCatalogueLogsNothing(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	client := server.Client()
+	client.SetHTTPClient(&http.Client{Transport: withoutCatalogue{}})
+	client.SetLogger(logger)
+
+	catalog := bitso.NewCatalog(client)
+	if _, err := catalog.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if books := catalog.Books(); len(books) != 5 {
+		t.Errorf("%d books loaded, expecting 5", len(books))
+	}
+
+	for i, level := range logger.levels {
+		if level > bitso.LogLevel_DEBUG {
+			t.Errorf("%q logged at %s, expecting only DEBUG entries", logger.msgs[i], level)
+		}
+	}
+}
+
+func TestCatalogueFailuresAreLoggedOutsideTheCatalog(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	logger := &recordingLogger{}
+	client := server.Client()
+	client.SetHTTPClient(&http.Client{Transport: withoutCatalogue{}})
+	client.SetLogger(logger)
+
+	if _, err := client.Catalogue(); err == nil {
+		t.Fatal("catalogue loaded, expecting an error")
+	}
+
+	for _, level := range logger.levels {
+		if level > bitso.LogLevel_DEBUG {
+			return
+		}
+	}
+	t.Errorf("levels %v logged, expecting the failure above DEBUG", logger.levels)
+}
+
+// heldBooks holds the first available_books response until released
+type heldBooks struct {
+	mu 			sync.Mutex
+	requests 	int
+	held 		chan struct{}
+	release 	chan struct{}
+}
+
+func (h *heldBooks) RoundTrip(r *http.Request) (*http.Response, error) {
+	response, err := withoutCatalogue{}.RoundTrip(r)
+	if r.URL.Path != "/v3/available_books/" {
+		return response, err
+	}
+
+	h.mu.Lock()
+	h.requests++
+	first := h.requests == 1
+	h.mu.Unlock()
+
+	if first {
+		close(h.held)
+		<-h.release
+	}
+	return response, err
+}
+
+func TestCatalogConcurrentRefreshes(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	transport := &heldBooks{held: make(chan struct{}), release: make(chan struct{})}
+	client := server.Client()
+	client.SetHTTPClient(&http.Client{Transport: transport})
+	client.SetLogger(bitso.NopLogger())
+
+	catalog := bitso.NewCatalog(client)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		catalog.Refresh()
+	}()
+	<-transport.held
+
+	// the second refresh sees the newer books
+	server.SetBooks([]bitso.PublicAvailableBooksPayload{{Book: "btc_mxn", MinimumAmount: d("0.001"), MaximumAmount: d("100"),
+		MinimumPrice: d("1"), MaximumPrice: d("10000000"), MinimumValue: d("10"), MaximumValue: d("10000000")}})
+	second := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		catalog.Refresh()
+		close(second)
+	}()
+
+	select {
+	case <-second:
+		t.Error("second refresh done before the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(transport.release)
+	wg.Wait()
+
+	if books := catalog.Books(); len(books) != 1 {
+		t.Errorf("%d books loaded, expecting the 1 of the latest refresh", len(books))
+	}
+}
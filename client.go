@@ -2,16 +2,25 @@ package bitso
 
 import (
 	"net/http"
+	"sync"
 	"time"
 )
 
 type Client struct {
+	endpoint string
+
 	// Private API
 	key 	string
 	secret 	string
 
+	lastNonce 	int64
+	nonceMu 	sync.Mutex
+
 	// HTTP Client
 	httpClient *http.Client
+
+	logger 	Logger
+	metrics Metrics
 }
 
 func NewClient() *Client {
@@ -26,7 +35,10 @@ func NewClient() *Client {
 	}
 
 	return &Client{
+		endpoint: API_ENDPOINT,
 		httpClient: httpClient,
+		logger: NopLogger(),
+		metrics: NopMetrics(),
 	}
 }
 
@@ -35,3 +47,23 @@ func (client *Client) SetPrivateKey(key, secret string) {
 	client.secret = secret
 }
 
+// SetAPIEndpoint changes the base URL of the REST API, defaults to API_ENDPOINT
+func (client *Client) SetAPIEndpoint(endpoint string) {
+	client.endpoint = endpoint
+}
+
+// SetHTTPClient replaces the HTTP client used for the REST requests, ex. to use a custom Transport
+func (client *Client) SetHTTPClient(httpClient *http.Client) {
+	client.httpClient = httpClient
+}
+
+// SetLogger sets the Logger used for the REST requests, nothing is logged by default. Use NewStdLogger to log
+// through the standard log package.
+func (client *Client) SetLogger(logger Logger) {
+	client.logger = logger
+}
+
+// SetMetrics sets the instrumentation hooks called after every REST request
+func (client *Client) SetMetrics(metrics Metrics) {
+	client.metrics = metrics
+}
@@ -0,0 +1,259 @@
+package bitso_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+func TestClientPublic(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	server.SetTicker("btc_mxn", d("900000"), d("901000"), d("900500"))
+	server.SetOrderBook("btc_mxn", bitso.Orders{
+		Bids: []bitso.Offer{{Rate: d("900000"), Amount: d("0.5")}},
+		Asks: []bitso.Offer{{Rate: d("901000"), Amount: d("0.2")}, {Rate: d("902000"), Amount: d("1")}},
+	}, 42)
+	for i := 0; i < 5; i++ {
+		server.AddTrade("btc_mxn", bitso.Side_SELL, d("0.1"), d("900000"), time.Now())
+	}
+
+	client := server.Client()
+
+	tests := []struct {
+		name 	string
+		call 	func() error
+	}{
+		{"available books", func() error {
+			books, err := client.AvailableBooks()
+			if err == nil && len(books) != 5 {
+				t.Errorf("received %d books, expecting 5", len(books))
+			}
+			return err
+		}},
+		{"ticker", func() error {
+			ticker, err := client.Ticker("btc_mxn")
+			if err == nil && (!ticker.Bid.Equal(d("900000")) || !ticker.Ask.Equal(d("901000"))) {
+				t.Errorf("ticker is %s/%s, expecting 900000/901000", ticker.Bid, ticker.Ask)
+			}
+			return err
+		}},
+		{"order book", func() error {
+			orders, sequence, err := client.OrderBook("btc_mxn", true)
+			if err == nil && (sequence != 42 || len(orders.Bids) != 1 || len(orders.Asks) != 2) {
+				t.Errorf("order book has sequence %d, %d bids and %d asks, expecting 42, 1 and 2", sequence, len(orders.Bids), len(orders.Asks))
+			}
+			return err
+		}},
+		{"trades page", func() error {
+			trades, err := client.Trades("btc_mxn", 4, 2)
+			if err == nil && (len(trades) != 2 || trades[0].Tid != 3 || trades[1].Tid != 2) {
+				t.Errorf("received %v, expecting trades 3 and 2", trades)
+			}
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestClientSignature(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	tests := []struct {
+		name 	string
+		key 	string
+		secret 	string
+		code 	string // expected ApiError code, empty for success
+	}{
+		{"valid credentials", server.Key, server.Secret, ""},
+		{"wrong secret", server.Key, "not-the-secret", bitsotest.ErrorCode_INVALID_SIGNATURE},
+		{"unknown key", "not-the-key", server.Secret, bitsotest.ErrorCode_INVALID_SIGNATURE},
+	}
+
+	for _, tt := range tests {
+		client := server.Client()
+		client.SetPrivateKey(tt.key, tt.secret)
+
+		_, err := client.AccountBalance()
+		if tt.code == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+
+		apiErr, ok := err.(bitso.ApiError)
+		if !ok || apiErr.Code != tt.code {
+			t.Errorf("%s: received %v, expecting error code %s", tt.name, err, tt.code)
+		}
+	}
+
+	// private calls without credentials never reach the server
+	client := server.Client()
+	client.SetPrivateKey("", "")
+	if _, err := client.AccountBalance(); err == nil {
+		t.Error("expecting an error without credentials")
+	} else if _, ok := err.(bitso.HTTPError); !ok {
+		t.Errorf("received %T, expecting a bitso.HTTPError", err)
+	}
+}
+
+func TestClientOrders(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	client := server.Client()
+
+	oid, err := client.PlaceOrder(bitso.OrderRequest{
+		Book: "btc_mxn",
+		Side: bitso.Side_BUY,
+		Type: bitso.OrderType_LIMIT,
+		Major: d("0.5"),
+		Price: d("900000"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.FillOrder(oid, d("0.2")); err != nil {
+		t.Fatal(err)
+	}
+
+	orders, err := client.LookupOrders(oid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 1 || orders[0].Status != bitso.OrderStatus_PARTIALLY_FILLED || !orders[0].UnfilledAmount.Equal(d("0.3")) {
+		t.Errorf("received %v, expecting a partially filled order with 0.3 unfilled", orders)
+	}
+
+	trades, err := client.UserTrades("btc_mxn", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trades) != 1 || trades[0].Oid != oid || !trades[0].Major.Equal(d("0.2")) || !trades[0].Minor.Equal(d("-180000")) {
+		t.Errorf("received %v, expecting one fill of 0.2 for -180000", trades)
+	}
+
+	if err := client.CancelOrder(oid); err != nil {
+		t.Fatal(err)
+	}
+
+	open, err := client.OpenOrders("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(open) != 0 {
+		t.Errorf("%d open orders after the cancellation, expecting none", len(open))
+	}
+
+	if err := client.CancelOrder(oid); err == nil {
+		t.Error("expecting an error cancelling a cancelled order")
+	} else if apiErr, ok := err.(bitso.ApiError); !ok || apiErr.Code != bitsotest.ErrorCode_ORDER_NOT_FOUND {
+		t.Errorf("received %v, expecting error code %s", err, bitsotest.ErrorCode_ORDER_NOT_FOUND)
+	}
+}
+
+func TestWebsocketHandlers(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(50 * time.Millisecond)
+	defer server.Close()
+
+	ws := quietListener(server)
+
+	trades := make(chan bitso.BookCode, 10)
+	orders := make(chan bitso.BookCode, 10)
+	diffs := make(chan int64, 10)
+	disconnected := make(chan bool, 1)
+
+	ws.OnTrades(func(book bitso.BookCode, _ []bitso.Trade) { trades <- book }, "btc_mxn")
+	ws.OnOrders(func(book bitso.BookCode, _ bitso.Orders) { orders <- book })
+	ws.OnDiffOrders(func(_ bitso.BookCode, sequence int64, _ []bitso.DiffOrder) { diffs <- sequence })
+	ws.OnDisconnect(func() { disconnected <- true })
+
+	if _, err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	subscriptions := []bitso.HubFilter{
+		{Book: "btc_mxn", Channel: bitso.Channel_TRADES},
+		{Book: "eth_mxn", Channel: bitso.Channel_TRADES},
+		{Book: "eth_mxn", Channel: bitso.Channel_ORDERS},
+		{Book: "btc_mxn", Channel: bitso.Channel_DIFF_ORDERS},
+	}
+	for _, s := range subscriptions {
+		if err := ws.Subscribe(s.Book, s.Channel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually(t, "the subscriptions", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_DIFF_ORDERS) == 1
+	})
+
+	go ws.Listen()
+
+	// the trades handler only wants btc_mxn
+	server.PublishTrades("eth_mxn", []bitso.Trade{{Folio: 1, Amount: d("1"), Rate: d("50000")}})
+	server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: 2, Amount: d("0.1"), Rate: d("900000")}})
+	server.PublishOrders("eth_mxn", bitso.Orders{Bids: []bitso.Offer{{Rate: d("50000"), Amount: d("1")}}})
+	server.PublishDiffOrders("btc_mxn", 7, []bitso.DiffOrder{{Rate: d("900000"), Amount: d("0.1"), OrderId: "o1"}})
+
+	select {
+	case book := <-trades:
+		if book != "btc_mxn" {
+			t.Errorf("trades handler received %s, expecting btc_mxn", book)
+		}
+	case <-time.After(time.Second):
+		t.Error("trades handler not called")
+	}
+	select {
+	case book := <-orders:
+		if book != "eth_mxn" {
+			t.Errorf("orders handler received %s, expecting eth_mxn", book)
+		}
+	case <-time.After(time.Second):
+		t.Error("orders handler not called")
+	}
+	select {
+	case sequence := <-diffs:
+		if sequence != 7 {
+			t.Errorf("diff-orders handler received sequence %d, expecting 7", sequence)
+		}
+	case <-time.After(time.Second):
+		t.Error("diff-orders handler not called")
+	}
+
+	ws.Disconnect()
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Error("disconnect handler not called")
+	}
+
+	if len(trades) != 0 {
+		t.Errorf("trades handler called %d more times, expecting only btc_mxn", len(trades))
+	}
+}
+
+// Bitso rejects a nonce that is not greater than the previous one, private calls made within the same millisecond
+// must still get increasing nonces
+func TestClientNonceIncreases(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	client := server.Client()
+
+	for i := 0; i < 50; i++ {
+		if _, err := client.AccountBalance(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+}
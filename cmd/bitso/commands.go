@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+const TIME_FORMAT = "2006-01-02 15:04:05"
+
+func parseSide(s string) (bitso.Side, error) {
+	switch strings.ToLower(s) {
+	case "buy":
+		return bitso.Side_BUY, nil
+	case "sell":
+		return bitso.Side_SELL, nil
+	}
+	return bitso.Side_BUY, fmt.Errorf("invalid side %q, expecting buy or sell", s)
+}
+
+func sideString(side bitso.Side) string {
+	return strings.ToLower(side.String())
+}
+
+func sortedBooks(books map[bitso.BookCode]bitso.Book) []bitso.Book {
+	sorted := make([]bitso.Book, 0, len(books))
+	for _, b := range books {
+		sorted = append(sorted, b)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].BookCode < sorted[j].BookCode })
+	return sorted
+}
+
+func runBooks(a *app, args []string) error {
+	if len(args) != 0 {
+		return usageError{commands["books"].usage}
+	}
+
+	books, err := a.client.AvailableBooks()
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(books))
+	for _, b := range sortedBooks(books) {
+		rows = append(rows, []string{
+			string(b.BookCode),
+			b.MinimumAmount.String(), b.MaximumAmount.String(),
+			b.MinimumPrice.String(), b.MaximumPrice.String(),
+			b.MinimumValue.String(), b.MaximumValue.String(),
+		})
+	}
+
+	return a.out.table([]string{"BOOK", "MIN_AMOUNT", "MAX_AMOUNT", "MIN_PRICE", "MAX_PRICE", "MIN_VALUE", "MAX_VALUE"}, rows)
+}
+
+func runTicker(a *app, args []string) error {
+	tickers, err := a.client.Tickers()
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[bitso.BookCode]bool)
+	for _, arg := range args {
+		wanted[bitso.BookCode(arg)] = true
+	}
+
+	sort.Slice(tickers, func(i, j int) bool { return tickers[i].Book < tickers[j].Book })
+
+	rows := make([][]string, 0, len(tickers))
+	for _, t := range tickers {
+		if len(wanted) > 0 && !wanted[t.Book] {
+			continue
+		}
+		delete(wanted, t.Book)
+
+		rows = append(rows, []string{
+			string(t.Book),
+			t.Bid.String(), t.Ask.String(), t.Last.String(),
+			t.High.String(), t.Low.String(), t.Volume.String(), t.Vwap.String(),
+		})
+	}
+
+	for book := range wanted {
+		return fmt.Errorf("no ticker for book %s", book)
+	}
+
+	return a.out.table([]string{"BOOK", "BID", "ASK", "LAST", "HIGH", "LOW", "VOLUME", "VWAP"}, rows)
+}
+
+func runOrderBook(a *app, args []string) error {
+	fs := newFlagSet("orderbook")
+	depth := fs.Int("depth", 10, "offers shown on each side, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError{commands["orderbook"].usage}
+	}
+
+	orders, _, err := a.client.OrderBook(bitso.BookCode(fs.Arg(0)), true)
+	if err != nil {
+		return err
+	}
+
+	bids, asks := orders.Bids, orders.Asks
+	if *depth > 0 {
+		if len(bids) > *depth {
+			bids = bids[:*depth]
+		}
+		if len(asks) > *depth {
+			asks = asks[:*depth]
+		}
+	}
+
+	// asks from the worst down to the best, then bids from the best down, as the book is usually drawn
+	rows := make([][]string, 0, len(bids) + len(asks))
+	for i := len(asks) - 1; i >= 0; i-- {
+		rows = append(rows, []string{"ask", asks[i].Rate.String(), asks[i].Amount.String(), asks[i].Value.String()})
+	}
+	for _, o := range bids {
+		rows = append(rows, []string{"bid", o.Rate.String(), o.Amount.String(), o.Value.String()})
+	}
+
+	return a.out.table([]string{"SIDE", "PRICE", "AMOUNT", "VALUE"}, rows)
+}
+
+func runTrades(a *app, args []string) error {
+	fs := newFlagSet("trades")
+	rest := fs.Bool("rest", false, "list the latest trades instead of tailing the websocket")
+	limit := fs.Int("limit", 25, "trades listed with -rest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError{commands["trades"].usage}
+	}
+	book := bitso.BookCode(fs.Arg(0))
+
+	headers := []string{"TIME", "BOOK", "MAKER_SIDE", "AMOUNT", "PRICE", "VALUE"}
+
+	if *rest {
+		trades, err := a.client.Trades(book, 0, *limit)
+		if err != nil {
+			return err
+		}
+
+		rows := make([][]string, 0, len(trades))
+		for _, t := range trades {
+			rows = append(rows, []string{
+				t.CreatedAt.Local().Format(TIME_FORMAT), string(t.Book), sideString(t.MakerSide),
+				t.Amount.String(), t.Price.String(), t.Amount.Mul(t.Price).String(),
+			})
+		}
+		return a.out.table(headers, rows)
+	}
+
+	options := []bitso.WebsocketOption{bitso.WithReconnect(true), bitso.WithLogger(a.logger)}
+	if a.config.Websocket != "" {
+		options = append(options, bitso.WithEndpoint(a.config.Websocket))
+	}
+	ws := bitso.NewWebsocketListener(options...)
+
+	ws.OnTrades(func(book bitso.BookCode, trades []bitso.Trade) {
+		for _, t := range trades {
+			at := time.Now()
+			if t.UnixMillis != 0 {
+				at = time.Unix(0, t.UnixMillis * int64(time.Millisecond))
+			}
+			a.out.row(headers, []string{
+				at.Format(TIME_FORMAT), string(book), sideString(t.Side),
+				t.Amount.String(), t.Rate.String(), t.Value.String(),
+			})
+		}
+	}, book)
+
+	if !a.out.json {
+		a.out.row(headers, headers)
+	}
+
+	if _, err := ws.Connect(); err != nil {
+		return err
+	}
+	if err := ws.Subscribe(book, bitso.Channel_TRADES); err != nil {
+		ws.Disconnect()
+		return err
+	}
+
+	// Catch interrupts (Ctrl-c)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		ws.Disconnect()
+	}()
+
+	ws.Listen()
+
+	return nil
+}
+
+func runBalances(a *app, args []string) error {
+	fs := newFlagSet("balances")
+	all := fs.Bool("all", false, "include the currencies without balance")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError{commands["balances"].usage}
+	}
+
+	balances, err := a.client.AccountBalance()
+	if err != nil {
+		return err
+	}
+
+	currencies := make([]bitso.CurrencyCode, 0, len(balances))
+	for c := range balances {
+		currencies = append(currencies, c)
+	}
+	sort.Slice(currencies, func(i, j int) bool { return currencies[i] < currencies[j] })
+
+	rows := make([][]string, 0, len(balances))
+	for _, c := range currencies {
+		b := balances[c]
+		if !*all && b.Total.IsZero() {
+			continue
+		}
+		rows = append(rows, []string{string(c), b.Available.String(), b.Locked.String(), b.Total.String()})
+	}
+
+	return a.out.table([]string{"CURRENCY", "AVAILABLE", "LOCKED", "TOTAL"}, rows)
+}
+
+func runFees(a *app, args []string) error {
+	if len(args) != 0 {
+		return usageError{commands["fees"].usage}
+	}
+
+	fees, err := a.client.AccountFees()
+	if err != nil {
+		return err
+	}
+
+	books := make([]bitso.BookCode, 0, len(fees))
+	for b := range fees {
+		books = append(books, b)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i] < books[j] })
+
+	rows := make([][]string, 0, len(fees))
+	for _, b := range books {
+		f := fees[b]
+		rows = append(rows, []string{string(b), f.MakerFeePercent.String(), f.TakerFeePercent.String()})
+	}
+
+	return a.out.table([]string{"BOOK", "MAKER_PERCENT", "TAKER_PERCENT"}, rows)
+}
+
+func runOrders(a *app, args []string) error {
+	if len(args) > 1 {
+		return usageError{commands["orders"].usage}
+	}
+
+	var book bitso.BookCode
+	if len(args) == 1 {
+		book = bitso.BookCode(args[0])
+	}
+
+	orders, err := a.client.OpenOrders(book)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(orders))
+	for _, o := range orders {
+		rows = append(rows, []string{
+			o.Oid, string(o.Book), sideString(o.Side), string(o.Type), o.Price.String(),
+			o.OriginalAmount.String(), o.UnfilledAmount.String(), string(o.Status),
+			o.CreatedAt.Local().Format(TIME_FORMAT),
+		})
+	}
+
+	return a.out.table([]string{"OID", "BOOK", "SIDE", "TYPE", "PRICE", "AMOUNT", "UNFILLED", "STATUS", "CREATED"}, rows)
+}
+
+func runPlace(a *app, args []string) error {
+	fs := newFlagSet("place")
+	bookFlag := fs.String("book", "", "book, ex. btc_mxn")
+	sideFlag := fs.String("side", "", "buy or sell")
+	amountFlag := fs.String("amount", "", "amount in the major currency")
+	minorFlag := fs.String("minor", "", "amount in the minor currency, market orders only")
+	priceFlag := fs.String("price", "", "limit price, a market order is placed without it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *bookFlag == "" || *sideFlag == "" || (*amountFlag == "") == (*minorFlag == "") {
+		return usageError{commands["place"].usage}
+	}
+
+	side, err := parseSide(*sideFlag)
+	if err != nil {
+		return err
+	}
+
+	req := bitso.OrderRequest{Book: bitso.BookCode(*bookFlag), Side: side, Type: bitso.OrderType_MARKET}
+	if *amountFlag != "" {
+		if req.Major, err = decimal.NewFromString(*amountFlag); err != nil {
+			return fmt.Errorf("invalid amount %q", *amountFlag)
+		}
+	}
+	if *minorFlag != "" {
+		if req.Minor, err = decimal.NewFromString(*minorFlag); err != nil {
+			return fmt.Errorf("invalid minor amount %q", *minorFlag)
+		}
+	}
+
+	if *priceFlag != "" {
+		if *minorFlag != "" {
+			return fmt.Errorf("limit orders take an amount in the major currency")
+		}
+		if req.Price, err = decimal.NewFromString(*priceFlag); err != nil {
+			return fmt.Errorf("invalid price %q", *priceFlag)
+		}
+		req.Type = bitso.OrderType_LIMIT
+	}
+
+	// check the book limits before sending anything
+	books, err := a.client.AvailableBooks()
+	if err != nil {
+		return err
+	}
+	book, ok := books[req.Book]
+	if !ok {
+		return fmt.Errorf("unknown book %s", req.Book)
+	}
+
+	var price, major, minor decimal.Decimal
+	if req.Type == bitso.OrderType_LIMIT {
+		price, major, err = book.ValidateOrder(req.Side, req.Price, req.Major)
+	} else {
+		var orders bitso.Orders
+		if orders, _, err = a.client.OrderBook(req.Book, true); err != nil {
+			return err
+		}
+		major, minor, err = book.ValidateMarketOrder(orders, side, req.Major, req.Minor)
+	}
+	if err != nil {
+		return err
+	}
+
+	// never place something else than what was typed
+	for _, v := range []struct {
+		name 	string
+		typed 	decimal.Decimal
+		rounded decimal.Decimal
+	}{{"price", req.Price, price}, {"amount", req.Major, major}, {"minor amount", req.Minor, minor}} {
+		if !v.typed.Equal(v.rounded) {
+			return fmt.Errorf("%s %s has more decimals than %s allows, ex. %s", v.name, v.typed, req.Book, v.rounded)
+		}
+	}
+
+	oid, err := a.client.PlaceOrder(req)
+	if err != nil {
+		return err
+	}
+
+	amount := req.Major.String()
+	if req.Major.IsZero() {
+		amount = req.Minor.String() + " (minor)"
+	}
+
+	return a.out.table([]string{"OID", "BOOK", "SIDE", "TYPE", "PRICE", "AMOUNT"}, [][]string{
+		{oid, string(req.Book), sideString(side), string(req.Type), req.Price.String(), amount},
+	})
+}
+
+func runCancel(a *app, args []string) error {
+	if len(args) == 0 {
+		return usageError{commands["cancel"].usage}
+	}
+
+	rows := make([][]string, 0, len(args))
+	failed := 0
+	for _, oid := range args {
+		result := "cancelled"
+		if err := a.client.CancelOrder(oid); err != nil {
+			result = err.Error()
+			failed++
+		}
+		rows = append(rows, []string{oid, result})
+	}
+
+	if err := a.out.table([]string{"OID", "RESULT"}, rows); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orders could not be cancelled", failed, len(args))
+	}
+	return nil
+}
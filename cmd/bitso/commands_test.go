@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+	"github.com/shopspring/decimal"
+)
+
+func TestPlaceValidation(t *testing.T) {
+	tests := []struct {
+		name 	string
+		args 	[]string
+		err 	string // empty when placed
+	}{
+		{"limit", []string{"-side", "buy", "-amount", "0.001", "-price", "900000"}, ""},
+		{"limit price decimals", []string{"-side", "buy", "-amount", "0.001", "-price", "900000.125"}, "price 900000.125 has more decimals"},
+		{"limit amount decimals", []string{"-side", "sell", "-amount", "0.0010000001", "-price", "900000"}, "amount 0.0010000001 has more decimals"},
+		{"limit below minimum value", []string{"-side", "buy", "-amount", "0.00001", "-price", "900000"}, "minimum value"},
+		{"market", []string{"-side", "sell", "-amount", "0.001"}, ""},
+		{"market minor", []string{"-side", "buy", "-minor", "1000"}, ""},
+		{"market below minimum amount", []string{"-side", "buy", "-amount", "0.000001"}, "minimum amount"},
+		{"market below minimum value", []string{"-side", "buy", "-minor", "5"}, "minimum value"},
+		{"market minor decimals", []string{"-side", "buy", "-minor", "1000.001"}, "minor amount 1000.001 has more decimals"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := bitsotest.NewServer()
+			defer server.Close()
+
+			server.SetOrderBook("btc_mxn", bitso.Orders{
+				Bids: []bitso.Offer{{Rate: decimal.NewFromInt(899000), Amount: decimal.NewFromInt(1)}},
+				Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.NewFromInt(1)}},
+			}, 1)
+
+			out := &bytes.Buffer{}
+			a := &app{client: server.Client(), logger: bitso.NopLogger(), out: printer{out: out}}
+
+			err := runPlace(a, append([]string{"-book", "btc_mxn"}, tt.args...))
+
+			placed := false
+			for _, r := range server.Requests() {
+				placed = placed || strings.HasPrefix(r, "POST /v3/orders")
+			}
+
+			if tt.err == "" {
+				if err != nil || !placed {
+					t.Errorf("placed: %v (%v), expecting the order placed", placed, err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(strings.ToLower(err.Error()), tt.err) {
+				t.Errorf("received error %v, expecting %q", err, tt.err)
+			}
+			if placed {
+				t.Error("order placed despite the error")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ENV_API_KEY 		= "BITSO_API_KEY"
+	ENV_API_SECRET 		= "BITSO_API_SECRET"
+	ENV_API_ENDPOINT 	= "BITSO_API_ENDPOINT"
+	ENV_WS_ENDPOINT 	= "BITSO_WEBSOCKET_ENDPOINT"
+)
+
+// config holds the API credentials, read from the config file and overridden by the environment
+type config struct {
+	Key 		string `json:"key"`
+	Secret 		string `json:"secret"`
+	Endpoint 	string `json:"endpoint"` // empty for api.bitso.com
+	Websocket 	string `json:"websocket"` // empty for ws.bitso.com
+}
+
+// defaultConfigPath is bitso/config.json in the user configuration directory, ex. ~/.config/bitso/config.json
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bitso", "config.json")
+}
+
+// loadConfig reads the config file, a missing file is only an error when its path was given explicitly
+func loadConfig(path string, explicit bool) (config, error) {
+	c := config{}
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &c); err != nil {
+				return c, fmt.Errorf("invalid config file %s: %v", path, err)
+			}
+		case os.IsNotExist(err) && !explicit:
+		default:
+			return c, err
+		}
+	}
+
+	if key := os.Getenv(ENV_API_KEY); key != "" {
+		c.Key = key
+	}
+	if secret := os.Getenv(ENV_API_SECRET); secret != "" {
+		c.Secret = secret
+	}
+	if endpoint := os.Getenv(ENV_API_ENDPOINT); endpoint != "" {
+		c.Endpoint = endpoint
+	}
+	if endpoint := os.Getenv(ENV_WS_ENDPOINT); endpoint != "" {
+		c.Websocket = endpoint
+	}
+
+	return c, nil
+}
@@ -0,0 +1,160 @@
+// Command bitso is a command-line tool for the Bitso API: books, tickers, order books, balances, fees, orders and
+// live trades, printed as tables or as JSON.
+//
+// The API key and secret are read from the BITSO_API_KEY and BITSO_API_SECRET environment variables, or from a JSON
+// config file ({"key": "...", "secret": "..."}) at bitso/config.json in the user configuration directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/angle/gobitso"
+)
+
+// command is a subcommand, run with the arguments following its name
+type command struct {
+	usage 	string
+	summary string
+	private bool
+	run 	func(app *app, args []string) error
+}
+
+var commands map[string]command
+
+// the commands are set in init since their flag sets refer to them for their usage
+func init() {
+	commands = map[string]command{
+		"books": {"books", "list the available books and their limits", false, runBooks},
+		"ticker": {"ticker [book...]", "show the ticker of every book, or of the given ones", false, runTicker},
+		"orderbook": {"orderbook [-depth n] <book>", "show the order book of a book", false, runOrderBook},
+		"trades": {"trades [-rest] [-limit n] <book>", "tail the trades of a book from the websocket, or list the latest ones", false, runTrades},
+		"balances": {"balances [-all]", "show the account balances", true, runBalances},
+		"fees": {"fees", "show the maker and taker fees of every book", true, runFees},
+		"orders": {"orders [book]", "list the open orders", true, runOrders},
+		"place": {"place -book <book> -side <buy|sell> (-amount <major> | -minor <minor>) [-price <price>]", "place a limit order, or a market order without price", true, runPlace},
+		"cancel": {"cancel <oid...>", "cancel open orders", true, runCancel},
+	}
+}
+
+// app is what every command needs
+type app struct {
+	client 	*bitso.Client
+	logger 	bitso.Logger
+	config 	config
+	out 	printer
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bitso [-json] [-config file] [-v] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "flags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print JSON instead of tables")
+	configPath := flag.String("config", "", "config file with the API key and secret (default " + defaultConfigPath() + ")")
+	verbose := flag.Bool("v", false, "log every request and websocket event")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bitso: unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	path := *configPath
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	cfg, err := loadConfig(path, *configPath != "")
+	if err != nil {
+		fail(err)
+	}
+
+	if cmd.private && (cfg.Key == "" || cfg.Secret == "") {
+		fail(fmt.Errorf("%s needs an API key and secret, set %s and %s or use a config file", name, ENV_API_KEY, ENV_API_SECRET))
+	}
+
+	logger := bitso.NopLogger()
+	if *verbose {
+		logger = bitso.NewStdLogger(nil, "Bitso: ", bitso.LogLevel_DEBUG)
+	}
+
+	client := bitso.NewClient()
+	client.SetLogger(logger)
+	if cfg.Endpoint != "" {
+		client.SetAPIEndpoint(cfg.Endpoint)
+	}
+	if cfg.Key != "" {
+		client.SetPrivateKey(cfg.Key, cfg.Secret)
+	}
+
+	a := &app{
+		client: client,
+		logger: logger,
+		config: cfg,
+		out: printer{out: os.Stdout, json: *jsonOutput},
+	}
+
+	err = cmd.run(a, flag.Args()[1:])
+	switch err.(type) {
+	case nil:
+	case usageError:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	default:
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "bitso:", err)
+	os.Exit(1)
+}
+
+// usageError is returned by commands called with the wrong arguments
+type usageError struct {
+	usage string
+}
+
+func (e usageError) Error() string {
+	return "usage: bitso " + e.usage
+}
+
+// newFlagSet returns the flag set of a command, printing its usage on errors
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bitso " + commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
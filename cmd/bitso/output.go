@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// printer writes rows either as an aligned table or as JSON objects keyed by the lowercase headers
+type printer struct {
+	out 	io.Writer
+	json 	bool
+}
+
+func (p printer) table(headers []string, rows [][]string) error {
+	if p.json {
+		objects := make([]map[string]string, 0, len(rows))
+		for _, row := range rows {
+			objects = append(objects, p.object(headers, row))
+		}
+		return p.encode(objects)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// row writes a single row, as one line of JSON when streaming (ex. tailing trades)
+func (p printer) row(headers []string, row []string) error {
+	if p.json {
+		data, err := json.Marshal(p.object(headers, row))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.out, string(data))
+		return err
+	}
+
+	_, err := fmt.Fprintln(p.out, strings.Join(row, "  "))
+	return err
+}
+
+func (p printer) object(headers []string, row []string) map[string]string {
+	object := make(map[string]string, len(headers))
+	for i, h := range headers {
+		if i < len(row) {
+			object[strings.ToLower(h)] = row[i]
+		}
+	}
+	return object
+}
+
+func (p printer) encode(v interface{}) error {
+	encoder := json.NewEncoder(p.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
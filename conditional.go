@@ -0,0 +1,595 @@
+package bitso
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DEFAULT_CONDITIONAL_RETRY_INTERVAL is how long a conditional order that could not be placed waits before it can
+// trigger again, unless SetRetryInterval is called
+const DEFAULT_CONDITIONAL_RETRY_INTERVAL = 5 * time.Second
+
+// DEFAULT_CONDITIONAL_MAX_ATTEMPTS is how many times a triggered order is submitted before it is dropped, unless
+// SetMaxAttempts is called
+const DEFAULT_CONDITIONAL_MAX_ATTEMPTS = 5
+
+type TriggerKind string
+
+const (
+	TriggerKind_STOP_LOSS 		TriggerKind = "stop loss"
+	TriggerKind_TAKE_PROFIT 	TriggerKind = "take profit"
+)
+
+// ConditionalOrder is an order submitted once the price of its book crosses the trigger price. A sell stop loss
+// triggers at or below the trigger price and a sell take profit at or above it, the other way around when buying.
+type ConditionalOrder struct {
+	Id 				string 			`json:"id"`
+	Kind 			TriggerKind 	`json:"kind"`
+	TriggerPrice 	decimal.Decimal `json:"trigger_price"` // units: minor
+	Order 			OrderRequest 	`json:"order"` // market, or limit for a stop-limit
+	Oco 			string 			`json:"oco,omitempty"` // id of the linked order, cancelled when this one triggers
+	CreatedAt 		time.Time 		`json:"created_at"`
+	Attempts 		int 			`json:"attempts,omitempty"` // failed submissions so far
+	Unconfirmed 	bool 			`json:"unconfirmed,omitempty"` // the last submission may have placed the order
+}
+
+// originId identifies the submissions of the order to the exchange, the same across attempts and restarts
+func (c ConditionalOrder) originId() string {
+	if c.Order.OriginId != "" {
+		return c.Order.OriginId
+	}
+	return c.Id + "t" + strconv.FormatInt(c.CreatedAt.UnixNano(), 10)
+}
+
+// Triggers reports whether a price crosses the trigger price
+func (c ConditionalOrder) Triggers(price decimal.Decimal) bool {
+	above := (c.Kind == TriggerKind_STOP_LOSS) == (c.Order.Side == Side_BUY)
+	if above {
+		return price.GreaterThanOrEqual(c.TriggerPrice)
+	}
+	return price.LessThanOrEqual(c.TriggerPrice)
+}
+
+// TriggeredOrder is a conditional order that was triggered, with the result of submitting it
+type TriggeredOrder struct {
+	Conditional 	ConditionalOrder
+	Price 			decimal.Decimal // the price that crossed the trigger
+	Oid 			string // empty if the order was not placed
+	Error 			error
+	Cancelled 		string // id of the OCO order cancelled, if any
+	RetryAt 		time.Time // when the order was not placed: it is pending again and can trigger from then on
+	Dropped 		bool // the order was not placed after the maximum attempts, it is not pending anymore
+}
+
+// placement is a triggered order waiting to be placed, with the OCO order it cancelled
+type placement struct {
+	triggered 	TriggeredOrder
+	oco 		*ConditionalOrder
+}
+
+// conditionalFile is the JSON persisted by ConditionalOrders
+type conditionalFile struct {
+	Seq 	int64 				`json:"seq"`
+	Orders 	[]ConditionalOrder 	`json:"orders"`
+}
+
+// ConditionalOrders emulates stop-loss and take-profit orders, which Bitso does not support, by watching the
+// prices of the books and submitting the orders through a Trader when their trigger price is crossed. Triggered
+// orders are removed before being submitted, so an order is never placed twice, even across restarts. An order
+// that cannot be placed is pending again, with its OCO order, and triggers again after the retry interval. When the
+// outcome of a submission is unknown, a timeout for instance, the order is looked up by its origin id before being
+// submitted again. After the maximum attempts the order and its OCO order are dropped.
+type ConditionalOrders struct {
+	trader 			Trader
+	path 			string
+	logger 			Logger
+
+	mu 				sync.Mutex
+	pending 		map[string]*ConditionalOrder
+	seq 			int64
+	retryInterval 	time.Duration
+	maxAttempts 	int
+	retryAt 		map[string]time.Time // orders that failed to be placed, by id
+	queue 			[]placement
+	started 		bool
+	closed 			bool
+
+	wake 			chan bool
+	quit 			chan bool
+	done 			chan bool // closed when the worker ends
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(triggered TriggeredOrder)
+}
+
+// NewConditionalOrders returns conditional orders kept in memory only
+func NewConditionalOrders(trader Trader) *ConditionalOrders {
+	return &ConditionalOrders{
+		trader: trader,
+		logger: NopLogger(),
+		pending: make(map[string]*ConditionalOrder),
+		retryInterval: DEFAULT_CONDITIONAL_RETRY_INTERVAL,
+		maxAttempts: DEFAULT_CONDITIONAL_MAX_ATTEMPTS,
+		retryAt: make(map[string]time.Time),
+		wake: make(chan bool, 1),
+		quit: make(chan bool),
+		done: make(chan bool),
+	}
+}
+
+// OpenConditionalOrders returns conditional orders persisted to a JSON file after every change, loading the pending
+// ones if the file exists. Files with duplicate ids, or ids beyond their sequence, are rejected since new orders
+// would take those ids again.
+func OpenConditionalOrders(trader Trader, path string) (*ConditionalOrders, error) {
+	co := NewConditionalOrders(trader)
+	co.path = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return co, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := conditionalFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid conditional orders file %s: %v", path, err)
+	}
+
+	co.seq = file.Seq
+	for i := range file.Orders {
+		o := file.Orders[i]
+
+		if _, ok := co.pending[o.Id]; ok {
+			return nil, fmt.Errorf("invalid conditional orders file %s: duplicate id %s", path, o.Id)
+		}
+		n, err := strconv.ParseInt(strings.TrimPrefix(o.Id, "cond"), 10, 64)
+		if !strings.HasPrefix(o.Id, "cond") || err != nil || n < 1 || n > file.Seq {
+			return nil, fmt.Errorf("invalid conditional orders file %s: id %s is not below the sequence %d", path, o.Id, file.Seq)
+		}
+
+		co.pending[o.Id] = &o
+	}
+
+	return co, nil
+}
+
+func (co *ConditionalOrders) SetLogger(logger Logger) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	co.logger = logger
+}
+
+// SetRetryInterval sets how long an order that could not be placed waits before it can trigger again
+func (co *ConditionalOrders) SetRetryInterval(interval time.Duration) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	co.retryInterval = interval
+}
+
+// SetMaxAttempts sets how many times a triggered order is submitted before it is dropped
+func (co *ConditionalOrders) SetMaxAttempts(attempts int) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	co.maxAttempts = attempts
+}
+
+// OnTrigger registers a handler called with every triggered order, after it was submitted. The orders are submitted
+// and the handlers called in order from a single worker goroutine, not from the one updating the prices.
+func (co *ConditionalOrders) OnTrigger(handler func(triggered TriggeredOrder)) {
+	co.handlersMu.Lock()
+	defer co.handlersMu.Unlock()
+
+	co.handlers = append(co.handlers, handler)
+}
+
+func validateConditional(order ConditionalOrder) error {
+	if order.Kind != TriggerKind_STOP_LOSS && order.Kind != TriggerKind_TAKE_PROFIT {
+		return fmt.Errorf("unknown trigger kind %q", order.Kind)
+	}
+	if !order.TriggerPrice.IsPositive() {
+		return fmt.Errorf("trigger price must be positive")
+	}
+	if order.Order.Book == "" {
+		return fmt.Errorf("conditional order without book")
+	}
+	if order.Order.Type == OrderType_LIMIT && !order.Order.Price.IsPositive() {
+		return fmt.Errorf("limit price must be positive")
+	}
+	return nil
+}
+
+// Add adds a conditional order and returns its id
+func (co *ConditionalOrders) Add(order ConditionalOrder) (string, error) {
+	if err := validateConditional(order); err != nil {
+		return "", err
+	}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	id := co.add(order, "", time.Now())
+	if err := co.save(); err != nil {
+		delete(co.pending, id)
+		return "", err
+	}
+
+	return id, nil
+}
+
+// AddOCO adds two linked conditional orders, usually a stop loss and a take profit of the same position: when one
+// triggers the other is cancelled
+func (co *ConditionalOrders) AddOCO(a, b ConditionalOrder) (string, string, error) {
+	if err := validateConditional(a); err != nil {
+		return "", "", err
+	}
+	if err := validateConditional(b); err != nil {
+		return "", "", err
+	}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	now := time.Now()
+	idA := co.add(a, "", now)
+	idB := co.add(b, idA, now)
+	co.pending[idA].Oco = idB
+
+	if err := co.save(); err != nil {
+		delete(co.pending, idA)
+		delete(co.pending, idB)
+		return "", "", err
+	}
+
+	return idA, idB, nil
+}
+
+// add must be called with the lock held
+func (co *ConditionalOrders) add(order ConditionalOrder, oco string, now time.Time) string {
+	co.seq++
+	order.Id = "cond" + strconv.FormatInt(co.seq, 10)
+	order.Oco = oco
+	order.CreatedAt = now
+
+	co.pending[order.Id] = &order
+
+	return order.Id
+}
+
+// Cancel removes a pending conditional order together with its OCO order
+func (co *ConditionalOrders) Cancel(id string) error {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	o, ok := co.pending[id]
+	if !ok {
+		return fmt.Errorf("unknown conditional order %s", id)
+	}
+	oco := co.pending[o.Oco]
+
+	delete(co.pending, id)
+	if oco != nil {
+		delete(co.pending, oco.Id)
+	}
+
+	if err := co.save(); err != nil {
+		co.pending[id] = o
+		if oco != nil {
+			co.pending[oco.Id] = oco
+		}
+		return err
+	}
+
+	delete(co.retryAt, id)
+	if oco != nil {
+		delete(co.retryAt, oco.Id)
+	}
+
+	return nil
+}
+
+// Pending returns the conditional orders not triggered yet, oldest first
+func (co *ConditionalOrders) Pending() []ConditionalOrder {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	orders := make([]ConditionalOrder, 0, len(co.pending))
+	for _, o := range co.pending {
+		orders = append(orders, *o)
+	}
+	sort.Slice(orders, func(i, j int) bool { return conditionalBefore(orders[i], orders[j]) })
+
+	return orders
+}
+
+// conditionalBefore orders by creation, then by id since both orders of an OCO pair share the creation time
+func conditionalBefore(a, b ConditionalOrder) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	if len(a.Id) != len(b.Id) {
+		return len(a.Id) < len(b.Id)
+	}
+	return a.Id < b.Id
+}
+
+// Attach watches the prices from the Trades and Orders channels of a websocket, the caller still has to subscribe
+// to the channels to watch for every book
+func (co *ConditionalOrders) Attach(ws *Websocket) {
+	ws.OnTrades(co.UpdateTrades)
+	ws.OnOrders(co.UpdateOrders)
+}
+
+// UpdateTrades checks the triggers of a book against the price of every trade
+func (co *ConditionalOrders) UpdateTrades(book BookCode, trades []Trade) {
+	for _, t := range trades {
+		co.UpdatePrice(book, t.Rate, t.Rate)
+	}
+}
+
+// UpdateOrders checks the triggers of a book against the top of the book: sell orders against the best bid and buy
+// orders against the best ask, the prices they would be filled at
+func (co *ConditionalOrders) UpdateOrders(book BookCode, orders Orders) {
+	top := newTopOfBook(orders)
+	co.UpdatePrice(book, top.bid.Rate, top.ask.Rate)
+}
+
+// UpdatePrice checks the triggers of a book, sell orders against the bid and buy orders against the ask. A zero
+// price is ignored. The triggered orders are only submitted once their removal is persisted, otherwise they stay
+// pending and trigger again with the next price.
+func (co *ConditionalOrders) UpdatePrice(book BookCode, bid, ask decimal.Decimal) {
+	co.mu.Lock()
+	if co.closed {
+		co.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	triggered := make([]TriggeredOrder, 0)
+	for _, o := range co.pending {
+		if o.Order.Book != book || now.Before(co.retryAt[o.Id]) {
+			continue
+		}
+
+		price := ask
+		if o.Order.Side == Side_SELL {
+			price = bid
+		}
+		if !price.IsPositive() || !o.Triggers(price) {
+			continue
+		}
+
+		triggered = append(triggered, TriggeredOrder{Conditional: *o, Price: price})
+	}
+
+	if len(triggered) == 0 {
+		co.mu.Unlock()
+		return
+	}
+
+	// oldest first, and only one of each OCO pair triggered by the same price
+	sort.Slice(triggered, func(i, j int) bool { return conditionalBefore(triggered[i].Conditional, triggered[j].Conditional) })
+
+	fired := make([]placement, 0, len(triggered))
+	removed := make([]*ConditionalOrder, 0, len(triggered))
+	for _, t := range triggered {
+		o, ok := co.pending[t.Conditional.Id]
+		if !ok {
+			continue
+		}
+
+		delete(co.pending, o.Id)
+		removed = append(removed, o)
+
+		p := placement{triggered: t}
+		if oco, ok := co.pending[o.Oco]; ok {
+			delete(co.pending, oco.Id)
+			removed = append(removed, oco)
+			p.triggered.Cancelled = oco.Id
+			p.oco = oco
+		}
+		fired = append(fired, p)
+	}
+
+	if err := co.save(); err != nil {
+		// placing them without persisting their removal could place them again after a restart, keep them pending
+		// until the file can be written
+		for _, o := range removed {
+			co.pending[o.Id] = o
+		}
+		co.logger.Log(LogLevel_ERROR, "cannot persist conditional orders, not placing the triggered ones", Field("error", err))
+		co.mu.Unlock()
+		return
+	}
+
+	for _, o := range removed {
+		delete(co.retryAt, o.Id)
+	}
+	co.queue = append(co.queue, fired...)
+
+	// placing the orders takes a request each, never block the websocket dispatch on them
+	if !co.started {
+		co.started = true
+		go co.work()
+	}
+	co.mu.Unlock()
+
+	select {
+	case co.wake <- true:
+	default:
+	}
+}
+
+// Close stops triggering and placing orders, after the one being placed if any. The triggered orders still waiting
+// to be placed are pending again. It must not be called from an OnTrigger handler.
+func (co *ConditionalOrders) Close() {
+	co.mu.Lock()
+	if co.closed {
+		co.mu.Unlock()
+		return
+	}
+	co.closed = true
+	started := co.started
+	co.mu.Unlock()
+
+	close(co.quit)
+	if started {
+		<-co.done
+	}
+
+	co.mu.Lock()
+	defer co.mu.Unlock()
+
+	for _, p := range co.queue {
+		o := p.triggered.Conditional
+		co.pending[o.Id] = &o
+		if p.oco != nil {
+			co.pending[p.oco.Id] = p.oco
+		}
+	}
+	if len(co.queue) > 0 {
+		co.queue = nil
+		if err := co.save(); err != nil {
+			co.logger.Log(LogLevel_ERROR, "cannot persist the conditional orders not placed", Field("error", err))
+		}
+	}
+}
+
+// work places the queued orders in order, until Close is called
+func (co *ConditionalOrders) work() {
+	defer close(co.done)
+
+	for {
+		select {
+		case <-co.wake:
+		case <-co.quit:
+			return
+		}
+
+		for {
+			co.mu.Lock()
+			if len(co.queue) == 0 || co.closed {
+				co.mu.Unlock()
+				break
+			}
+			p := co.queue[0]
+			co.queue = co.queue[1:]
+			co.mu.Unlock()
+
+			co.place(p)
+		}
+	}
+}
+
+// place submits a triggered order and calls the handlers. An order that cannot be placed is pending again, with its
+// OCO order, until the retry interval passes, or dropped after the maximum attempts.
+func (co *ConditionalOrders) place(p placement) {
+	t := p.triggered
+	o := t.Conditional
+	order := o.Order
+	order.OriginId = o.originId()
+
+	if o.Unconfirmed {
+		// the last submission may have reached the exchange
+		t.Oid, t.Error = co.lookup(order.OriginId)
+	}
+	if t.Oid == "" && t.Error == nil {
+		t.Oid, t.Error = co.trader.PlaceOrder(order)
+		// only a rejection proves that nothing was placed
+		_, rejected := t.Error.(ApiError)
+		o.Unconfirmed = t.Error != nil && !rejected
+	}
+
+	co.mu.Lock()
+	logger := co.logger
+	if t.Error != nil {
+		o.Attempts++
+		t.Conditional = o
+		if o.Attempts < co.maxAttempts {
+			co.pending[o.Id] = &o
+			if p.oco != nil {
+				co.pending[p.oco.Id] = p.oco
+				t.Cancelled = ""
+			}
+			t.RetryAt = time.Now().Add(co.retryInterval)
+			co.retryAt[o.Id] = t.RetryAt
+		} else {
+			t.Dropped = true
+		}
+
+		if err := co.save(); err != nil {
+			logger.Log(LogLevel_ERROR, "cannot persist the failed conditional order", Field("id", o.Id), Field("error", err))
+		}
+	}
+	co.mu.Unlock()
+
+	switch {
+	case t.Dropped:
+		logger.Log(LogLevel_ERROR, "conditional order not placed, dropped", Field("id", o.Id), Field("attempts", o.Attempts), Field("error", t.Error))
+	case t.Error != nil:
+		logger.Log(LogLevel_WARN, "conditional order not placed, retrying later", Field("id", o.Id), Field("error", t.Error))
+	default:
+		logger.Log(LogLevel_INFO, "conditional order placed", Field("id", o.Id), Field("oid", t.Oid))
+	}
+
+	co.handlersMu.RLock()
+	handlers := make([]func(triggered TriggeredOrder), len(co.handlers))
+	copy(handlers, co.handlers)
+	co.handlersMu.RUnlock()
+
+	for _, h := range handlers {
+		h(t)
+	}
+}
+
+// lookup returns the oid of the order placed with the origin id, empty if the exchange does not know it
+func (co *ConditionalOrders) lookup(originId string) (string, error) {
+	orders, err := co.trader.LookupOrdersByOrigin(originId)
+	if err != nil {
+		return "", err
+	}
+	for _, o := range orders {
+		if o.OriginId == originId {
+			return o.Oid, nil
+		}
+	}
+	return "", nil
+}
+
+// save writes the pending orders to the file, if any, replacing it atomically. Must be called with the lock held.
+func (co *ConditionalOrders) save() error {
+	if co.path == "" {
+		return nil
+	}
+
+	file := conditionalFile{Seq: co.seq, Orders: make([]ConditionalOrder, 0, len(co.pending))}
+	for _, o := range co.pending {
+		file.Orders = append(file.Orders, *o)
+	}
+	sort.Slice(file.Orders, func(i, j int) bool { return conditionalBefore(file.Orders[i], file.Orders[j]) })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := co.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, co.path)
+}
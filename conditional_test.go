@@ -0,0 +1,489 @@
+package bitso_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+	"github.com/shopspring/decimal"
+)
+
+func stopLimit(kind bitso.TriggerKind, side bitso.Side, trigger string) bitso.ConditionalOrder {
+	return bitso.ConditionalOrder{
+		Kind: kind,
+		TriggerPrice: d(trigger),
+		Order: bitso.OrderRequest{Book: "btc_mxn", Side: side, Type: bitso.OrderType_LIMIT, Major: d("0.1"), Price: d(trigger)},
+	}
+}
+
+func triggeredOrder(t *testing.T, triggered <-chan bitso.TriggeredOrder) bitso.TriggeredOrder {
+	t.Helper()
+
+	select {
+	case o := <-triggered:
+		return o
+	case <-time.After(2 * time.Second):
+		t.Fatal("no order triggered")
+		return bitso.TriggeredOrder{}
+	}
+}
+
+func TestConditionalOrderTriggers(t *testing.T) {
+	tests := []struct {
+		kind 		bitso.TriggerKind
+		side 		bitso.Side
+		price 		string
+		expected 	bool
+	}{
+		{bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "899999", true},
+		{bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "900000", true},
+		{bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "900001", false},
+		{bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "900001", true},
+		{bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "899999", false},
+		{bitso.TriggerKind_STOP_LOSS, bitso.Side_BUY, "900001", true},
+		{bitso.TriggerKind_STOP_LOSS, bitso.Side_BUY, "899999", false},
+		{bitso.TriggerKind_TAKE_PROFIT, bitso.Side_BUY, "899999", true},
+		{bitso.TriggerKind_TAKE_PROFIT, bitso.Side_BUY, "900001", false},
+	}
+
+	for _, tt := range tests {
+		o := stopLimit(tt.kind, tt.side, "900000")
+		if triggers := o.Triggers(d(tt.price)); triggers != tt.expected {
+			t.Errorf("%s %s at %s triggers: %v, expecting %v", tt.side, tt.kind, tt.price, triggers, tt.expected)
+		}
+	}
+}
+
+func TestConditionalOrdersOCO(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	conditional := bitso.NewConditionalOrders(server.Client())
+	triggered := make(chan bitso.TriggeredOrder, 2)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	stopId, takeId, err := conditional.AddOCO(
+		stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"),
+		stopLimit(bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "1000000"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("900000"), d("901000"))
+	conditional.UpdatePrice("eth_mxn", d("700000"), d("701000"))
+	if pending := conditional.Pending(); len(pending) != 2 {
+		t.Fatalf("%d pending orders, expecting 2", len(pending))
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+
+	o := triggeredOrder(t, triggered)
+	if o.Conditional.Id != stopId || o.Cancelled != takeId || o.Error != nil {
+		t.Errorf("triggered %s cancelling %s (%v), expecting %s cancelling %s", o.Conditional.Id, o.Cancelled, o.Error, stopId, takeId)
+	}
+	if placed, ok := server.Order(o.Oid); !ok || placed.Side != "sell" {
+		t.Errorf("triggered order %s was not placed", o.Oid)
+	}
+	if pending := conditional.Pending(); len(pending) != 0 {
+		t.Errorf("%d pending orders after the trigger, expecting none", len(pending))
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("1000000"), d("1001000"))
+	select {
+	case o := <-triggered:
+		t.Errorf("cancelled order %s triggered", o.Conditional.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConditionalOrdersPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conditional")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	server := bitsotest.NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	conditional, err := bitso.OpenConditionalOrders(client, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := bitso.OpenConditionalOrders(client, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := reopened.Pending(); len(pending) != 1 || pending[0].Id != id || !pending[0].TriggerPrice.Equal(d("800000")) {
+		t.Fatalf("reloaded %v, expecting %s", pending, id)
+	}
+
+	triggered := make(chan bitso.TriggeredOrder, 1)
+	reopened.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	// the removal is written before the order is placed
+	tmp := path + ".tmp"
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	reopened.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+
+	select {
+	case o := <-triggered:
+		t.Fatalf("order %s placed without persisting its removal", o.Conditional.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if pending := reopened.Pending(); len(pending) != 1 {
+		t.Fatalf("%d pending orders after the failed save, expecting 1", len(pending))
+	}
+
+	if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+	reopened.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+
+	if o := triggeredOrder(t, triggered); o.Conditional.Id != id || o.Error != nil {
+		t.Errorf("triggered %s (%v), expecting %s", o.Conditional.Id, o.Error, id)
+	}
+
+	last, err := bitso.OpenConditionalOrders(client, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending := last.Pending(); len(pending) != 0 {
+		t.Errorf("%d pending orders reloaded after the trigger, expecting none", len(pending))
+	}
+	if next, err := last.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "700000")); err != nil || next == id {
+		t.Errorf("added %s (%v), expecting a new id", next, err)
+	}
+}
+
+// failingTrader fails the next placements
+// failingTrader fails the first placements with err, after placing the order when lost is set, like a response
+// lost after the exchange accepted it
+type failingTrader struct {
+	bitso.Trader
+	err 		error
+	lost 		bool
+
+	mu 			sync.Mutex
+	failures 	int
+}
+
+func (ft *failingTrader) PlaceOrder(order bitso.OrderRequest) (string, error) {
+	ft.mu.Lock()
+	fail := ft.failures > 0
+	ft.failures--
+	ft.mu.Unlock()
+
+	if !fail {
+		return ft.Trader.PlaceOrder(order)
+	}
+	if ft.lost {
+		ft.Trader.PlaceOrder(order)
+	}
+	return "", ft.err
+}
+
+func TestConditionalOrdersRetry(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	conditional := bitso.NewConditionalOrders(&failingTrader{Trader: server.Client(), err: fmt.Errorf("connection reset"), failures: 1})
+	conditional.SetRetryInterval(100 * time.Millisecond)
+	triggered := make(chan bitso.TriggeredOrder, 2)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	stopId, takeId, err := conditional.AddOCO(
+		stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"),
+		stopLimit(bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "1000000"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	o := triggeredOrder(t, triggered)
+	if o.Error == nil || o.RetryAt.IsZero() || o.Cancelled != "" {
+		t.Fatalf("failed placement reported with %v, retry at %s, cancelling %q", o.Error, o.RetryAt, o.Cancelled)
+	}
+	if pending := conditional.Pending(); len(pending) != 2 {
+		t.Fatalf("%d pending orders after the failed placement, expecting both", len(pending))
+	}
+
+	// not before the retry interval
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	select {
+	case o := <-triggered:
+		t.Fatalf("order %s triggered again before the retry interval", o.Conditional.Id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	time.Sleep(time.Until(o.RetryAt))
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	if o := triggeredOrder(t, triggered); o.Conditional.Id != stopId || o.Cancelled != takeId || o.Error != nil {
+		t.Errorf("retried %s cancelling %s (%v), expecting %s cancelling %s", o.Conditional.Id, o.Cancelled, o.Error, stopId, takeId)
+	}
+}
+
+func TestConditionalOrdersLookUpLostPlacements(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	conditional := bitso.NewConditionalOrders(&failingTrader{Trader: client, err: fmt.Errorf("timeout"), lost: true, failures: 1})
+	conditional.SetRetryInterval(10 * time.Millisecond)
+	triggered := make(chan bitso.TriggeredOrder, 2)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	if _, err := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000")); err != nil {
+		t.Fatal(err)
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	o := triggeredOrder(t, triggered)
+	if o.Error == nil || !o.Conditional.Unconfirmed {
+		t.Fatalf("lost placement reported with %v, unconfirmed %t", o.Error, o.Conditional.Unconfirmed)
+	}
+
+	// the retry finds the order placed by the first attempt instead of placing it again
+	time.Sleep(time.Until(o.RetryAt))
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	o = triggeredOrder(t, triggered)
+
+	orders, err := client.OpenOrders("btc_mxn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Error != nil || len(orders) != 1 || orders[0].Oid != o.Oid {
+		t.Errorf("retry reported %s (%v) with %d open orders, expecting the order placed once", o.Oid, o.Error, len(orders))
+	}
+}
+
+func TestConditionalOrdersDropRejectedOrders(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	rejection := bitso.ApiError{Code: "0379", Message: "Insufficient funds"}
+	conditional := bitso.NewConditionalOrders(&failingTrader{Trader: server.Client(), err: rejection, failures: 10})
+	conditional.SetRetryInterval(10 * time.Millisecond)
+	conditional.SetMaxAttempts(2)
+	triggered := make(chan bitso.TriggeredOrder, 2)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	if _, _, err := conditional.AddOCO(
+		stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"),
+		stopLimit(bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "1000000"),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	o := triggeredOrder(t, triggered)
+	if o.Dropped || o.Conditional.Unconfirmed || len(conditional.Pending()) != 2 {
+		t.Fatalf("first rejection dropped %t, unconfirmed %t, expecting both orders pending", o.Dropped, o.Conditional.Unconfirmed)
+	}
+
+	time.Sleep(time.Until(o.RetryAt))
+	conditional.UpdatePrice("btc_mxn", d("799000"), d("800000"))
+	if o := triggeredOrder(t, triggered); !o.Dropped || o.Conditional.Attempts != 2 {
+		t.Errorf("second rejection dropped %t after %d attempts, expecting it dropped after 2", o.Dropped, o.Conditional.Attempts)
+	}
+	if pending := conditional.Pending(); len(pending) != 0 {
+		t.Errorf("%d pending orders, expecting the pair dropped", len(pending))
+	}
+
+	// a rejection proves that nothing was placed, there is nothing to look up
+	for _, r := range server.Requests() {
+		if strings.Contains(r, "origin_ids") {
+			t.Errorf("looked up a rejected order: %s", r)
+		}
+	}
+}
+
+func TestConditionalOrdersPlacedInOrder(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	conditional := bitso.NewConditionalOrders(server.Client())
+	triggered := make(chan bitso.TriggeredOrder, 10)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	ids := make([]string, 0)
+	for i := 0; i < 10; i++ {
+		trigger := decimal.NewFromInt(int64(900000 - i * 1000)).String()
+		id, err := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, trigger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	// every price triggers the next stop
+	for i := 0; i < 10; i++ {
+		price := decimal.NewFromInt(int64(900000 - i * 1000))
+		conditional.UpdatePrice("btc_mxn", price, price)
+	}
+
+	for _, id := range ids {
+		if o := triggeredOrder(t, triggered); o.Conditional.Id != id {
+			t.Fatalf("triggered %s, expecting %s", o.Conditional.Id, id)
+		}
+	}
+}
+
+func TestConditionalOrdersCancelRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conditional")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	conditional, err := bitso.OpenConditionalOrders(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopId, _, err := conditional.AddOCO(
+		stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"),
+		stopLimit(bitso.TriggerKind_TAKE_PROFIT, bitso.Side_SELL, "1000000"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file cannot be written
+	if err := os.Mkdir(path + ".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := conditional.Cancel(stopId); err == nil {
+		t.Error("cancelled without persisting it")
+	}
+	if pending := conditional.Pending(); len(pending) != 2 {
+		t.Errorf("%d pending orders after the failed cancellation, expecting both", len(pending))
+	}
+}
+
+func TestOpenConditionalOrdersValidatesIds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conditional")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "triggers.json")
+
+	order := `{"id": "%s", "kind": "stop loss", "trigger_price": "800000", "order": {"book": "btc_mxn"}}`
+	tests := []struct {
+		name 	string
+		seq 	int
+		ids 	[]string
+		valid 	bool
+	}{
+		{"valid", 2, []string{"cond1", "cond2"}, true},
+		{"duplicate id", 2, []string{"cond2", "cond2"}, false},
+		{"id beyond the sequence", 1, []string{"cond1", "cond2"}, false},
+		{"unknown id", 2, []string{"stop"}, false},
+	}
+
+	for _, tt := range tests {
+		orders := make([]string, 0, len(tt.ids))
+		for _, id := range tt.ids {
+			orders = append(orders, fmt.Sprintf(order, id))
+		}
+		data := fmt.Sprintf(`{"seq": %d, "orders": [%s]}`, tt.seq, strings.Join(orders, ","))
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := bitso.OpenConditionalOrders(nil, path)
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: expecting an error", tt.name)
+		}
+	}
+}
+
+// blockingTrader holds every placement until release is closed
+type blockingTrader struct {
+	bitso.Trader
+	placing 	chan bool
+	release 	chan bool
+}
+
+func (bt *blockingTrader) PlaceOrder(order bitso.OrderRequest) (string, error) {
+	bt.placing <- true
+	<-bt.release
+	return bt.Trader.PlaceOrder(order)
+}
+
+func TestConditionalOrdersClose(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	trader := &blockingTrader{Trader: server.Client(), placing: make(chan bool, 2), release: make(chan bool)}
+	conditional := bitso.NewConditionalOrders(trader)
+	triggered := make(chan bitso.TriggeredOrder, 2)
+	conditional.OnTrigger(func(o bitso.TriggeredOrder) { triggered <- o })
+
+	firstId, _ := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "800000"))
+	secondId, _ := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "790000"))
+	thirdId, _ := conditional.Add(stopLimit(bitso.TriggerKind_STOP_LOSS, bitso.Side_SELL, "700000"))
+
+	conditional.UpdatePrice("btc_mxn", d("789000"), d("790000"))
+	<-trader.placing
+
+	// Close waits for the placement in progress and ends the worker
+	closed := make(chan bool)
+	go func() {
+		conditional.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("closed during a placement")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(trader.release)
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the worker did not end")
+	}
+
+	if o := triggeredOrder(t, triggered); o.Conditional.Id != firstId || o.Error != nil {
+		t.Errorf("placed %s (%v), expecting %s", o.Conditional.Id, o.Error, firstId)
+	}
+
+	// the order waiting to be placed is pending again, and nothing triggers anymore
+	pending := conditional.Pending()
+	if len(pending) != 2 || pending[0].Id != secondId || pending[1].Id != thirdId {
+		t.Errorf("%v pending, expecting %s and %s", pending, secondId, thirdId)
+	}
+	conditional.UpdatePrice("btc_mxn", d("699000"), d("700000"))
+	select {
+	case o := <-triggered:
+		t.Errorf("order %s triggered after Close", o.Conditional.Id)
+	case <-trader.placing:
+		t.Error("order placed after Close")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conditional.Close()
+}
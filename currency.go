@@ -1,5 +1,11 @@
 package bitso
 
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
 type CurrencyCode string
 
 const (
@@ -76,3 +82,67 @@ func CurrencyList() map[CurrencyCode]Currency {
 		},
 	}
 }
+
+const (
+	// Bitso accepts amounts of 8 decimals in every book, unknown major currencies get at least this precision
+	DEFAULT_MAJOR_PRECISION = 8
+	// precision assumed for unknown minor currencies whose prices do not reveal it
+	DEFAULT_MINOR_PRECISION = 2
+)
+
+// decimalPlaces returns the number of decimals of d as written, ex. 5 for 0.00001 and 8 for 0.00001000
+func decimalPlaces(d decimal.Decimal) int {
+	if d.Exponent() >= 0 {
+		return 0
+	}
+	return int(-d.Exponent())
+}
+
+// inferMajorCurrency guesses a currency that is not in CurrencyList from the amounts of a book where it's the major
+func inferMajorCurrency(code CurrencyCode, raw PublicAvailableBooksPayload) Currency {
+	precision := decimalPlaces(raw.MinimumAmount)
+	if p := decimalPlaces(raw.MaximumAmount); p > precision {
+		precision = p
+	}
+	if precision < DEFAULT_MAJOR_PRECISION {
+		precision = DEFAULT_MAJOR_PRECISION
+	}
+
+	return Currency{
+		Code: code,
+		Name: strings.ToUpper(string(code)),
+		Precision: precision,
+	}
+}
+
+// inferMinorCurrency guesses a currency that is not in CurrencyList from the tick size, or else the prices and
+// values, of a book where it's the minor
+func inferMinorCurrency(code CurrencyCode, raw PublicAvailableBooksPayload) Currency {
+	precision := 0
+	if raw.TickSize.IsPositive() {
+		precision = decimalPlaces(raw.TickSize)
+	} else {
+		for _, d := range []decimal.Decimal{raw.MinimumPrice, raw.MinimumValue} {
+			if p := decimalPlaces(d); p > precision {
+				precision = p
+			}
+		}
+	}
+	if precision == 0 {
+		precision = DEFAULT_MINOR_PRECISION
+	}
+
+	return Currency{
+		Code: code,
+		Name: strings.ToUpper(string(code)),
+		Precision: precision,
+	}
+}
+
+// mergeInferred keeps the finest precision of two guesses of the same currency, the zero Currency is ignored
+func mergeInferred(a, b Currency) Currency {
+	if a.Code == "" || b.Precision > a.Precision {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,561 @@
+package bitso
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type ExecutionStyle string
+
+const (
+	ExecutionStyle_TWAP 	ExecutionStyle = "twap"
+	ExecutionStyle_ICEBERG 	ExecutionStyle = "iceberg"
+)
+
+// DEFAULT_EXECUTION_POLL_INTERVAL is how often a started Execution reconciles its child orders and steps
+const DEFAULT_EXECUTION_POLL_INTERVAL = 2 * time.Second
+
+// ExecutionProgress is the state of the parent order of an Execution
+type ExecutionProgress struct {
+	Style 			ExecutionStyle
+	Book 			BookCode
+	Side 			Side
+	Amount 			decimal.Decimal // units: major
+	Filled 			decimal.Decimal // units: major
+	Remaining 		decimal.Decimal // units: major
+	FilledValue 	decimal.Decimal // units: minor
+	AveragePrice 	decimal.Decimal // zero before the first fill
+	Fees 			map[CurrencyCode]decimal.Decimal
+	Children 		int // child orders placed
+	Active 			string // oid of the working child order, if any
+	Done 			bool
+	Error 			error // why the execution stopped early
+	StartedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// Execution works a parent order through child orders, either sliced evenly over time (TWAP) or showing a small
+// clip of it at a time (iceberg). Children are placed through an OrderManager over a ThrottledTrader, sized within
+// the book limits, and cancelled and replaced when the price drifts away from them. Executions given the same
+// ThrottledTrader share it, so together they stay within the rate limits; any other Trader gets its own throttle.
+type Execution struct {
+	style 		ExecutionStyle
+	book 		Book
+	side 		Side
+	amount 		decimal.Decimal
+	limit 		decimal.Decimal // worst price accepted, zero for none
+	duration 	time.Duration // TWAP only
+	slices 		int // TWAP only
+	clip 		decimal.Decimal // iceberg only
+
+	throttle 	*ThrottledTrader
+	manager 	*OrderManager
+	logger 		Logger
+
+	mu 			sync.Mutex
+	top 		topOfBook
+	maxDrift 	decimal.Decimal // bps, zero disables cancel-replace
+	poll 		time.Duration
+
+	stepMu 		sync.Mutex // serializes the steps
+	started 	time.Time
+	children 	[]string // client ids
+	child 		string // client id of the working child
+	childSlice 	int
+	cancelling 	bool
+	stopping 	bool
+	progress 	ExecutionProgress
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(progress ExecutionProgress)
+
+	notifyMu 	sync.Mutex
+	emitted 	[]ExecutionProgress // waiting for the handlers, in order
+	notifying 	bool
+
+	done 		chan bool
+	doneOnce 	sync.Once
+}
+
+// NewTWAP returns an execution of amount (major) split in slices placed evenly over duration. Each slice is a limit
+// order at the best price of the other side, capped at limit, or a market order without limit nor prices. Whatever
+// a slice did not fill is cancelled and carried over to the next one.
+func NewTWAP(trader Trader, book Book, side Side, amount, limit decimal.Decimal, duration time.Duration, slices int) (*Execution, error) {
+	if slices < 1 {
+		return nil, fmt.Errorf("twap needs at least one slice")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("twap duration must be positive")
+	}
+	if slice := book.RoundAmount(amount.Div(decimal.NewFromInt(int64(slices)))); slice.LessThan(book.MinimumAmount) {
+		return nil, fmt.Errorf("twap slices of %s are below the minimum amount of %s", slice, book.MinimumAmount)
+	}
+
+	e := newExecution(ExecutionStyle_TWAP, trader, book, side, amount, limit)
+	e.duration = duration
+	e.slices = slices
+
+	return e, nil
+}
+
+// NewIceberg returns an execution of amount (major) showing at most clip at a time, as a limit order at the best
+// price of its own side of the book, capped at limit, or at limit while the book is unknown
+func NewIceberg(trader Trader, book Book, side Side, amount, limit, clip decimal.Decimal) (*Execution, error) {
+	if clip.LessThan(book.MinimumAmount) {
+		return nil, fmt.Errorf("iceberg clip of %s is below the minimum amount of %s", clip, book.MinimumAmount)
+	}
+	if clip.GreaterThan(amount) {
+		return nil, fmt.Errorf("iceberg clip of %s is above the amount of %s", clip, amount)
+	}
+
+	e := newExecution(ExecutionStyle_ICEBERG, trader, book, side, amount, limit)
+	e.clip = clip
+
+	return e, nil
+}
+
+func newExecution(style ExecutionStyle, trader Trader, book Book, side Side, amount, limit decimal.Decimal) *Execution {
+	amount = book.RoundAmount(amount)
+
+	throttle, ok := trader.(*ThrottledTrader)
+	if !ok {
+		throttle = NewThrottledTrader(trader, DEFAULT_REQUEST_INTERVAL)
+	}
+
+	return &Execution{
+		style: style,
+		book: book,
+		side: side,
+		amount: amount,
+		limit: limit,
+		throttle: throttle,
+		manager: NewOrderManager(throttle),
+		logger: NopLogger(),
+		poll: DEFAULT_EXECUTION_POLL_INTERVAL,
+		progress: ExecutionProgress{
+			Style: style,
+			Book: book.BookCode,
+			Side: side,
+			Amount: amount,
+			Remaining: amount,
+			Fees: make(map[CurrencyCode]decimal.Decimal),
+		},
+		done: make(chan bool),
+	}
+}
+
+func (e *Execution) SetLogger(logger Logger) {
+	e.stepMu.Lock()
+	defer e.stepMu.Unlock()
+
+	e.logger = logger
+	e.manager.SetLogger(logger)
+}
+
+// SetMaxDrift cancels and replaces the working child once the price moves more than bps away from it
+func (e *Execution) SetMaxDrift(bps decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.maxDrift = bps
+}
+
+// SetRequestInterval spaces the requests to the Trader, DEFAULT_REQUEST_INTERVAL by default. Lower it only when the
+// Trader is not rate limited, ex. a paper.Trader. A shared ThrottledTrader is changed for every one using it.
+func (e *Execution) SetRequestInterval(interval time.Duration) {
+	e.throttle.SetInterval(interval)
+}
+
+// SetPollInterval sets how often Start steps the execution, DEFAULT_EXECUTION_POLL_INTERVAL by default
+func (e *Execution) SetPollInterval(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.poll = interval
+}
+
+// OnProgress registers a handler called whenever a child is placed, a fill is received or the execution ends. The
+// handlers are called in order, outside of the steps, so they may call the methods of the Execution.
+func (e *Execution) OnProgress(handler func(progress ExecutionProgress)) {
+	e.handlersMu.Lock()
+	defer e.handlersMu.Unlock()
+
+	e.handlers = append(e.handlers, handler)
+}
+
+// Attach keeps the top of the book up to date from the Orders channel of a websocket, the caller still has to
+// subscribe to it
+func (e *Execution) Attach(ws *Websocket) {
+	ws.OnOrders(e.UpdateOrders)
+	e.manager.Attach(ws)
+}
+
+// UpdateOrders takes the top of the book from an Orders snapshot, other books are ignored
+func (e *Execution) UpdateOrders(book BookCode, orders Orders) {
+	if book != e.book.BookCode {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.top = newTopOfBook(orders)
+}
+
+// UpdateTop sets the best bid and ask of the book, a zero rate means that side of the book is empty
+func (e *Execution) UpdateTop(bid, ask decimal.Decimal) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.top = topOfBook{bid: Offer{Rate: bid, Side: Side_BUY}, ask: Offer{Rate: ask, Side: Side_SELL}}
+}
+
+// Start steps the execution every poll interval until it is done
+func (e *Execution) Start() {
+	e.mu.Lock()
+	poll := e.poll
+	e.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+
+		for {
+			e.Step(time.Now())
+
+			select {
+			case <-ticker.C:
+			case <-e.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop places no more children, cancels the working one, if any, and ends the execution with whatever was filled
+// once the child is confirmed final. Until then it returns an error with the oid of the child still open, and the
+// following steps, or calls to Stop, keep trying.
+func (e *Execution) Stop() error {
+	e.stepMu.Lock()
+	defer e.release()
+
+	if e.progress.Done {
+		return nil
+	}
+
+	e.stopping = true
+	return e.stop(time.Now())
+}
+
+// stop cancels the working child and finishes once it is final. Must be called with the step lock held.
+func (e *Execution) stop(now time.Time) error {
+	if e.child != "" && !e.cancelling {
+		if err := e.manager.Cancel(e.child); err != nil {
+			e.logger.Log(LogLevel_WARN, "cannot cancel child order", Field("id", e.child), Field("error", err))
+		} else {
+			e.cancelling = true
+		}
+	}
+	if len(e.children) > 0 {
+		if err := e.manager.Reconcile(); err != nil {
+			e.logger.Log(LogLevel_WARN, "child order reconciliation failed", Field("error", err))
+		}
+	}
+
+	changed := e.update(now)
+
+	if e.child != "" {
+		if o, ok := e.manager.Order(e.child); ok && !o.State.IsFinal() {
+			if changed {
+				e.emit()
+			}
+			return fmt.Errorf("child order %s is still open", o.Oid)
+		}
+	}
+
+	e.child = ""
+	e.cancelling = false
+	e.finish(nil)
+
+	return nil
+}
+
+// Wait blocks until the execution is done and returns its final progress
+func (e *Execution) Wait() ExecutionProgress {
+	<-e.done
+	return e.Progress()
+}
+
+func (e *Execution) Progress() ExecutionProgress {
+	e.stepMu.Lock()
+	defer e.stepMu.Unlock()
+
+	return e.copyProgress()
+}
+
+// copyProgress must be called with the step lock held
+func (e *Execution) copyProgress() ExecutionProgress {
+	p := e.progress
+	p.Fees = make(map[CurrencyCode]decimal.Decimal, len(e.progress.Fees))
+	for currency, fee := range e.progress.Fees {
+		p.Fees[currency] = fee
+	}
+	return p
+}
+
+// Step reconciles the child orders and places, cancels or replaces the working child as due at the given time.
+// Start calls it periodically, strategies driven by a clock (ex. backtests with a paper.Trader) can call it instead.
+func (e *Execution) Step(now time.Time) {
+	e.stepMu.Lock()
+	defer e.release()
+
+	if e.progress.Done {
+		return
+	}
+
+	if e.stopping {
+		e.stop(now)
+		return
+	}
+
+	if e.started.IsZero() {
+		e.started = now
+		e.progress.StartedAt = now
+	}
+
+	if len(e.children) > 0 {
+		if err := e.manager.Reconcile(); err != nil {
+			e.logger.Log(LogLevel_WARN, "child order reconciliation failed", Field("error", err))
+			return
+		}
+	}
+
+	changed := e.update(now)
+
+	if e.child != "" {
+		if o, ok := e.manager.Order(e.child); ok && o.State.IsFinal() {
+			e.child = ""
+			e.cancelling = false
+		}
+	}
+
+	if e.child == "" && e.progress.Remaining.LessThan(e.book.MinimumAmount) {
+		e.finish(nil)
+		return
+	}
+
+	target, slice := e.target(now)
+	price := e.price()
+
+	if e.child != "" {
+		if !e.cancelling && e.stale(slice, price) {
+			if err := e.manager.Cancel(e.child); err != nil {
+				e.logger.Log(LogLevel_WARN, "cannot cancel child order", Field("id", e.child), Field("error", err))
+			} else {
+				e.cancelling = true
+			}
+		}
+		if changed {
+			e.emit()
+		}
+		return
+	}
+
+	amount := e.book.RoundAmount(decimal.Min(target, e.progress.Remaining))
+
+	value := amount.Mul(price)
+	if amount.LessThan(e.book.MinimumAmount) || (price.IsPositive() && value.LessThan(e.book.MinimumValue)) {
+		if target.GreaterThanOrEqual(e.progress.Remaining) {
+			// the whole remainder is due and too small to place
+			e.finish(nil)
+		} else if changed {
+			e.emit()
+		}
+		return
+	}
+
+	req := OrderRequest{Book: e.book.BookCode, Side: e.side, Type: OrderType_LIMIT, Major: amount, Price: price}
+	if !price.IsPositive() {
+		if e.style == ExecutionStyle_ICEBERG {
+			// an iceberg needs a price to rest at, wait for the book
+			return
+		}
+		req.Type = OrderType_MARKET
+		req.Price = decimal.Zero
+	}
+
+	o, err := e.manager.Submit(req)
+	if err != nil {
+		e.finish(err)
+		return
+	}
+
+	e.children = append(e.children, o.ClientId)
+	e.child = o.ClientId
+	e.childSlice = slice
+	e.update(now)
+	e.emit()
+}
+
+// target returns the amount the working child should have and the current TWAP slice. Must be called with the
+// step lock held.
+func (e *Execution) target(now time.Time) (decimal.Decimal, int) {
+	if e.style == ExecutionStyle_ICEBERG {
+		return e.clip, 0
+	}
+
+	slice := e.slices
+	if elapsed := now.Sub(e.started); elapsed < e.duration {
+		slice = int(elapsed * time.Duration(e.slices) / e.duration) + 1
+	}
+
+	// amount due by the end of the slice, minus what was already filled
+	due := e.amount.Mul(decimal.NewFromInt(int64(slice))).Div(decimal.NewFromInt(int64(e.slices)))
+	return due.Sub(e.progress.Filled), slice
+}
+
+// price returns the price of the next child, zero when there is none
+func (e *Execution) price() decimal.Decimal {
+	e.mu.Lock()
+	top := e.top
+	e.mu.Unlock()
+
+	// TWAP takes the other side of the book, iceberg rests on its own side
+	var price decimal.Decimal
+	if (e.style == ExecutionStyle_TWAP) == (e.side == Side_BUY) {
+		price = top.ask.Rate
+	} else {
+		price = top.bid.Rate
+	}
+
+	if e.limit.IsPositive() {
+		if !price.IsPositive() || (e.side == Side_BUY && price.GreaterThan(e.limit)) || (e.side == Side_SELL && price.LessThan(e.limit)) {
+			price = e.limit
+		}
+	}
+
+	return e.book.RoundPrice(e.side, price)
+}
+
+// stale reports whether the working child belongs to a past TWAP slice or drifted from the price. Must be called
+// with the step lock held.
+func (e *Execution) stale(slice int, price decimal.Decimal) bool {
+	if e.style == ExecutionStyle_TWAP && slice > e.childSlice {
+		return true
+	}
+
+	e.mu.Lock()
+	maxDrift := e.maxDrift
+	e.mu.Unlock()
+
+	o, ok := e.manager.Order(e.child)
+	if !ok || !maxDrift.IsPositive() || !price.IsPositive() || o.Request.Type != OrderType_LIMIT {
+		return false
+	}
+
+	drift := price.Sub(o.Request.Price).Abs().Div(o.Request.Price).Mul(bpsPerUnit)
+	return drift.GreaterThan(maxDrift)
+}
+
+// update sums the fills of the children, and returns whether they changed. Must be called with the step lock held.
+func (e *Execution) update(now time.Time) bool {
+	filled := decimal.Zero
+	value := decimal.Zero
+	fees := make(map[CurrencyCode]decimal.Decimal)
+
+	for _, id := range e.children {
+		o, ok := e.manager.Order(id)
+		if !ok {
+			continue
+		}
+		filled = filled.Add(o.Filled)
+		value = value.Add(o.FilledValue)
+		for currency, fee := range o.Fees {
+			fees[currency] = fees[currency].Add(fee)
+		}
+	}
+
+	active := ""
+	if e.child != "" {
+		if o, ok := e.manager.Order(e.child); ok && !o.State.IsFinal() {
+			active = o.Oid
+		}
+	}
+
+	changed := !filled.Equal(e.progress.Filled) || active != e.progress.Active
+
+	e.progress.Filled = filled
+	e.progress.FilledValue = value
+	e.progress.Remaining = e.amount.Sub(filled)
+	e.progress.Fees = fees
+	e.progress.Children = len(e.children)
+	e.progress.Active = active
+	e.progress.UpdatedAt = now
+	if filled.IsPositive() {
+		e.progress.AveragePrice = value.Div(filled).Round(int32(e.book.Minor.Precision))
+	}
+
+	return changed
+}
+
+// finish must be called with the step lock held
+func (e *Execution) finish(err error) {
+	e.progress.Done = true
+	e.progress.Error = err
+	e.progress.Active = ""
+
+	if err != nil {
+		e.logger.Log(LogLevel_WARN, "execution stopped", Field("book", e.book.BookCode), Field("error", err))
+	}
+
+	e.emit()
+
+	e.doneOnce.Do(func() {
+		close(e.done)
+	})
+}
+
+// emit queues the progress for the handlers, called once the step lock is released. Must be called with the step
+// lock held.
+func (e *Execution) emit() {
+	e.notifyMu.Lock()
+	defer e.notifyMu.Unlock()
+
+	e.emitted = append(e.emitted, e.copyProgress())
+}
+
+// release unlocks the step lock and calls the handlers with the emitted progress. A release while the handlers are
+// being called, from one of them for instance, leaves its progress to that one, so they are always called in order.
+func (e *Execution) release() {
+	e.stepMu.Unlock()
+
+	e.notifyMu.Lock()
+	if e.notifying {
+		e.notifyMu.Unlock()
+		return
+	}
+	e.notifying = true
+
+	for len(e.emitted) > 0 {
+		progress := e.emitted[0]
+		e.emitted = e.emitted[1:]
+		e.notifyMu.Unlock()
+
+		e.handlersMu.RLock()
+		handlers := make([]func(progress ExecutionProgress), len(e.handlers))
+		copy(handlers, e.handlers)
+		e.handlersMu.RUnlock()
+
+		for _, h := range handlers {
+			h(progress)
+		}
+
+		e.notifyMu.Lock()
+	}
+
+	e.notifying = false
+	e.notifyMu.Unlock()
+}
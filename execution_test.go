@@ -0,0 +1,350 @@
+package bitso_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/paper"
+	"github.com/shopspring/decimal"
+)
+
+var btcMxn = bitso.Book{
+	BookCode: bitso.BookCode_BTC_MXN,
+	Major: bitso.CurrencyList()[bitso.CurrencyCode_BTC],
+	Minor: bitso.CurrencyList()[bitso.CurrencyCode_MXN],
+	MinimumAmount: d("0.00001"),
+	MaximumAmount: d("500"),
+	MinimumPrice: d("1"),
+	MaximumPrice: d("10000000"),
+	MinimumValue: d("10"),
+	MaximumValue: d("10000000"),
+}
+
+// paperTrader returns a paper.Trader on a simulated clock, far from the local one
+func paperTrader(now *time.Time) *paper.Trader {
+	trader := paper.NewTrader(
+		map[bitso.BookCode]bitso.Book{btcMxn.BookCode: btcMxn},
+		map[bitso.BookCode]bitso.Fee{btcMxn.BookCode: {BookCode: btcMxn.BookCode, TakerFeeDecimal: d("0.0065"), MakerFeeDecimal: d("0.005")}},
+		map[bitso.CurrencyCode]decimal.Decimal{bitso.CurrencyCode_MXN: d("1000000"), bitso.CurrencyCode_BTC: d("1")},
+	)
+	trader.SetClock(func() time.Time { return *now })
+
+	return trader
+}
+
+func setTop(trader *paper.Trader, e *bitso.Execution, bid, ask string) {
+	orders := bitso.Orders{
+		Bids: []bitso.Offer{{Rate: d(bid), Amount: d("10")}},
+		Asks: []bitso.Offer{{Rate: d(ask), Amount: d("10")}},
+	}
+	trader.UpdateOrders(btcMxn.BookCode, orders)
+	e.UpdateOrders(btcMxn.BookCode, orders)
+}
+
+func TestTWAPExecution(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := paperTrader(&now)
+
+	e, err := bitso.NewTWAP(trader, btcMxn, bitso.Side_BUY, d("0.4"), decimal.Zero, 4 * time.Minute, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+
+	// the first slice fills at 900000, the rest at 910000
+	start := now
+	for i, ask := range []string{"900000", "910000", "910000", "910000"} {
+		setTop(trader, e, "899000", ask)
+
+		now = start.Add(time.Duration(i) * time.Minute)
+		e.Step(now)
+		if p := e.Progress(); p.Children != i + 1 {
+			t.Fatalf("%d children placed in slice %d", p.Children, i + 1)
+		}
+
+		now = now.Add(time.Second)
+		e.Step(now)
+	}
+
+	p := e.Progress()
+	if !p.Done || p.Error != nil {
+		t.Fatalf("execution done: %v (%v), expecting done", p.Done, p.Error)
+	}
+	if !p.Filled.Equal(d("0.4")) || !p.Remaining.IsZero() || !p.FilledValue.Equal(d("363000")) {
+		t.Errorf("filled %s for %s with %s remaining, expecting 0.4 for 363000", p.Filled, p.FilledValue, p.Remaining)
+	}
+	if !p.AveragePrice.Equal(d("907500")) {
+		t.Errorf("average price %s, expecting 907500", p.AveragePrice)
+	}
+	if fee := p.Fees[bitso.CurrencyCode_BTC]; !fee.Equal(d("0.0026")) {
+		t.Errorf("fees of %s BTC, expecting 0.0026", fee)
+	}
+}
+
+func TestIcebergExecution(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := paperTrader(&now)
+
+	e, err := bitso.NewIceberg(trader, btcMxn, bitso.Side_SELL, d("0.3"), decimal.Zero, d("0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+	setTop(trader, e, "899000", "900000")
+
+	printed := func(amount string) {
+		trader.UpdateTrades(btcMxn.BookCode, []bitso.Trade{{Amount: d(amount), Rate: d("900000"), Side: bitso.Side_SELL}})
+		now = now.Add(time.Second)
+		e.Step(now)
+	}
+
+	e.Step(now)
+
+	tests := []struct {
+		printed 	string
+		filled 		string
+		children 	int
+	}{
+		{"0.05", "0.05", 1},
+		{"0.05", "0.1", 2}, // the clip filled, the next one shows
+		{"0.2", "0.2", 3}, // only the clip showing fills
+		{"0.1", "0.3", 3},
+	}
+
+	for _, tt := range tests {
+		printed(tt.printed)
+
+		p := e.Progress()
+		if !p.Filled.Equal(d(tt.filled)) || p.Children != tt.children {
+			t.Errorf("filled %s with %d children, expecting %s with %d", p.Filled, p.Children, tt.filled, tt.children)
+		}
+	}
+
+	p := e.Progress()
+	if !p.Done || !p.AveragePrice.Equal(d("900000")) || !p.FilledValue.Equal(d("270000")) {
+		t.Errorf("done %v at %s for %s, expecting done at 900000 for 270000", p.Done, p.AveragePrice, p.FilledValue)
+	}
+}
+
+// openPrices returns the prices of the open orders of the paper trader
+func openPrices(t *testing.T, trader *paper.Trader) []string {
+	t.Helper()
+
+	orders, err := trader.OpenOrders(btcMxn.BookCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prices := make([]string, 0, len(orders))
+	for _, o := range orders {
+		prices = append(prices, o.Price.String())
+	}
+	return prices
+}
+
+func TestExecutionCancelReplace(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := paperTrader(&now)
+
+	e, err := bitso.NewIceberg(trader, btcMxn, bitso.Side_SELL, d("0.3"), decimal.Zero, d("0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+	e.SetMaxDrift(d("25"))
+
+	tests := []struct {
+		name 		string
+		ask 		string
+		children 	int
+		prices 		[]string
+	}{
+		{"first clip", "900000", 1, []string{"900000"}},
+		{"within the drift", "900400", 1, []string{"900000"}},
+		{"replaced", "910000", 2, []string{"910000"}},
+	}
+
+	for _, tt := range tests {
+		setTop(trader, e, "899000", tt.ask)
+
+		// cancelling takes a step and replacing the next one
+		for i := 0; i < 3; i++ {
+			now = now.Add(time.Second)
+			e.Step(now)
+		}
+
+		if p := e.Progress(); p.Children != tt.children {
+			t.Errorf("%s: %d children, expecting %d", tt.name, p.Children, tt.children)
+		}
+		if prices := openPrices(t, trader); fmt.Sprint(prices) != fmt.Sprint(tt.prices) {
+			t.Errorf("%s: open at %v, expecting %v", tt.name, prices, tt.prices)
+		}
+	}
+}
+
+func TestExecutionStop(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := paperTrader(&now)
+
+	// capped below the ask, the child rests
+	e, err := bitso.NewTWAP(trader, btcMxn, bitso.Side_BUY, d("0.1"), d("800000"), time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+	setTop(trader, e, "899000", "900000")
+
+	e.Step(now)
+	if prices := openPrices(t, trader); fmt.Sprint(prices) != "[800000]" {
+		t.Fatalf("open at %v, expecting the limit of 800000", prices)
+	}
+
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if prices := openPrices(t, trader); len(prices) != 0 {
+		t.Errorf("open at %v after stopping, expecting the child cancelled", prices)
+	}
+
+	p := e.Wait()
+	if !p.Done || p.Error != nil || !p.Filled.IsZero() || p.Active != "" {
+		t.Errorf("done %v (%v) with %s filled and %q active, expecting done with nothing", p.Done, p.Error, p.Filled, p.Active)
+	}
+
+	e.Step(now.Add(time.Minute))
+	if p := e.Progress(); p.Children != 1 {
+		t.Errorf("%d children after stopping, expecting 1", p.Children)
+	}
+}
+
+func TestExecutionHandlersCallBack(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := paperTrader(&now)
+
+	e, err := bitso.NewIceberg(trader, btcMxn, bitso.Side_SELL, d("0.3"), decimal.Zero, d("0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+	setTop(trader, e, "899000", "900000")
+
+	// the first progress stops the execution from the handler
+	received := make([]bitso.ExecutionProgress, 0)
+	e.OnProgress(func(p bitso.ExecutionProgress) {
+		received = append(received, p)
+		if current := e.Progress(); current.Children != 1 {
+			t.Errorf("%d children from the handler, expecting 1", current.Children)
+		}
+		if len(received) == 1 {
+			e.SetLogger(bitso.NopLogger())
+			e.Stop()
+		}
+	})
+
+	stepped := make(chan bool)
+	go func() {
+		e.Step(now)
+		close(stepped)
+	}()
+	select {
+	case <-stepped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("deadlocked calling the execution from its handler")
+	}
+
+	if len(received) != 2 || received[0].Done || received[0].Active == "" || !received[1].Done {
+		t.Errorf("received %v, expecting the child placed and then done", received)
+	}
+}
+
+// uncancellableTrader fails the first cancellations
+type uncancellableTrader struct {
+	*paper.Trader
+	failures 	int
+}
+
+func (ut *uncancellableTrader) CancelOrder(oid string) error {
+	if ut.failures > 0 {
+		ut.failures--
+		return fmt.Errorf("connection reset")
+	}
+	return ut.Trader.CancelOrder(oid)
+}
+
+func TestExecutionStopWaitsForTheChild(t *testing.T) {
+	now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+	trader := &uncancellableTrader{Trader: paperTrader(&now), failures: 1}
+
+	e, err := bitso.NewTWAP(trader, btcMxn, bitso.Side_BUY, d("0.1"), d("800000"), time.Minute, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetRequestInterval(0)
+	setTop(trader.Trader, e, "799000", "900000")
+	e.Step(now)
+
+	if err := e.Stop(); err == nil {
+		t.Fatal("stopped with the child still open")
+	}
+	if p := e.Progress(); p.Done || p.Active == "" {
+		t.Fatalf("done %v with %q active, expecting the child still open", p.Done, p.Active)
+	}
+
+	// the child fills while the cancellation is retried
+	trader.UpdateTrades(btcMxn.BookCode, []bitso.Trade{{Amount: d("0.04"), Rate: d("800000"), Side: bitso.Side_BUY}})
+	e.Step(now.Add(time.Second))
+
+	p := e.Progress()
+	if !p.Done || !p.Filled.Equal(d("0.04")) || p.Active != "" || p.Children != 1 {
+		t.Errorf("done %v with %s filled, %q active and %d children, expecting done with 0.04 and no new child", p.Done, p.Filled, p.Active, p.Children)
+	}
+	if prices := openPrices(t, trader.Trader); len(prices) != 0 {
+		t.Errorf("open at %v, expecting the child cancelled", prices)
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		name 		string
+		side 		bitso.Side
+		amount 		string
+		limit 		string
+		slices 		int
+		prices 		[]string // open after each step, a minute apart
+		done 		bool
+	}{
+		// filled as taker, the next step finds it done
+		{"buy at the ask", bitso.Side_BUY, "0.1", "0", 1, []string{"", ""}, true},
+		{"sell capped at the limit", bitso.Side_SELL, "0.1", "905000", 1, []string{"905000"}, false},
+		// 0.00001 at 900000 is below the minimum value of 10
+		{"remainder below the minimum value", bitso.Side_BUY, "0.00001", "0", 1, []string{""}, true},
+		{"slice below the minimum value", bitso.Side_BUY, "0.00002", "800000", 2, []string{"", "800000"}, false},
+	}
+
+	for _, tt := range tests {
+		now := time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)
+		trader := paperTrader(&now)
+
+		e, err := bitso.NewTWAP(trader, btcMxn, tt.side, d(tt.amount), d(tt.limit), time.Duration(tt.slices) * time.Minute, tt.slices)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		e.SetRequestInterval(0)
+		setTop(trader, e, "899000", "900000")
+
+		for i, expected := range tt.prices {
+			e.Step(now.Add(time.Duration(i) * time.Minute))
+
+			prices := openPrices(t, trader)
+			if (expected == "" && len(prices) != 0) || (expected != "" && fmt.Sprint(prices) != "[" + expected + "]") {
+				t.Errorf("%s: open at %v after step %d, expecting %q", tt.name, prices, i + 1, expected)
+			}
+		}
+
+		if p := e.Progress(); p.Done != tt.done {
+			t.Errorf("%s: done %v, expecting %v", tt.name, p.Done, tt.done)
+		}
+	}
+}
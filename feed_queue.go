@@ -0,0 +1,258 @@
+package bitso
+
+import "sync"
+
+// OverflowPolicy decides what happens to an incoming message when the feed queue is full
+type OverflowPolicy int
+
+const (
+	OverflowPolicy_DISCONNECT 	OverflowPolicy = iota // drop the connection, the consumer is not responding (default)
+	OverflowPolicy_BLOCK 								// wait until the consumer frees a slot, stalls the websocket reader (not counted as staleness)
+	OverflowPolicy_DROP_OLDEST 							// discard the oldest queued message to make room
+	OverflowPolicy_DROP_NEWEST 							// discard the incoming message
+	OverflowPolicy_COALESCE 							// replace the queued Orders message of the same book, otherwise drop the oldest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowPolicy_DISCONNECT:
+		return "DISCONNECT"
+	case OverflowPolicy_BLOCK:
+		return "BLOCK"
+	case OverflowPolicy_DROP_OLDEST:
+		return "DROP_OLDEST"
+	case OverflowPolicy_DROP_NEWEST:
+		return "DROP_NEWEST"
+	case OverflowPolicy_COALESCE:
+		return "COALESCE"
+	default:
+		return ""
+	}
+}
+
+// FeedStats is a snapshot of the feed queue counters
+type FeedStats struct {
+	Depth 		int 	// messages currently waiting for the consumer
+	Capacity 	int
+	Delivered 	uint64
+	Dropped 	uint64
+	Coalesced 	uint64 	// Orders messages replaced by a newer snapshot of the same book
+
+	DroppedByChannel map[Channel]uint64
+}
+
+// feedQueue is a bounded FIFO between the websocket reader and the consumer. A pump goroutine moves messages
+// from the queue to the unbuffered 'out' channel, which lets the queue apply an overflow policy that a plain
+// buffered channel cannot (ex. replacing a message that is already queued).
+type feedQueue struct {
+	mu 			sync.Mutex
+	cond 		*sync.Cond
+
+	items 		[]FeedMessage
+	size 		int
+	policy 		OverflowPolicy
+
+	out 		chan FeedMessage
+	done 		chan bool
+	startOnce 	sync.Once
+	closeOnce 	sync.Once
+	closed 		bool
+
+	delivered 	uint64
+	dropped 	uint64
+	coalesced 	uint64
+	droppedBy 	map[Channel]uint64
+
+	// notified, with the lock held, of every dropped message and of the depth after every enqueue
+	metrics 	Metrics
+}
+
+func newFeedQueue(size int, policy OverflowPolicy) *feedQueue {
+	if size < 1 {
+		size = 1
+	}
+
+	q := &feedQueue{
+		items: make([]FeedMessage, 0, size),
+		size: size,
+		policy: policy,
+		out: make(chan FeedMessage),
+		done: make(chan bool),
+		droppedBy: make(map[Channel]uint64),
+		metrics: NopMetrics(),
+	}
+	q.cond = sync.NewCond(&q.mu)
+
+	return q
+}
+
+// setMetrics replaces the Metrics notified of the dropped messages and the queue depth
+func (q *feedQueue) setMetrics(metrics Metrics) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.metrics = metrics
+}
+
+// start launches the pump that delivers the queued messages to 'out', only the first call has any effect
+func (q *feedQueue) start() {
+	q.startOnce.Do(func() {
+		go q.pump()
+	})
+}
+
+// push enqueues a message applying the overflow policy, it returns false only when the queue is full and the
+// policy is DISCONNECT, in which case the caller is expected to drop the connection.
+func (q *feedQueue) push(m FeedMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return true
+	}
+
+	if len(q.items) < q.size {
+		q.append(m)
+		return true
+	}
+
+	switch q.policy {
+	case OverflowPolicy_BLOCK:
+		for len(q.items) >= q.size && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			return true
+		}
+		q.append(m)
+
+	case OverflowPolicy_DROP_OLDEST:
+		q.drop(q.items[0])
+		q.items = q.items[1:]
+		q.append(m)
+
+	case OverflowPolicy_DROP_NEWEST:
+		q.drop(m)
+
+	case OverflowPolicy_COALESCE:
+		if m.Channel == Channel_ORDERS {
+			for i, queued := range q.items {
+				if queued.Channel == Channel_ORDERS && queued.Book == m.Book {
+					// a newer Orders snapshot supersedes the queued one, keep its place in the queue
+					q.items[i] = m
+					q.coalesced++
+					return true
+				}
+			}
+		}
+		q.drop(q.items[0])
+		q.items = q.items[1:]
+		q.append(m)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// pushForce enqueues a message ignoring the size limit, used for the final Disconnected notification which
+// must never be dropped
+func (q *feedQueue) pushForce(m FeedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+
+	q.append(m)
+}
+
+// must be called with the lock held
+func (q *feedQueue) append(m FeedMessage) {
+	q.items = append(q.items, m)
+	q.cond.Broadcast()
+
+	q.metrics.ObserveQueueDepth(len(q.items))
+}
+
+// must be called with the lock held
+func (q *feedQueue) drop(m FeedMessage) {
+	q.dropped++
+	q.droppedBy[m.Channel]++
+
+	q.metrics.ObserveDropped(m.Channel, m.Book)
+}
+
+func (q *feedQueue) pump() {
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		m := q.items[0]
+		q.items = q.items[1:]
+		// a slot was freed, wake up any blocked push
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		select {
+		case q.out <- m:
+		case <-q.done:
+			return
+		}
+
+		q.mu.Lock()
+		q.delivered++
+		q.mu.Unlock()
+
+		if m.Channel == Channel_DISCONNECTED {
+			// nothing else will be sent after the disconnection
+			q.close()
+			return
+		}
+	}
+}
+
+// close stops the pump and releases any blocked push, queued messages are discarded
+func (q *feedQueue) close() {
+	q.closeOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		close(q.done)
+	})
+}
+
+func (q *feedQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func (q *feedQueue) stats() FeedStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	droppedBy := make(map[Channel]uint64)
+	for c, n := range q.droppedBy {
+		droppedBy[c] = n
+	}
+
+	return FeedStats{
+		Depth: len(q.items),
+		Capacity: q.size,
+		Delivered: q.delivered,
+		Dropped: q.dropped,
+		Coalesced: q.coalesced,
+		DroppedByChannel: droppedBy,
+	}
+}
@@ -0,0 +1,202 @@
+package bitso
+
+import (
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, q *feedQueue) FeedMessage {
+	t.Helper()
+
+	select {
+	case m := <-q.out:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return FeedMessage{}
+	}
+}
+
+// fill pushes the first message and waits until the pump holds it, then queues the rest of them
+func fill(t *testing.T, q *feedQueue, messages ...FeedMessage) {
+	t.Helper()
+
+	for i, m := range messages {
+		if !q.push(m) {
+			t.Fatalf("push of %v failed", m)
+		}
+
+		if i == 0 {
+			deadline := time.Now().Add(time.Second)
+			for q.depth() != 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("the pump did not take the first message")
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+}
+
+func TestFeedQueueOverflow(t *testing.T) {
+	trades := func(seq int64) FeedMessage {
+		return FeedMessage{Channel: Channel_TRADES, Book: "btc_mxn", Sequence: seq}
+	}
+	orders := func(book BookCode, seq int64) FeedMessage {
+		return FeedMessage{Channel: Channel_ORDERS, Book: book, Sequence: seq}
+	}
+
+	tests := []struct {
+		name 		string
+		policy 		OverflowPolicy
+		queued 		[]FeedMessage // the first one is held by the pump, the rest fill the queue of size 2
+		incoming 	FeedMessage
+		ok 			bool
+		expected 	[]int64 // sequences received, in order
+		dropped 	uint64
+		coalesced 	uint64
+	}{
+		{
+			name: "disconnect",
+			policy: OverflowPolicy_DISCONNECT,
+			queued: []FeedMessage{trades(1), trades(2), trades(3)},
+			incoming: trades(4),
+			ok: false,
+			expected: []int64{1, 2, 3},
+		},
+		{
+			name: "drop oldest",
+			policy: OverflowPolicy_DROP_OLDEST,
+			queued: []FeedMessage{trades(1), trades(2), trades(3)},
+			incoming: trades(4),
+			ok: true,
+			expected: []int64{1, 3, 4},
+			dropped: 1,
+		},
+		{
+			name: "drop newest",
+			policy: OverflowPolicy_DROP_NEWEST,
+			queued: []FeedMessage{trades(1), trades(2), trades(3)},
+			incoming: trades(4),
+			ok: true,
+			expected: []int64{1, 2, 3},
+			dropped: 1,
+		},
+		{
+			name: "coalesce orders of the same book",
+			policy: OverflowPolicy_COALESCE,
+			queued: []FeedMessage{trades(1), orders("btc_mxn", 2), trades(3)},
+			incoming: orders("btc_mxn", 4),
+			ok: true,
+			expected: []int64{1, 4, 3},
+			coalesced: 1,
+		},
+		{
+			name: "coalesce falls back to drop oldest",
+			policy: OverflowPolicy_COALESCE,
+			queued: []FeedMessage{trades(1), orders("btc_mxn", 2), trades(3)},
+			incoming: orders("eth_mxn", 4),
+			ok: true,
+			expected: []int64{1, 3, 4},
+			dropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newFeedQueue(2, tt.policy)
+			q.start()
+			defer q.close()
+
+			fill(t, q, tt.queued...)
+
+			if ok := q.push(tt.incoming); ok != tt.ok {
+				t.Fatalf("push returned %v, expecting %v", ok, tt.ok)
+			}
+
+			for _, seq := range tt.expected {
+				if m := receive(t, q); m.Sequence != seq {
+					t.Errorf("received sequence %d, expecting %d", m.Sequence, seq)
+				}
+			}
+
+			stats := q.stats()
+			if stats.Dropped != tt.dropped {
+				t.Errorf("dropped %d, expecting %d", stats.Dropped, tt.dropped)
+			}
+			if stats.Coalesced != tt.coalesced {
+				t.Errorf("coalesced %d, expecting %d", stats.Coalesced, tt.coalesced)
+			}
+		})
+	}
+}
+
+func TestFeedQueueBlock(t *testing.T) {
+	q := newFeedQueue(1, OverflowPolicy_BLOCK)
+	q.start()
+	defer q.close()
+
+	fill(t, q, FeedMessage{Sequence: 1}, FeedMessage{Sequence: 2})
+
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.push(FeedMessage{Sequence: 3})
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, seq := range []int64{1, 2, 3} {
+		if m := receive(t, q); m.Sequence != seq {
+			t.Errorf("received sequence %d, expecting %d", m.Sequence, seq)
+		}
+	}
+
+	if ok := <-pushed; !ok {
+		t.Error("blocked push failed")
+	}
+}
+
+func TestFeedQueueCloseReleasesBlockedPush(t *testing.T) {
+	q := newFeedQueue(1, OverflowPolicy_BLOCK)
+	q.start()
+
+	fill(t, q, FeedMessage{Sequence: 1}, FeedMessage{Sequence: 2})
+
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.push(FeedMessage{Sequence: 3})
+	}()
+
+	q.close()
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("push still blocked after close")
+	}
+}
+
+func TestFeedQueueDisconnectedEndsFeed(t *testing.T) {
+	q := newFeedQueue(1, OverflowPolicy_DISCONNECT)
+	q.start()
+
+	q.push(FeedMessage{Sequence: 1})
+	q.pushForce(FeedMessage{Channel: Channel_DISCONNECTED})
+
+	if m := receive(t, q); m.Sequence != 1 {
+		t.Errorf("received sequence %d, expecting 1", m.Sequence)
+	}
+	if m := receive(t, q); m.Channel != Channel_DISCONNECTED {
+		t.Errorf("received %s, expecting %s", m.Channel, Channel_DISCONNECTED)
+	}
+
+	select {
+	case <-q.done:
+	case <-time.After(time.Second):
+		t.Fatal("queue not closed after the disconnection")
+	}
+}
@@ -0,0 +1,192 @@
+package bitso
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+type FeeRole string
+
+const (
+	FeeRole_MAKER FeeRole = "maker"
+	FeeRole_TAKER FeeRole = "taker"
+)
+
+// FeeEstimate breaks down a trade. Gross, fee and net are given in both currencies of the book, the fee is charged
+// in FeeCurrency (the received currency) and converted to the other one at the trade price.
+type FeeEstimate struct {
+	Book 		BookCode
+	Side 		Side
+	Role 		FeeRole
+	Price 		decimal.Decimal // units: minor
+	FeeRate 	decimal.Decimal
+
+	GrossMajor 	decimal.Decimal // the traded amount
+	GrossMinor 	decimal.Decimal // the traded value
+	FeeMajor 	decimal.Decimal
+	FeeMinor 	decimal.Decimal
+	NetMajor 	decimal.Decimal // gross minus fee
+	NetMinor 	decimal.Decimal
+
+	FeeCurrency CurrencyCode
+	Paid 		decimal.Decimal // minor when buying, major when selling
+	Received 	decimal.Decimal // major when buying, minor when selling, after the fee
+}
+
+// EstimateFee computes a trade of amount (major) at price, as Bitso charges it: the fee is taken from the received
+// currency and every amount is rounded to the precision of its currency toward the exchange, the fee and the value
+// paid up and the value received down
+func EstimateFee(book Book, fee Fee, side Side, role FeeRole, amount, price decimal.Decimal) FeeEstimate {
+	majorPrecision := int32(book.Major.Precision)
+	minorPrecision := int32(book.Minor.Precision)
+
+	rate := fee.TakerFeeDecimal
+	if role == FeeRole_MAKER {
+		rate = fee.MakerFeeDecimal
+	}
+
+	e := FeeEstimate{
+		Book: book.BookCode,
+		Side: side,
+		Role: role,
+		Price: price,
+		FeeRate: rate,
+		GrossMajor: amount,
+	}
+
+	if side == Side_BUY {
+		e.GrossMinor = amount.Mul(price).RoundCeil(minorPrecision)
+		e.FeeCurrency = book.Major.Code
+		e.FeeMajor = amount.Mul(rate).RoundCeil(majorPrecision)
+		e.FeeMinor = e.FeeMajor.Mul(price).Round(minorPrecision)
+	} else {
+		e.GrossMinor = amount.Mul(price).RoundFloor(minorPrecision)
+		e.FeeCurrency = book.Minor.Code
+		e.FeeMinor = e.GrossMinor.Mul(rate).RoundCeil(minorPrecision)
+		if price.IsPositive() {
+			e.FeeMajor = e.FeeMinor.Div(price).Round(majorPrecision)
+		}
+	}
+
+	e.NetMajor = e.GrossMajor.Sub(e.FeeMajor)
+	e.NetMinor = e.GrossMinor.Sub(e.FeeMinor)
+
+	if side == Side_BUY {
+		e.Paid = e.GrossMinor
+		e.Received = e.NetMajor
+	} else {
+		e.Paid = e.GrossMajor
+		e.Received = e.NetMinor
+	}
+
+	return e
+}
+
+// RoundTripEstimate is the cost of buying and selling back the same amount at the same price, and optionally
+// withdrawing the proceeds
+type RoundTripEstimate struct {
+	Buy 				FeeEstimate
+	Sell 				FeeEstimate // of the net amount received by Buy
+	WithdrawalFee 		decimal.Decimal // units: minor
+	Proceeds 			decimal.Decimal // units: minor, after every fee
+	Cost 				decimal.Decimal // units: minor, the paid value minus the proceeds
+	CostPercent 		decimal.Decimal // of the paid value
+	BreakEvenPrice 		decimal.Decimal // the sell price that recovers the paid value, rounded up
+}
+
+// FeeCalculator estimates trades with the books, the fees of the account and the withdrawal fees
+type FeeCalculator struct {
+	books 			map[BookCode]Book
+	fees 			map[BookCode]Fee
+	withdrawalFees 	map[CurrencyCode]decimal.Decimal
+}
+
+func NewFeeCalculator(books map[BookCode]Book, fees map[BookCode]Fee, withdrawalFees map[CurrencyCode]decimal.Decimal) *FeeCalculator {
+	return &FeeCalculator{
+		books: books,
+		fees: fees,
+		withdrawalFees: withdrawalFees,
+	}
+}
+
+// LoadFeeCalculator pulls the books and the fees of the account from the API
+func LoadFeeCalculator(client *Client) (*FeeCalculator, error) {
+	books, err := client.AvailableBooks()
+	if err != nil {
+		return nil, err
+	}
+
+	rawFees, err := client.accountFees()
+	if err != nil {
+		return nil, err
+	}
+
+	fees := make(map[BookCode]Fee)
+	for _, f := range rawFees.Fees {
+		fees[f.BookCode] = f
+	}
+
+	return NewFeeCalculator(books, fees, rawFees.WithdrawalFees), nil
+}
+
+func (fc *FeeCalculator) lookup(code BookCode) (Book, Fee, error) {
+	book, ok := fc.books[code]
+	if !ok {
+		return Book{}, Fee{}, fmt.Errorf("unknown book %s", code)
+	}
+
+	fee, ok := fc.fees[code]
+	if !ok {
+		return Book{}, Fee{}, fmt.Errorf("no fees for book %s", code)
+	}
+
+	return book, fee, nil
+}
+
+// Estimate computes a trade of amount (major) at price, see EstimateFee
+func (fc *FeeCalculator) Estimate(code BookCode, side Side, role FeeRole, amount, price decimal.Decimal) (FeeEstimate, error) {
+	book, fee, err := fc.lookup(code)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+
+	return EstimateFee(book, fee, side, role, amount, price), nil
+}
+
+// WithdrawalFee returns the fee charged for withdrawing a currency, zero when unknown
+func (fc *FeeCalculator) WithdrawalFee(currency CurrencyCode) decimal.Decimal {
+	return fc.withdrawalFees[currency]
+}
+
+// RoundTrip estimates buying amount (major) at price with the given role and selling the received amount back at
+// the same price and role. If withdraw is set, the withdrawal fee of the minor currency is taken from the proceeds.
+func (fc *FeeCalculator) RoundTrip(code BookCode, amount, price decimal.Decimal, role FeeRole, withdraw bool) (RoundTripEstimate, error) {
+	book, fee, err := fc.lookup(code)
+	if err != nil {
+		return RoundTripEstimate{}, err
+	}
+
+	r := RoundTripEstimate{}
+	r.Buy = EstimateFee(book, fee, Side_BUY, role, amount, price)
+	r.Sell = EstimateFee(book, fee, Side_SELL, role, r.Buy.Received, price)
+
+	if withdraw {
+		r.WithdrawalFee = fc.withdrawalFees[book.Minor.Code]
+	}
+
+	r.Proceeds = r.Sell.Received.Sub(r.WithdrawalFee)
+	r.Cost = r.Buy.Paid.Sub(r.Proceeds)
+	if r.Buy.Paid.IsPositive() {
+		r.CostPercent = r.Cost.Div(r.Buy.Paid).Mul(decimal.NewFromInt(100)).Round(4)
+	}
+
+	// the sell of the received amount must return the paid value plus the withdrawal fee, after its own fee
+	sellRate := r.Sell.FeeRate
+	if r.Buy.Received.IsPositive() && sellRate.LessThan(decimal.NewFromInt(1)) {
+		target := r.Buy.Paid.Add(r.WithdrawalFee)
+		r.BreakEvenPrice = target.Div(r.Buy.Received.Mul(decimal.NewFromInt(1).Sub(sellRate))).RoundCeil(int32(book.Minor.Precision))
+	}
+
+	return r, nil
+}
@@ -0,0 +1,92 @@
+package bitso_test
+
+import (
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+func testFeeCalculator() *bitso.FeeCalculator {
+	return bitso.NewFeeCalculator(
+		map[bitso.BookCode]bitso.Book{btcMxn.BookCode: btcMxn},
+		map[bitso.BookCode]bitso.Fee{btcMxn.BookCode: {BookCode: btcMxn.BookCode, TakerFeeDecimal: d("0.0065"), MakerFeeDecimal: d("0.005")}},
+		map[bitso.CurrencyCode]decimal.Decimal{bitso.CurrencyCode_MXN: d("10")},
+	)
+}
+
+func TestFeeEstimate(t *testing.T) {
+	tests := []struct {
+		name 		string
+		side 		bitso.Side
+		role 		bitso.FeeRole
+		expected 	[]string // gross, fee and net in major and minor
+	}{
+		// the value paid and the fee are rounded up
+		{"buy as taker", bitso.Side_BUY, bitso.FeeRole_TAKER, []string{"0.12345678", "111111.11", "0.00080247", "722.22", "0.12265431", "110388.89"}},
+		{"buy as maker", bitso.Side_BUY, bitso.FeeRole_MAKER, []string{"0.12345678", "111111.11", "0.00061729", "555.56", "0.12283949", "110555.55"}},
+		// the value received is rounded down and the fee up
+		{"sell as taker", bitso.Side_SELL, bitso.FeeRole_TAKER, []string{"0.12345678", "111111.1", "0.00080248", "722.23", "0.1226543", "110388.87"}},
+		{"sell as maker", bitso.Side_SELL, bitso.FeeRole_MAKER, []string{"0.12345678", "111111.1", "0.00061729", "555.56", "0.12283949", "110555.54"}},
+	}
+
+	for _, tt := range tests {
+		e, err := testFeeCalculator().Estimate(btcMxn.BookCode, tt.side, tt.role, d("0.12345678"), d("900000.01"))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		figures := []string{e.GrossMajor.String(), e.GrossMinor.String(), e.FeeMajor.String(), e.FeeMinor.String(), e.NetMajor.String(), e.NetMinor.String()}
+		for i := range figures {
+			if figures[i] != tt.expected[i] {
+				t.Errorf("%s: gross, fee and net are %v, expecting %v", tt.name, figures, tt.expected)
+				break
+			}
+		}
+
+		paid, received := e.GrossMinor, e.NetMajor
+		if tt.side == bitso.Side_SELL {
+			paid, received = e.GrossMajor, e.NetMinor
+		}
+		if !e.Paid.Equal(paid) || !e.Received.Equal(received) {
+			t.Errorf("%s: pays %s and receives %s, expecting %s and %s", tt.name, e.Paid, e.Received, paid, received)
+		}
+	}
+
+	if _, err := testFeeCalculator().Estimate(bitso.BookCode_ETH_MXN, bitso.Side_BUY, bitso.FeeRole_TAKER, d("1"), d("1")); err == nil {
+		t.Error("expecting an error for an unknown book")
+	}
+}
+
+func TestFeeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name 		string
+		withdraw 	bool
+		proceeds 	string
+		cost 		string
+		costPercent string
+		breakEven 	string
+	}{
+		// 0.1 bought for 90000 receives 0.09935, sold for 89415 less a 581.20 fee
+		{"trade only", false, "88833.8", "1166.2", "1.2958", "911815.08"},
+		{"with the withdrawal", true, "88823.8", "1176.2", "1.3069", "911916.39"},
+	}
+
+	for _, tt := range tests {
+		r, err := testFeeCalculator().RoundTrip(btcMxn.BookCode, d("0.1"), d("900000"), bitso.FeeRole_TAKER, tt.withdraw)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if !r.Sell.GrossMajor.Equal(r.Buy.Received) {
+			t.Errorf("%s: sells %s, expecting the %s received", tt.name, r.Sell.GrossMajor, r.Buy.Received)
+		}
+		if r.Proceeds.String() != tt.proceeds || r.Cost.String() != tt.cost || r.CostPercent.String() != tt.costPercent {
+			t.Errorf("%s: proceeds %s, cost %s (%s%%), expecting %s, %s (%s%%)", tt.name, r.Proceeds, r.Cost, r.CostPercent, tt.proceeds, tt.cost, tt.costPercent)
+		}
+		// rounded up, a cent less would not recover the paid value
+		if r.BreakEvenPrice.String() != tt.breakEven {
+			t.Errorf("%s: break even at %s, expecting %s", tt.name, r.BreakEvenPrice, tt.breakEven)
+		}
+	}
+}
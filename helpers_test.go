@@ -0,0 +1,49 @@
+package bitso_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+	"github.com/shopspring/decimal"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+// eventually fails the test unless cond becomes true within a second
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// next returns the next message of a feed, skipping the keep alive heartbeats
+func next(t *testing.T, feed <-chan bitso.FeedMessage) bitso.FeedMessage {
+	t.Helper()
+
+	for {
+		select {
+		case m := <-feed:
+			if m.Channel != bitso.Channel_KEEP_ALIVE {
+				return m
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no message received")
+			return bitso.FeedMessage{}
+		}
+	}
+}
+
+// quietListener returns a Websocket pointed at the fake server that does not log
+func quietListener(server *bitsotest.WebsocketServer, options ...bitso.WebsocketOption) *bitso.Websocket {
+	return server.Listener(append([]bitso.WebsocketOption{bitso.WithLogger(bitso.NopLogger())}, options...)...)
+}
@@ -0,0 +1,95 @@
+package bitso
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+type LogLevel int
+
+const (
+	LogLevel_DEBUG 	LogLevel = iota
+	LogLevel_INFO
+	LogLevel_WARN
+	LogLevel_ERROR
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevel_DEBUG:
+		return "DEBUG"
+	case LogLevel_INFO:
+		return "INFO"
+	case LogLevel_WARN:
+		return "WARN"
+	case LogLevel_ERROR:
+		return "ERROR"
+	default:
+		return ""
+	}
+}
+
+// LogField is a structured key/value attached to a log entry (ex. book, channel, endpoint, latency, error code)
+type LogField struct {
+	Key 	string
+	Value 	interface{}
+}
+
+// Field builds a LogField
+func Field(key string, value interface{}) LogField {
+	return LogField{Key: key, Value: value}
+}
+
+// Logger receives every log entry of the Client and the Websocket. It has a single method so it can easily wrap
+// any structured logging library.
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// StdLogger writes entries through the standard library log package as "prefix msg key=value ..."
+type StdLogger struct {
+	out 		*log.Logger
+	prefix 		string
+	minLevel 	LogLevel
+}
+
+// NewStdLogger returns a Logger writing to out, or to stderr with the standard flags when out is nil, and
+// discarding every entry below minLevel
+func NewStdLogger(out *log.Logger, prefix string, minLevel LogLevel) *StdLogger {
+	if out == nil {
+		out = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	return &StdLogger{
+		out: out,
+		prefix: prefix,
+		minLevel: minLevel,
+	}
+}
+
+func (l *StdLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	if level < l.minLevel {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(l.prefix)
+	b.WriteString(msg)
+
+	for _, f := range fields {
+		b.WriteString(fmt.Sprintf(" %s=%v", f.Key, f.Value))
+	}
+
+	l.out.Println(b.String())
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(level LogLevel, msg string, fields ...LogField) {}
+
+// NopLogger returns a Logger that discards everything
+func NopLogger() Logger {
+	return nopLogger{}
+}
@@ -2,6 +2,10 @@ package bitso
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -12,6 +16,7 @@ type ActionType string
 const (
 	ActionType_NULL 		ActionType = ""
 	ActionType_SUBSCRIBE 	ActionType = "subscribe"
+	ActionType_UNSUBSCRIBE 	ActionType = "unsubscribe"
 )
 
 
@@ -23,6 +28,7 @@ const (
 	Channel_ORDERS 			Channel = "orders"
 	Channel_KEEP_ALIVE 		Channel = "ka"
 	Channel_DISCONNECTED 	Channel = "disconnected"
+	Channel_RECONNECTED 	Channel = "reconnected"
 )
 
 type Side int64
@@ -43,6 +49,57 @@ func (s Side) String() string {
 	}
 }
 
+// UnmarshalJSON accepts both the numeric sides of the websocket API (0, 1) and the strings of the REST API ("buy", "sell")
+func (s *Side) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+
+	switch strings.ToLower(str) {
+	case "0", "buy":
+		*s = Side_BUY
+	case "1", "sell":
+		*s = Side_SELL
+	default:
+		return fmt.Errorf("invalid side %s", string(data))
+	}
+
+	return nil
+}
+
+// apiString is the side as expected by the REST API
+func (s Side) apiString() string {
+	return strings.ToLower(s.String())
+}
+
+// Opposite returns the other side, ex. the taker side of a trade from its maker side
+func (s Side) Opposite() Side {
+	if s == Side_BUY {
+		return Side_SELL
+	}
+	return Side_BUY
+}
+
+type OrderType string
+
+const (
+	OrderType_LIMIT 	OrderType = "limit"
+	OrderType_MARKET 	OrderType = "market"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatus_QUEUED 				OrderStatus = "queued"
+	OrderStatus_OPEN 				OrderStatus = "open"
+	OrderStatus_PARTIALLY_FILLED 	OrderStatus = "partially filled"
+	OrderStatus_COMPLETED 			OrderStatus = "completed"
+	OrderStatus_CANCELLED 			OrderStatus = "cancelled"
+)
+
+// IsActive is true while the order can still be filled
+func (s OrderStatus) IsActive() bool {
+	return s == OrderStatus_QUEUED || s == OrderStatus_OPEN || s == OrderStatus_PARTIALLY_FILLED
+}
+
 ///////////////////////////////
 ////  REST API
 // ApiResponse is a general struct used for any response from the REST API, both public and private
@@ -64,6 +121,52 @@ type PublicAvailableBooksPayload struct {
 	MaximumPrice 	decimal.Decimal `json:"maximum_price"`
 	MinimumValue 	decimal.Decimal `json:"minimum_value"` // units: minor
 	MaximumValue 	decimal.Decimal `json:"maximum_value"`
+	TickSize 		decimal.Decimal `json:"tick_size"` // units: minor. not sent by older versions of the API
+}
+
+// Public REST API: Catalogues
+type PublicCatalogueCurrencyPayload struct {
+	Currency 	CurrencyCode 	`json:"currency"`
+	Name 		string 			`json:"name"`
+	Precision 	int 			`json:"precision"`
+}
+
+// Public REST API: Ticker
+type Ticker struct {
+	Book 		BookCode 		`json:"book"`
+	Volume 		decimal.Decimal `json:"volume"` // units: major, last 24 hours
+	High 		decimal.Decimal `json:"high"` // units: minor, last 24 hours
+	Last 		decimal.Decimal `json:"last"`
+	Low 		decimal.Decimal `json:"low"`
+	Vwap 		decimal.Decimal `json:"vwap"`
+	Ask 		decimal.Decimal `json:"ask"`
+	Bid 		decimal.Decimal `json:"bid"`
+	CreatedAt 	time.Time 		`json:"created_at"`
+}
+
+// Public REST API: Order Book
+type PublicOrderBookPayload struct {
+	Asks 		[]PublicOrderBookOffer 	`json:"asks"`
+	Bids 		[]PublicOrderBookOffer 	`json:"bids"`
+	UpdatedAt 	time.Time 				`json:"updated_at"`
+	Sequence 	int64 					`json:"sequence,string"`
+}
+
+type PublicOrderBookOffer struct {
+	Book 	BookCode 		`json:"book"`
+	Price 	decimal.Decimal `json:"price"` // units: minor
+	Amount 	decimal.Decimal `json:"amount"` // units: major
+	Oid 	string 			`json:"oid"` // only when not aggregated
+}
+
+// Public REST API: Trades
+type PublicTrade struct {
+	Book 		BookCode 		`json:"book"`
+	Tid 		int64 			`json:"tid"`
+	Amount 		decimal.Decimal `json:"amount"` // units: major
+	Price 		decimal.Decimal `json:"price"` // units: minor
+	MakerSide 	Side 			`json:"maker_side"`
+	CreatedAt 	time.Time 		`json:"created_at"`
 }
 
 ///////////////////////////////
@@ -95,6 +198,78 @@ type Fee struct {
 }
 
 
+// Private REST API: Place Order
+// Limit orders require Major and Price, market orders require either Major or Minor
+type OrderRequest struct {
+	Book 	BookCode
+	Side 	Side
+	Type 	OrderType
+	Major 	decimal.Decimal // units: major
+	Minor 	decimal.Decimal // units: minor
+	Price 	decimal.Decimal // units: minor
+	OriginId 	string // optional, unique per account, to look the order up when placing it failed (see LookupOrdersByOrigin)
+}
+
+type PrivatePlaceOrderPayload struct {
+	Oid 	string 	`json:"oid"`
+}
+
+// Private REST API: Open Orders, Lookup Orders
+type Order struct {
+	Book 			BookCode 		`json:"book"`
+	Oid 			string 			`json:"oid"`
+	OriginId 		string 			`json:"origin_id"` // empty unless given when the order was placed
+	Side 			Side 			`json:"side"`
+	Type 			OrderType 		`json:"type"`
+	Status 			OrderStatus 	`json:"status"`
+	OriginalAmount 	decimal.Decimal `json:"original_amount"` // units: major
+	UnfilledAmount 	decimal.Decimal `json:"unfilled_amount"` // units: major
+	OriginalValue 	decimal.Decimal `json:"original_value"` // units: minor
+	Price 			decimal.Decimal `json:"price"` // units: minor
+	CreatedAt 		time.Time 		`json:"created_at"`
+	UpdatedAt 		time.Time 		`json:"updated_at"`
+}
+
+// Private REST API: User Trades
+type UserTrade struct {
+	Book 			BookCode 		`json:"book"`
+	Tid 			int64 			`json:"tid"`
+	Oid 			string 			`json:"oid"`
+	Side 			Side 			`json:"side"`
+	Major 			decimal.Decimal `json:"major"` // units: major, negative when sold
+	Minor 			decimal.Decimal `json:"minor"` // units: minor, negative when spent
+	Price 			decimal.Decimal `json:"price"`
+	FeesAmount 		decimal.Decimal `json:"fees_amount"`
+	FeesCurrency 	CurrencyCode 	`json:"fees_currency"`
+	MakerSide 		Side 			`json:"maker_side"`
+	CreatedAt 		time.Time 		`json:"created_at"`
+}
+
+
+// Private REST API: Ledger
+type LedgerOperation string
+
+const (
+	LedgerOperation_TRADE 		LedgerOperation = "trade"
+	LedgerOperation_FEE 		LedgerOperation = "fee"
+	LedgerOperation_FUNDING 	LedgerOperation = "funding"
+	LedgerOperation_WITHDRAWAL 	LedgerOperation = "withdrawal"
+)
+
+type LedgerEntry struct {
+	Eid 			string 					`json:"eid"`
+	Operation 		LedgerOperation 		`json:"operation"`
+	CreatedAt 		time.Time 				`json:"created_at"`
+	BalanceUpdates 	[]LedgerBalanceUpdate 	`json:"balance_updates"`
+	Details 		map[string]interface{} 	`json:"details"` // depends on the operation
+}
+
+type LedgerBalanceUpdate struct {
+	Currency 	CurrencyCode 	`json:"currency"`
+	Amount 		decimal.Decimal `json:"amount"` // negative when debited
+}
+
+
 ///////////////////////////////
 ////  WEBSOCKET API
 // IncomingMessages is a general struct used for any incoming messages in the websocket feed
@@ -114,6 +289,24 @@ type FeedMessage struct {
 	Payload 	interface{}
 }
 
+// Orders returns the payload of an Orders Channel message, ok is false for any other channel
+func (m FeedMessage) Orders() (orders Orders, ok bool) {
+	orders, ok = m.Payload.(Orders)
+	return orders, ok && m.Channel == Channel_ORDERS
+}
+
+// Trades returns the payload of a Trades Channel message, ok is false for any other channel
+func (m FeedMessage) Trades() (trades []Trade, ok bool) {
+	trades, ok = m.Payload.([]Trade)
+	return trades, ok && m.Channel == Channel_TRADES
+}
+
+// DiffOrders returns the payload of a Diff-Orders Channel message, ok is false for any other channel
+func (m FeedMessage) DiffOrders() (diffs []DiffOrder, ok bool) {
+	diffs, ok = m.Payload.([]DiffOrder)
+	return diffs, ok && m.Channel == Channel_DIFF_ORDERS
+}
+
 
 // WebSocket API: Orders Channel
 type Orders struct {
@@ -138,6 +331,19 @@ type Trade struct {
 	Side 			Side 			`json:"t"` // maker side
 	MakerOrderId 	string 			`json:"mo"`
 	TakerOrderId 	string 			`json:"to"`
+	UnixMillis 		int64 			`json:"x"` // not sent by older versions of the API
+}
+
+
+// Websocket API: Diff-Orders Channel
+type DiffOrder struct {
+	UnixMillis 	int64 			`json:"d"`
+	Rate 		decimal.Decimal `json:"r"` // units: minor
+	Side 		Side 			`json:"t"`
+	Amount 		decimal.Decimal `json:"a"` // units: major. zero when the order was removed from the book
+	Value 		decimal.Decimal `json:"v"` // units: minor
+	OrderId 	string 			`json:"o"`
+	Status 		string 			`json:"s"` // "open", "cancelled" or "completed"
 }
 
 
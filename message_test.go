@@ -0,0 +1,40 @@
+package bitso_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/angle/gobitso"
+)
+
+func TestSideUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json 	string
+		side 	bitso.Side
+		err 	bool
+	}{
+		{`"buy"`, bitso.Side_BUY, false},
+		{`"sell"`, bitso.Side_SELL, false},
+		{`"SELL"`, bitso.Side_SELL, false},
+		{`0`, bitso.Side_BUY, false},
+		{`1`, bitso.Side_SELL, false},
+		{`"1"`, bitso.Side_SELL, false},
+		{`2`, 0, true},
+		{`"hold"`, 0, true},
+	}
+
+	for _, tt := range tests {
+		var side bitso.Side
+		err := json.Unmarshal([]byte(tt.json), &side)
+
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: decoded %s, expecting an error", tt.json, side)
+			}
+			continue
+		}
+		if err != nil || side != tt.side {
+			t.Errorf("%s: decoded %s, %v, expecting %s", tt.json, side, err, tt.side)
+		}
+	}
+}
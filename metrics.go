@@ -0,0 +1,36 @@
+package bitso
+
+import "time"
+
+// Metrics receives instrumentation events from the Client and the Websocket, see the bitsoprom package for a
+// Prometheus-compatible implementation. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest is called after every REST request. status is 0 when no response was received, and
+	// errorCode is empty on success, the Bitso error code on API errors or "-1" for any other error.
+	ObserveRequest(method, endpoint string, status int, errorCode string, latency time.Duration)
+
+	// ObserveMessage is called for every message read from the websocket, including the "ka" heartbeats
+	ObserveMessage(channel Channel, book BookCode)
+
+	// ObserveDropped is called for every message discarded by the feed queue overflow policy
+	ObserveDropped(channel Channel, book BookCode)
+
+	// ObserveReconnect is called after every successful websocket reconnection
+	ObserveReconnect()
+
+	// ObserveQueueDepth is called with the number of messages waiting for the consumer after every enqueue
+	ObserveQueueDepth(depth int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRequest(method, endpoint string, status int, errorCode string, latency time.Duration) {}
+func (nopMetrics) ObserveMessage(channel Channel, book BookCode) {}
+func (nopMetrics) ObserveDropped(channel Channel, book BookCode) {}
+func (nopMetrics) ObserveReconnect() {}
+func (nopMetrics) ObserveQueueDepth(depth int) {}
+
+// NopMetrics returns a Metrics that discards everything, it is the default
+func NopMetrics() Metrics {
+	return nopMetrics{}
+}
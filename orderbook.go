@@ -0,0 +1,154 @@
+package bitso
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SequenceGapError is returned by OrderBook.ApplyDiff when Diff-Orders messages were missed, the book must be
+// seeded again from an Orders snapshot
+type SequenceGapError struct {
+	Expected 	int64
+	Received 	int64
+}
+
+func (e SequenceGapError) Error() string {
+	return fmt.Sprintf("sequence gap: expected %d, received %d", e.Expected, e.Received)
+}
+
+// OrderBook is a local copy of a book, seeded from a snapshot of its orders (see Client.OrderBookOffers) and kept up
+// to date with the Diff-Orders channel. Offers of an aggregated snapshot carry no order id, each is kept as a price
+// level that no diff can change.
+type OrderBook struct {
+	mu 			sync.RWMutex
+	book 		BookCode
+	sequence 	int64
+	bids 		map[string]DiffOrder // keyed by order id
+	asks 		map[string]DiffOrder
+}
+
+func NewOrderBook(book BookCode) *OrderBook {
+	return &OrderBook{
+		book: book,
+		bids: make(map[string]DiffOrder),
+		asks: make(map[string]DiffOrder),
+	}
+}
+
+func (ob *OrderBook) Book() BookCode {
+	return ob.book
+}
+
+// Sequence returns the sequence of the last applied Diff-Orders message
+func (ob *OrderBook) Sequence() int64 {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	return ob.sequence
+}
+
+// Reset replaces the whole book with a snapshot, one entry per order id. The sequence is the last Diff-Orders
+// sequence already included in the snapshot, or zero to accept whatever diff comes next.
+func (ob *OrderBook) Reset(sequence int64, bids []PublicOrderBookOffer, asks []PublicOrderBookOffer) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	ob.sequence = sequence
+	ob.bids = make(map[string]DiffOrder, len(bids))
+	ob.asks = make(map[string]DiffOrder, len(asks))
+
+	for _, o := range bids {
+		ob.bids[offerId(o)] = DiffOrder{Rate: o.Price, Side: Side_BUY, Amount: o.Amount, Value: o.Price.Mul(o.Amount), OrderId: o.Oid}
+	}
+	for _, o := range asks {
+		ob.asks[offerId(o)] = DiffOrder{Rate: o.Price, Side: Side_SELL, Amount: o.Amount, Value: o.Price.Mul(o.Amount), OrderId: o.Oid}
+	}
+}
+
+// offerId is the order id of an offer, or its price for the levels of an aggregated snapshot
+func offerId(o PublicOrderBookOffer) string {
+	if o.Oid != "" {
+		return o.Oid
+	}
+	return "level:" + o.Price.String()
+}
+
+// ApplyDiff applies a Diff-Orders message. Messages older than the book are ignored and a SequenceGapError is
+// returned, without applying anything, when messages were missed.
+func (ob *OrderBook) ApplyDiff(sequence int64, diffs []DiffOrder) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	if ob.sequence != 0 {
+		if sequence <= ob.sequence {
+			return nil
+		}
+		if sequence != ob.sequence + 1 {
+			return SequenceGapError{Expected: ob.sequence + 1, Received: sequence}
+		}
+	}
+	ob.sequence = sequence
+
+	for _, d := range diffs {
+		side := ob.bids
+		if d.Side == Side_SELL {
+			side = ob.asks
+		}
+
+		if d.Amount.IsPositive() && (d.Status == "" || d.Status == "open") {
+			side[d.OrderId] = d
+		} else {
+			delete(side, d.OrderId)
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns the book aggregated by rate, best rates first, with at most depth levels per side (all of them
+// when depth is zero)
+func (ob *OrderBook) Snapshot(depth int) Orders {
+	ob.mu.RLock()
+	defer ob.mu.RUnlock()
+
+	return Orders{
+		Bids: aggregate(ob.bids, Side_BUY, depth),
+		Asks: aggregate(ob.asks, Side_SELL, depth),
+	}
+}
+
+func aggregate(orders map[string]DiffOrder, side Side, depth int) []Offer {
+	levels := make(map[string]*Offer)
+	for _, o := range orders {
+		key := o.Rate.String()
+		level, ok := levels[key]
+		if !ok {
+			level = &Offer{Rate: o.Rate, Side: side}
+			levels[key] = level
+		}
+		level.Amount = level.Amount.Add(o.Amount)
+		level.Value = level.Value.Add(o.Amount.Mul(o.Rate))
+		if o.UnixMillis > level.UnixMillis {
+			level.UnixMillis = o.UnixMillis
+		}
+	}
+
+	offers := make([]Offer, 0, len(levels))
+	for _, level := range levels {
+		offers = append(offers, *level)
+	}
+
+	sort.Slice(offers, func(i, j int) bool {
+		if side == Side_BUY {
+			return offers[i].Rate.GreaterThan(offers[j].Rate)
+		}
+		return offers[i].Rate.LessThan(offers[j].Rate)
+	})
+
+	if depth > 0 && len(offers) > depth {
+		offers = offers[:depth]
+	}
+
+	return offers
+}
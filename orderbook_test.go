@@ -0,0 +1,51 @@
+package bitso_test
+
+import (
+	"testing"
+
+	"github.com/angle/gobitso"
+)
+
+func TestOrderBookApplyDiff(t *testing.T) {
+	ob := bitso.NewOrderBook(bitso.BookCode_BTC_MXN)
+	ob.Reset(10, []bitso.PublicOrderBookOffer{{Price: d("100"), Amount: d("1"), Oid: "b1"}}, []bitso.PublicOrderBookOffer{
+		{Price: d("101"), Amount: d("1"), Oid: "a1"},
+		{Price: d("101"), Amount: d("2"), Oid: "a2"},
+		// an aggregated level
+		{Price: d("102"), Amount: d("5")},
+	})
+
+	// a1 is cancelled and a3 joins the level, the other orders at both rates stay
+	err := ob.ApplyDiff(11, []bitso.DiffOrder{
+		{OrderId: "a1", Rate: d("101"), Side: bitso.Side_SELL, Amount: d("0"), Status: "cancelled"},
+		{OrderId: "a3", Rate: d("102"), Side: bitso.Side_SELL, Amount: d("1"), Status: "open"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"101 2", "102 6"}
+	asks := ob.Snapshot(0).Asks
+	if len(asks) != len(expected) {
+		t.Fatalf("%d ask levels, expecting %v", len(asks), expected)
+	}
+	for i, a := range asks {
+		if level := a.Rate.String() + " " + a.Amount.String(); level != expected[i] {
+			t.Errorf("ask level %s, expecting %s", level, expected[i])
+		}
+	}
+	if bids := ob.Snapshot(0).Bids; len(bids) != 1 || !bids[0].Amount.Equal(d("1")) {
+		t.Errorf("bids %v, expecting 1 at 100", bids)
+	}
+
+	// older diffs are ignored and missed ones are reported
+	if err := ob.ApplyDiff(11, []bitso.DiffOrder{{OrderId: "a2", Rate: d("101"), Side: bitso.Side_SELL, Amount: d("0")}}); err != nil {
+		t.Errorf("stale diff: %v", err)
+	}
+	if err := ob.ApplyDiff(13, nil); err != (bitso.SequenceGapError{Expected: 12, Received: 13}) {
+		t.Errorf("received %v, expecting a sequence gap", err)
+	}
+	if ob.Sequence() != 11 || len(ob.Snapshot(0).Asks) != 2 {
+		t.Errorf("sequence %d and asks %v, expecting the book at 11", ob.Sequence(), ob.Snapshot(0).Asks)
+	}
+}
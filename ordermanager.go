@@ -0,0 +1,575 @@
+package bitso
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type OrderState string
+
+const (
+	OrderState_PENDING_NEW 		OrderState = "pending new"
+	OrderState_OPEN 			OrderState = "open"
+	OrderState_PARTIALLY_FILLED OrderState = "partially filled"
+	OrderState_FILLED 			OrderState = "filled"
+	OrderState_CANCELLED 		OrderState = "cancelled"
+	OrderState_REJECTED 		OrderState = "rejected"
+)
+
+// IsFinal is true once the order cannot change anymore
+func (s OrderState) IsFinal() bool {
+	return s == OrderState_FILLED || s == OrderState_CANCELLED || s == OrderState_REJECTED
+}
+
+// orderTransitions are the states each state can move to
+var orderTransitions = map[OrderState][]OrderState{
+	OrderState_PENDING_NEW: {OrderState_OPEN, OrderState_PARTIALLY_FILLED, OrderState_FILLED, OrderState_CANCELLED, OrderState_REJECTED},
+	OrderState_OPEN: {OrderState_PARTIALLY_FILLED, OrderState_FILLED, OrderState_CANCELLED},
+	OrderState_PARTIALLY_FILLED: {OrderState_PARTIALLY_FILLED, OrderState_FILLED, OrderState_CANCELLED},
+}
+
+// CanMoveTo reports whether the state machine allows moving from s to next
+func (s OrderState) CanMoveTo(next OrderState) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ManagedOrder is an order placed through an OrderManager, with its fills
+type ManagedOrder struct {
+	ClientId 		string // assigned by the OrderManager before the order is placed
+	Oid 			string // assigned by Bitso, empty until placed
+	Request 		OrderRequest
+	State 			OrderState
+	Filled 			decimal.Decimal // units: major
+	FilledValue 	decimal.Decimal // units: minor
+	Fees 			map[CurrencyCode]decimal.Decimal
+	Fills 			[]UserTrade // oldest first
+	Error 			error // why the order was rejected, or why it was given up as cancelled
+	CreatedAt 		time.Time
+	UpdatedAt 		time.Time
+}
+
+// settled reports whether the fills add up to what the status of the order reports filled, counted in the units the
+// order was placed with. Orders placed in minor are counted in major once the status reports the amount executed,
+// as Bitso does not report the value left unfilled; a cancelled one that reports neither has nothing to wait for.
+func (o *ManagedOrder) settled(order Order) bool {
+	executed := order.OriginalAmount.Sub(order.UnfilledAmount)
+	if o.Request.Major.IsPositive() || executed.IsPositive() {
+		return o.Filled.GreaterThanOrEqual(executed)
+	}
+
+	if order.Status == OrderStatus_CANCELLED {
+		return true
+	}
+	return o.FilledValue.GreaterThanOrEqual(order.OriginalValue)
+}
+
+// AveragePrice returns the average price of the fills, zero before the first one
+func (o ManagedOrder) AveragePrice() decimal.Decimal {
+	if !o.Filled.IsPositive() {
+		return decimal.Zero
+	}
+	return o.FilledValue.Div(o.Filled)
+}
+
+func (o *ManagedOrder) copy() ManagedOrder {
+	c := *o
+
+	c.Fees = make(map[CurrencyCode]decimal.Decimal, len(o.Fees))
+	for currency, fee := range o.Fees {
+		c.Fees[currency] = fee
+	}
+
+	c.Fills = make([]UserTrade, len(o.Fills))
+	copy(c.Fills, o.Fills)
+
+	return c
+}
+
+// OrderEvent is a change of a managed order, either a new state or a new fill
+type OrderEvent struct {
+	Order 		ManagedOrder
+	Previous 	OrderState
+	Fill 		*UserTrade // set when the event is a fill
+}
+
+// Position is the net result of the fills of the managed orders of a book
+type Position struct {
+	Book 	BookCode
+	Major 	decimal.Decimal // units: major, bought minus sold
+	Minor 	decimal.Decimal // units: minor, received minus spent
+	Fees 	map[CurrencyCode]decimal.Decimal
+}
+
+// OrderManager places orders through a Trader and tracks them through their lifecycle, reconciling their state and
+// fills from the open orders, order lookups and user trades. It works the same with a Client or a paper.Trader.
+type OrderManager struct {
+	trader 		Trader
+	logger 		Logger
+
+	mu 			sync.RWMutex
+	orders 		map[string]*ManagedOrder // keyed by client id
+	byOid 		map[string]*ManagedOrder
+	lastTid 	int64 // newest user trade reconciled
+	marked 		bool // whether lastTid was taken, it is retaken once no order is active
+	positions 	map[BookCode]*Position
+	clientSeq 	int64
+
+	handlersMu 	sync.RWMutex
+	handlers 	[]func(event OrderEvent)
+
+	wake 		chan bool
+	quit 		chan bool
+	quitOnce 	sync.Once
+}
+
+func NewOrderManager(trader Trader) *OrderManager {
+	return &OrderManager{
+		trader: trader,
+		logger: NopLogger(),
+		orders: make(map[string]*ManagedOrder),
+		byOid: make(map[string]*ManagedOrder),
+		positions: make(map[BookCode]*Position),
+		wake: make(chan bool, 1),
+		quit: make(chan bool),
+	}
+}
+
+func (om *OrderManager) SetLogger(logger Logger) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+
+	om.logger = logger
+}
+
+// OnEvent registers a handler called for every state change and fill, in order
+func (om *OrderManager) OnEvent(handler func(event OrderEvent)) {
+	om.handlersMu.Lock()
+	defer om.handlersMu.Unlock()
+
+	om.handlers = append(om.handlers, handler)
+}
+
+func (om *OrderManager) emit(events []OrderEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	om.handlersMu.RLock()
+	handlers := make([]func(event OrderEvent), len(om.handlers))
+	copy(handlers, om.handlers)
+	om.handlersMu.RUnlock()
+
+	for _, e := range events {
+		for _, h := range handlers {
+			h(e)
+		}
+	}
+}
+
+// move changes the state of an order if the state machine allows it. Must be called with the lock held.
+func (om *OrderManager) move(o *ManagedOrder, next OrderState, now time.Time, events []OrderEvent) []OrderEvent {
+	if o.State == next {
+		// partially filled to partially filled is only reported with a fill
+		return events
+	}
+
+	if !o.State.CanMoveTo(next) {
+		om.logger.Log(LogLevel_WARN, "ignored order state change", Field("oid", o.Oid), Field("from", o.State), Field("to", next))
+		return events
+	}
+
+	previous := o.State
+	o.State = next
+	o.UpdatedAt = now
+
+	return append(events, OrderEvent{Order: o.copy(), Previous: previous})
+}
+
+// Submit places an order. The order is tracked from then on, rejected orders included, and the returned error is
+// the one of the Trader. When no other order is active the newest user trade is looked up first, the fills of the
+// order are the trades after it; the order is not tracked if that lookup fails.
+func (om *OrderManager) Submit(req OrderRequest) (ManagedOrder, error) {
+	var newest int64
+	fetched := false
+
+	om.mu.Lock()
+	for !om.marked && !fetched {
+		om.mu.Unlock()
+
+		trades, err := om.trader.UserTrades("", 0, 1)
+		if err != nil {
+			return ManagedOrder{}, err
+		}
+		if len(trades) > 0 {
+			newest = trades[0].Tid
+		}
+		fetched = true
+
+		om.mu.Lock()
+	}
+	if !om.marked {
+		om.lastTid = newest
+		om.marked = true
+	}
+
+	now := time.Now()
+	om.clientSeq++
+	o := &ManagedOrder{
+		ClientId: "om" + strconv.FormatInt(om.clientSeq, 10),
+		Request: req,
+		State: OrderState_PENDING_NEW,
+		Fees: make(map[CurrencyCode]decimal.Decimal),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	om.orders[o.ClientId] = o
+	events := []OrderEvent{{Order: o.copy(), Previous: ""}}
+	om.mu.Unlock()
+
+	om.emit(events)
+
+	oid, err := om.trader.PlaceOrder(req)
+
+	om.mu.Lock()
+	events = events[:0]
+	if err != nil {
+		o.Error = err
+		events = om.move(o, OrderState_REJECTED, time.Now(), events)
+	} else {
+		o.Oid = oid
+		om.byOid[oid] = o
+		events = om.move(o, OrderState_OPEN, time.Now(), events)
+	}
+	result := o.copy()
+	om.mu.Unlock()
+
+	om.emit(events)
+
+	if err == nil {
+		// market orders and marketable limit orders may already be filled
+		om.signal()
+	}
+
+	return result, err
+}
+
+// Cancel cancels an order by its client id or its oid, the cancellation is confirmed by the next reconciliation
+func (om *OrderManager) Cancel(id string) error {
+	om.mu.RLock()
+	o, ok := om.orders[id]
+	if !ok {
+		o, ok = om.byOid[id]
+	}
+	var oid string
+	if ok {
+		oid = o.Oid
+	}
+	om.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("unknown order %s", id)
+	}
+	if oid == "" {
+		return fmt.Errorf("order %s was not placed", id)
+	}
+
+	if err := om.trader.CancelOrder(oid); err != nil {
+		return err
+	}
+
+	om.signal()
+
+	return nil
+}
+
+// Reconcile applies the new user trades of the managed orders and the current status of the active ones. The user
+// trades are paged back to the newest one already reconciled.
+func (om *OrderManager) Reconcile() error {
+	om.mu.RLock()
+	active := make([]string, 0)
+	for oid, o := range om.byOid {
+		if !o.State.IsFinal() {
+			active = append(active, oid)
+		}
+	}
+	lastTid := om.lastTid
+	om.mu.RUnlock()
+	sort.Strings(active)
+
+	var orders []Order
+	var gone []string
+	var trades []UserTrade
+	if len(active) > 0 {
+		// the lookups go first, so the fills behind the statuses they return are among the trades fetched next
+		var err error
+		orders, err = om.trader.LookupOrders(active...)
+		if err != nil {
+			return err
+		}
+
+		gone, err = om.gone(active, orders)
+		if err != nil {
+			return err
+		}
+
+		trades, err = om.userTrades(lastTid)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	events := make([]OrderEvent, 0)
+
+	om.mu.Lock()
+
+	// user trades are newest first, a concurrent reconciliation may have applied some of them already
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Tid < trades[j].Tid })
+	for _, t := range trades {
+		if t.Tid <= om.lastTid {
+			continue
+		}
+		om.lastTid = t.Tid
+
+		if o, ok := om.byOid[t.Oid]; ok {
+			events = om.applyFill(o, t, now, events)
+		}
+	}
+
+	for _, order := range orders {
+		o, ok := om.byOid[order.Oid]
+		if !ok {
+			continue
+		}
+
+		// the user trades behind a final status may not be listed yet, the order stays active until its fills add
+		// up to what the status reports filled
+		settled := o.settled(order)
+
+		switch order.Status {
+		case OrderStatus_COMPLETED:
+			if settled {
+				events = om.move(o, OrderState_FILLED, now, events)
+			}
+		case OrderStatus_CANCELLED:
+			if settled {
+				events = om.move(o, OrderState_CANCELLED, now, events)
+			}
+		case OrderStatus_PARTIALLY_FILLED:
+			events = om.move(o, OrderState_PARTIALLY_FILLED, now, events)
+		}
+	}
+
+	// Bitso no longer knows these orders, they would stay active forever
+	for _, oid := range gone {
+		if o, ok := om.byOid[oid]; ok && !o.State.IsFinal() {
+			om.logger.Log(LogLevel_WARN, "order not found, given up as cancelled", Field("oid", oid))
+			o.Error = fmt.Errorf("order %s not found", oid)
+			events = om.move(o, OrderState_CANCELLED, now, events)
+		}
+	}
+
+	// with nothing left to reconcile the next order takes a new mark, instead of paging through the trades made
+	// in between. Orders still missing fills are not final, so their trades are never skipped.
+	idle := true
+	for _, o := range om.orders {
+		if !o.State.IsFinal() {
+			idle = false
+			break
+		}
+	}
+	if idle {
+		om.marked = false
+	}
+
+	om.mu.Unlock()
+
+	om.emit(events)
+
+	return nil
+}
+
+// gone returns the active orders missing from a lookup that a lookup of each one by its id does not find either
+func (om *OrderManager) gone(active []string, orders []Order) ([]string, error) {
+	found := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		found[order.Oid] = true
+	}
+
+	gone := make([]string, 0)
+	for _, oid := range active {
+		if found[oid] {
+			continue
+		}
+
+		confirmed, err := om.trader.LookupOrders(oid)
+		if err != nil {
+			return nil, err
+		}
+		if len(confirmed) == 0 {
+			gone = append(gone, oid)
+		}
+	}
+
+	return gone, nil
+}
+
+// userTrades pages through the user trades, newest first, until it reaches the trade with the given tid
+func (om *OrderManager) userTrades(after int64) ([]UserTrade, error) {
+	trades := make([]UserTrade, 0)
+
+	var marker int64
+	for {
+		page, err := om.trader.UserTrades("", marker, MAX_PAGE_LIMIT)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, page...)
+
+		if len(page) < MAX_PAGE_LIMIT || page[len(page) - 1].Tid <= after {
+			return trades, nil
+		}
+		marker = page[len(page) - 1].Tid
+	}
+}
+
+// applyFill must be called with the lock held
+func (om *OrderManager) applyFill(o *ManagedOrder, t UserTrade, now time.Time, events []OrderEvent) []OrderEvent {
+	o.Fills = append(o.Fills, t)
+	o.Filled = o.Filled.Add(t.Major.Abs())
+	o.FilledValue = o.FilledValue.Add(t.Minor.Abs())
+	o.Fees[t.FeesCurrency] = o.Fees[t.FeesCurrency].Add(t.FeesAmount)
+	o.UpdatedAt = now
+
+	p, ok := om.positions[t.Book]
+	if !ok {
+		p = &Position{Book: t.Book, Fees: make(map[CurrencyCode]decimal.Decimal)}
+		om.positions[t.Book] = p
+	}
+	p.Major = p.Major.Add(t.Major)
+	p.Minor = p.Minor.Add(t.Minor)
+	p.Fees[t.FeesCurrency] = p.Fees[t.FeesCurrency].Add(t.FeesAmount)
+
+	previous := o.State
+	if o.State == OrderState_OPEN || o.State == OrderState_PENDING_NEW {
+		o.State = OrderState_PARTIALLY_FILLED
+	}
+
+	fill := t
+	return append(events, OrderEvent{Order: o.copy(), Previous: previous, Fill: &fill})
+}
+
+// Attach reconciles as soon as a trade of an active order shows on the Trades channel of a websocket, instead of
+// waiting for the next periodic reconciliation of Start
+func (om *OrderManager) Attach(ws *Websocket) {
+	ws.OnTrades(func(book BookCode, trades []Trade) {
+		om.mu.RLock()
+		defer om.mu.RUnlock()
+
+		for _, t := range trades {
+			for _, oid := range []string{t.MakerOrderId, t.TakerOrderId} {
+				if o, ok := om.byOid[oid]; ok && !o.State.IsFinal() {
+					om.signal()
+					return
+				}
+			}
+		}
+	})
+}
+
+func (om *OrderManager) signal() {
+	select {
+	case om.wake <- true:
+	default:
+	}
+}
+
+// Start reconciles every interval, and right after orders are placed or cancelled, until Stop is called
+func (om *OrderManager) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-om.wake:
+			case <-om.quit:
+				return
+			}
+
+			if err := om.Reconcile(); err != nil {
+				om.mu.RLock()
+				logger := om.logger
+				om.mu.RUnlock()
+
+				logger.Log(LogLevel_WARN, "order reconciliation failed", Field("error", err))
+			}
+		}
+	}()
+}
+
+func (om *OrderManager) Stop() {
+	om.quitOnce.Do(func() {
+		close(om.quit)
+	})
+}
+
+// Order returns a managed order by its client id or its oid
+func (om *OrderManager) Order(id string) (ManagedOrder, bool) {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	o, ok := om.orders[id]
+	if !ok {
+		o, ok = om.byOid[id]
+	}
+	if !ok {
+		return ManagedOrder{}, false
+	}
+	return o.copy(), true
+}
+
+// Orders returns every managed order, oldest first; only the active ones if activeOnly is set
+func (om *OrderManager) Orders(activeOnly bool) []ManagedOrder {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	orders := make([]ManagedOrder, 0, len(om.orders))
+	for _, o := range om.orders {
+		if !activeOnly || !o.State.IsFinal() {
+			orders = append(orders, o.copy())
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.Before(orders[j].CreatedAt) })
+
+	return orders
+}
+
+// Positions returns the net position of every book traded by the managed orders
+func (om *OrderManager) Positions() map[BookCode]Position {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+
+	positions := make(map[BookCode]Position, len(om.positions))
+	for book, p := range om.positions {
+		c := *p
+		c.Fees = make(map[CurrencyCode]decimal.Decimal, len(p.Fees))
+		for currency, fee := range p.Fees {
+			c.Fees[currency] = fee
+		}
+		positions[book] = c
+	}
+
+	return positions
+}
@@ -0,0 +1,281 @@
+package bitso_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+func submit(t *testing.T, manager *bitso.OrderManager, major string) bitso.ManagedOrder {
+	t.Helper()
+
+	order, err := manager.Submit(bitso.OrderRequest{
+		Book: "btc_mxn",
+		Side: bitso.Side_BUY,
+		Type: bitso.OrderType_LIMIT,
+		Major: d(major),
+		Price: d("900000"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestOrderManagerPagesUserTrades(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	manager := bitso.NewOrderManager(server.Client())
+	order := submit(t, manager, "1")
+
+	// more fills than a page of user trades
+	for i := 0; i < 130; i++ {
+		if _, err := server.FillOrder(order.Oid, d("0.001")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := manager.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+
+	o, _ := manager.Order(order.Oid)
+	if len(o.Fills) != 130 || !o.Filled.Equal(d("0.13")) {
+		t.Errorf("%d fills for %s, expecting 130 for 0.13", len(o.Fills), o.Filled)
+	}
+	if o.State != bitso.OrderState_PARTIALLY_FILLED {
+		t.Errorf("order is %s, expecting %s", o.State, bitso.OrderState_PARTIALLY_FILLED)
+	}
+}
+
+func TestOrderManagerAppliesFillsOnce(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	manager := bitso.NewOrderManager(server.Client())
+	older := submit(t, manager, "1")
+	newer := submit(t, manager, "0.2")
+
+	if _, err := server.FillOrder(newer.Oid, d("0.2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.FillOrder(older.Oid, d("0.1")); err != nil {
+		t.Fatal(err)
+	}
+
+	fills := 0
+	manager.OnEvent(func(event bitso.OrderEvent) {
+		if event.Fill != nil {
+			fills++
+		}
+	})
+
+	// the older order keeps the fills of the newer one in the window of every reconciliation
+	for i := 0; i < 3; i++ {
+		if err := manager.Reconcile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fills != 2 {
+		t.Errorf("%d fill events, expecting 2", fills)
+	}
+
+	o, _ := manager.Order(newer.Oid)
+	if o.State != bitso.OrderState_FILLED || !o.Filled.Equal(d("0.2")) {
+		t.Errorf("newer order is %s with %s filled, expecting %s with 0.2", o.State, o.Filled, bitso.OrderState_FILLED)
+	}
+
+	position := manager.Positions()["btc_mxn"]
+	if !position.Major.Equal(d("0.3")) || !position.Minor.Equal(d("-270000")) {
+		t.Errorf("position is %s/%s, expecting 0.3/-270000", position.Major, position.Minor)
+	}
+}
+
+// laggingTrader hides the user trades of an order, as when a lookup reports it filled before its trades are listed
+type laggingTrader struct {
+	bitso.Trader
+
+	mu 		sync.Mutex
+	hidden 	string
+}
+
+func (lt *laggingTrader) hide(oid string) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	lt.hidden = oid
+}
+
+func (lt *laggingTrader) UserTrades(book bitso.BookCode, marker int64, limit int) ([]bitso.UserTrade, error) {
+	trades, err := lt.Trader.UserTrades(book, marker, limit)
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	visible := make([]bitso.UserTrade, 0, len(trades))
+	for _, t := range trades {
+		if t.Oid != lt.hidden {
+			visible = append(visible, t)
+		}
+	}
+	return visible, err
+}
+
+func TestOrderManagerWaitsForTheFills(t *testing.T) {
+	tests := []struct {
+		name 	string
+		cancel 	bool
+		state 	bitso.OrderState
+		filled 	string
+	}{
+		{"completed before its trade", false, bitso.OrderState_FILLED, "0.2"},
+		{"cancelled before its trade", true, bitso.OrderState_CANCELLED, "0.1"},
+	}
+
+	for _, tt := range tests {
+		server := bitsotest.NewServer()
+		trader := &laggingTrader{Trader: server.Client()}
+		manager := bitso.NewOrderManager(trader)
+		order := submit(t, manager, "0.2")
+
+		trader.hide(order.Oid)
+		if tt.cancel {
+			if _, err := server.FillOrder(order.Oid, d("0.1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := trader.CancelOrder(order.Oid); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := server.FillOrder(order.Oid, d("0.2")); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := manager.Reconcile(); err != nil {
+			t.Fatal(err)
+		}
+		if o, _ := manager.Order(order.Oid); o.State.IsFinal() {
+			t.Errorf("%s: order is %s without its fills, expecting it active", tt.name, o.State)
+		}
+
+		trader.hide("")
+		if err := manager.Reconcile(); err != nil {
+			t.Fatal(err)
+		}
+		if o, _ := manager.Order(order.Oid); o.State != tt.state || !o.Filled.Equal(d(tt.filled)) {
+			t.Errorf("%s: order is %s with %s filled, expecting %s with %s", tt.name, o.State, o.Filled, tt.state, tt.filled)
+		}
+
+		server.Close()
+	}
+}
+
+// forgetfulTrader drops an order from the lookups, only from those of several orders when batchOnly is set
+type forgetfulTrader struct {
+	bitso.Trader
+
+	forgotten 	string
+	batchOnly 	bool
+}
+
+func (ft *forgetfulTrader) LookupOrders(oids ...string) ([]bitso.Order, error) {
+	orders, err := ft.Trader.LookupOrders(oids...)
+	if ft.batchOnly && len(oids) == 1 {
+		return orders, err
+	}
+
+	known := make([]bitso.Order, 0, len(orders))
+	for _, o := range orders {
+		if o.Oid != ft.forgotten {
+			known = append(known, o)
+		}
+	}
+	return known, err
+}
+
+func TestOrderManagerGivesUpOrdersNotFound(t *testing.T) {
+	tests := []struct {
+		name 		string
+		batchOnly 	bool
+		state 		bitso.OrderState
+	}{
+		{"missing from every lookup", false, bitso.OrderState_CANCELLED},
+		{"missing from the batch lookup only", true, bitso.OrderState_OPEN},
+	}
+
+	for _, tt := range tests {
+		server := bitsotest.NewServer()
+		trader := &forgetfulTrader{Trader: server.Client(), batchOnly: tt.batchOnly}
+		manager := bitso.NewOrderManager(trader)
+		submit(t, manager, "0.1")
+		order := submit(t, manager, "0.2")
+		trader.forgotten = order.Oid
+
+		if err := manager.Reconcile(); err != nil {
+			t.Fatal(err)
+		}
+		if o, _ := manager.Order(order.Oid); o.State != tt.state || (o.Error != nil) != o.State.IsFinal() {
+			t.Errorf("%s: order is %s with error %v, expecting %s", tt.name, o.State, o.Error, tt.state)
+		}
+
+		server.Close()
+	}
+}
+
+// completingTrader reports every order completed and lists only the user trades it is given
+type completingTrader struct {
+	bitso.Trader
+
+	mu 		sync.Mutex
+	trades 	[]bitso.UserTrade
+}
+
+func (ct *completingTrader) LookupOrders(oids ...string) ([]bitso.Order, error) {
+	orders, err := ct.Trader.LookupOrders(oids...)
+	for i := range orders {
+		orders[i].Status = bitso.OrderStatus_COMPLETED
+	}
+	return orders, err
+}
+
+func (ct *completingTrader) UserTrades(book bitso.BookCode, marker int64, limit int) ([]bitso.UserTrade, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	return append([]bitso.UserTrade{}, ct.trades...), nil
+}
+
+func TestOrderManagerSettlesOrdersPlacedInMinor(t *testing.T) {
+	server := bitsotest.NewServer()
+	defer server.Close()
+
+	trader := &completingTrader{Trader: server.Client()}
+	manager := bitso.NewOrderManager(trader)
+	order, err := manager.Submit(bitso.OrderRequest{Book: "btc_mxn", Side: bitso.Side_BUY, Type: bitso.OrderType_MARKET, Minor: d("1000")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// completed without an amount in major, the order waits for the value of its fills
+	if err := manager.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := manager.Order(order.Oid); o.State.IsFinal() {
+		t.Errorf("order is %s without its fills, expecting it active", o.State)
+	}
+
+	trader.mu.Lock()
+	trader.trades = []bitso.UserTrade{{Book: "btc_mxn", Tid: 1, Oid: order.Oid, Side: bitso.Side_BUY, Major: d("0.001"), Minor: d("-1000"),
+		Price: d("1000000"), FeesCurrency: "btc"}}
+	trader.mu.Unlock()
+
+	if err := manager.Reconcile(); err != nil {
+		t.Fatal(err)
+	}
+	if o, _ := manager.Order(order.Oid); o.State != bitso.OrderState_FILLED {
+		t.Errorf("order is %s, expecting %s", o.State, bitso.OrderState_FILLED)
+	}
+}
@@ -0,0 +1,582 @@
+// Package paper implements bitso.Trader with simulated orders and balances, matched against real market data, so
+// strategies can be validated against live markets with no money at risk.
+package paper
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+// Trader simulates an account. Market orders and the marketable part of limit orders fill as taker against the
+// latest Orders snapshot of the book, consuming its levels until the next snapshot; resting limit orders fill as
+// maker, at their own price, when a trade prints at or through it. Fees are charged in the received currency, as
+// Bitso does.
+type Trader struct {
+	mu 			sync.Mutex
+
+	books 		map[bitso.BookCode]bitso.Book
+	fees 		map[bitso.BookCode]bitso.Fee
+	available 	map[bitso.CurrencyCode]decimal.Decimal
+	locked 		map[bitso.CurrencyCode]decimal.Decimal
+
+	orders 		map[string]*order
+	orderIds 	[]string // in placement order
+	fills 		[]bitso.UserTrade
+	snapshots 	map[bitso.BookCode]bitso.Orders
+
+	orderSeq 	int64
+	tradeSeq 	int64
+	clock 		func() time.Time
+	onFill 		[]func(fill bitso.UserTrade)
+}
+
+// order is the simulated order plus the funds still locked for it
+type order struct {
+	bitso.Order
+	book 			bitso.Book
+	filled 			decimal.Decimal // units: major
+	value 			decimal.Decimal // units: minor, unrounded value of the fills of a buy
+	paid 			decimal.Decimal // units: minor, the value of a buy rounded up once per order
+	locked 			decimal.Decimal
+	lockedCurrency 	bitso.CurrencyCode
+}
+
+// ErrorCode_INSUFFICIENT_BALANCE is the code of the bitso.ApiError of orders the available funds cannot pay for
+const ErrorCode_INSUFFICIENT_BALANCE = "0379"
+
+func insufficientBalance(currency bitso.CurrencyCode) error {
+	return bitso.ApiError{Code: ErrorCode_INSUFFICIENT_BALANCE, Message: fmt.Sprintf("insufficient %s balance", currency)}
+}
+
+var _ bitso.Trader = (*Trader)(nil)
+
+// NewTrader returns a simulated account for the given books (see Client.AvailableBooks), fees (see
+// Client.AccountFees) and starting available balances
+func NewTrader(books map[bitso.BookCode]bitso.Book, fees map[bitso.BookCode]bitso.Fee, balances map[bitso.CurrencyCode]decimal.Decimal) *Trader {
+	t := &Trader{
+		books: books,
+		fees: fees,
+		available: make(map[bitso.CurrencyCode]decimal.Decimal),
+		locked: make(map[bitso.CurrencyCode]decimal.Decimal),
+		orders: make(map[string]*order),
+		snapshots: make(map[bitso.BookCode]bitso.Orders),
+		clock: time.Now,
+	}
+
+	for c, amount := range balances {
+		t.available[c] = amount
+	}
+
+	return t
+}
+
+// SetClock replaces the time source used for the order and trade timestamps, ex. to replay historical data
+func (t *Trader) SetClock(clock func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.clock = clock
+}
+
+// OnFill registers a callback called (with the Trader's lock released) after every simulated fill
+func (t *Trader) OnFill(callback func(fill bitso.UserTrade)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onFill = append(t.onFill, callback)
+}
+
+// Attach feeds the Trader with the Orders and Trades channels of a websocket, the caller still has to subscribe
+// to both channels of every book it trades
+func (t *Trader) Attach(ws *bitso.Websocket) {
+	ws.OnOrders(t.UpdateOrders)
+	ws.OnTrades(t.UpdateTrades)
+}
+
+// UpdateOrders sets the latest order book snapshot of a book, used to fill taker orders. The Trader keeps its own
+// copy, whose levels are consumed by the taker fills until the next snapshot.
+func (t *Trader) UpdateOrders(book bitso.BookCode, orders bitso.Orders) {
+	snapshot := bitso.Orders{
+		Bids: append([]bitso.Offer(nil), orders.Bids...),
+		Asks: append([]bitso.Offer(nil), orders.Asks...),
+	}
+
+	t.mu.Lock()
+	t.snapshots[book] = snapshot
+	t.mu.Unlock()
+}
+
+// UpdateTrades fills the resting orders of the book crossed by the trades
+func (t *Trader) UpdateTrades(book bitso.BookCode, trades []bitso.Trade) {
+	t.mu.Lock()
+
+	fills := make([]bitso.UserTrade, 0)
+
+	for _, trade := range trades {
+		printed := trade.Amount
+
+		for _, oid := range t.orderIds {
+			if !printed.IsPositive() {
+				break
+			}
+
+			o := t.orders[oid]
+			if o.Book != book || o.Type != bitso.OrderType_LIMIT || !o.Status.IsActive() {
+				continue
+			}
+
+			crossed := (o.Side == bitso.Side_BUY && trade.Rate.LessThanOrEqual(o.Price)) ||
+				(o.Side == bitso.Side_SELL && trade.Rate.GreaterThanOrEqual(o.Price))
+			if !crossed {
+				continue
+			}
+
+			amount := decimal.Min(printed, o.UnfilledAmount)
+			printed = printed.Sub(amount)
+
+			fills = append(fills, t.fill(o, amount, o.Price, o.Side))
+		}
+	}
+
+	callbacks := t.onFill
+	t.mu.Unlock()
+
+	notify(callbacks, fills)
+}
+
+func notify(callbacks []func(fill bitso.UserTrade), fills []bitso.UserTrade) {
+	for _, f := range fills {
+		for _, cb := range callbacks {
+			cb(f)
+		}
+	}
+}
+
+// PlaceOrder validates the order against the book limits and the available funds, fills whatever is marketable
+// and leaves the rest of a limit order resting
+func (t *Trader) PlaceOrder(req bitso.OrderRequest) (string, error) {
+	t.mu.Lock()
+
+	book, ok := t.books[req.Book]
+	if !ok {
+		t.mu.Unlock()
+		return "", fmt.Errorf("paper: unknown book %s", req.Book)
+	}
+
+	req, err := t.validate(book, req)
+	if err != nil {
+		t.mu.Unlock()
+		return "", err
+	}
+
+	now := t.clock()
+	t.orderSeq++
+
+	o := &order{
+		Order: bitso.Order{
+			Book: req.Book,
+			Oid: "paper" + strconv.FormatInt(t.orderSeq, 10),
+			OriginId: req.OriginId,
+			Side: req.Side,
+			Type: req.Type,
+			Status: bitso.OrderStatus_OPEN,
+			OriginalAmount: req.Major,
+			UnfilledAmount: req.Major,
+			OriginalValue: req.Major.Mul(req.Price),
+			Price: req.Price,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		book: book,
+	}
+
+	if req.Type == bitso.OrderType_LIMIT {
+		// lock the funds for the whole order
+		if req.Side == bitso.Side_BUY {
+			o.lockedCurrency = book.Minor.Code
+			o.locked = req.Major.Mul(req.Price).RoundCeil(int32(book.Minor.Precision))
+		} else {
+			o.lockedCurrency = book.Major.Code
+			o.locked = req.Major
+		}
+
+		if t.available[o.lockedCurrency].LessThan(o.locked) {
+			t.mu.Unlock()
+			return "", insufficientBalance(o.lockedCurrency)
+		}
+
+		t.available[o.lockedCurrency] = t.available[o.lockedCurrency].Sub(o.locked)
+		t.locked[o.lockedCurrency] = t.locked[o.lockedCurrency].Add(o.locked)
+	} else {
+		o.OriginalValue = req.Minor
+
+		if currency, ok := t.funds(o); !ok {
+			t.mu.Unlock()
+			return "", insufficientBalance(currency)
+		}
+	}
+
+	t.orders[o.Oid] = o
+	t.orderIds = append(t.orderIds, o.Oid)
+
+	fills, complete := t.take(o, req.Minor)
+
+	if o.Type == bitso.OrderType_MARKET {
+		// market orders never rest, whatever the book or the funds could not fill is cancelled
+		if o.OriginalAmount.IsZero() {
+			o.OriginalAmount = o.filled
+		}
+		if o.filled.IsPositive() && complete {
+			o.Status = bitso.OrderStatus_COMPLETED
+		} else {
+			o.Status = bitso.OrderStatus_CANCELLED
+		}
+	}
+
+	callbacks := t.onFill
+	t.mu.Unlock()
+
+	notify(callbacks, fills)
+
+	return o.Oid, nil
+}
+
+// validate returns the request rounded to the precision of the book and checked against its limits, limit orders
+// with Book.ValidateOrder and market orders with Book.ValidateMarketOrder over the latest snapshot. Their errors
+// are returned as is. Must be called with the lock held.
+func (t *Trader) validate(book bitso.Book, req bitso.OrderRequest) (bitso.OrderRequest, error) {
+	var err error
+
+	switch req.Type {
+	case bitso.OrderType_LIMIT:
+		req.Price, req.Major, err = book.ValidateOrder(req.Side, req.Price, req.Major)
+		return req, err
+
+	case bitso.OrderType_MARKET:
+		snapshot, ok := t.snapshots[req.Book]
+		if !ok {
+			return req, fmt.Errorf("paper: no order book received yet for %s", req.Book)
+		}
+		req.Major, req.Minor, err = book.ValidateMarketOrder(snapshot, req.Side, req.Major, req.Minor)
+		return req, err
+
+	default:
+		return req, fmt.Errorf("paper: unknown order type %s", req.Type)
+	}
+}
+
+// take fills the order as taker against the latest snapshot, up to its limit price, and removes the filled amounts
+// from the snapshot. For market orders given in minor, minor is the amount to spend (buy) or receive (sell). It
+// returns the fills and whether the whole order was filled: for those given in minor, until what is left cannot
+// buy the smallest amount of major. Must be called with the lock held.
+func (t *Trader) take(o *order, minor decimal.Decimal) ([]bitso.UserTrade, bool) {
+	fills := make([]bitso.UserTrade, 0)
+
+	snapshot := t.snapshots[o.Book]
+	levels := snapshot.Asks
+	if o.Side == bitso.Side_SELL {
+		levels = snapshot.Bids
+	}
+
+	byMinor := o.Type == bitso.OrderType_MARKET && o.OriginalAmount.IsZero()
+	remainingMinor := minor
+	var lastRate decimal.Decimal
+
+	for i := range levels {
+		level := &levels[i]
+		lastRate = level.Rate
+
+		if o.Type == bitso.OrderType_LIMIT {
+			if (o.Side == bitso.Side_BUY && level.Rate.GreaterThan(o.Price)) || (o.Side == bitso.Side_SELL && level.Rate.LessThan(o.Price)) {
+				break
+			}
+		}
+
+		var wanted decimal.Decimal
+		if byMinor {
+			wanted = remainingMinor.Div(level.Rate).Truncate(int32(o.book.Major.Precision))
+		} else {
+			wanted = o.UnfilledAmount
+		}
+		if !wanted.IsPositive() {
+			break
+		}
+
+		amount := t.affordable(o, decimal.Min(level.Amount, wanted), level.Rate)
+		if !amount.IsPositive() {
+			break
+		}
+
+		fill := t.fill(o, amount, level.Rate, o.Side.Opposite())
+		fills = append(fills, fill)
+
+		level.Amount = level.Amount.Sub(amount)
+		if byMinor {
+			remainingMinor = remainingMinor.Sub(amount.Mul(level.Rate))
+		}
+
+		if level.Amount.IsPositive() {
+			// the order or its funds ran out within this level
+			break
+		}
+	}
+
+	complete := !o.UnfilledAmount.IsPositive()
+	if byMinor {
+		complete = lastRate.IsPositive() && !remainingMinor.Div(lastRate).Truncate(int32(o.book.Major.Precision)).IsPositive()
+	}
+
+	// drop the levels consumed entirely
+	consumed := 0
+	for consumed < len(levels) && !levels[consumed].Amount.IsPositive() {
+		consumed++
+	}
+	if o.Side == bitso.Side_BUY {
+		snapshot.Asks = levels[consumed:]
+	} else {
+		snapshot.Bids = levels[consumed:]
+	}
+	t.snapshots[o.Book] = snapshot
+
+	return fills, complete
+}
+
+// affordable limits the amount of a market order to the available funds, limit orders already locked theirs.
+// Must be called with the lock held.
+func (t *Trader) affordable(o *order, amount, rate decimal.Decimal) decimal.Decimal {
+	if o.Type == bitso.OrderType_LIMIT {
+		return amount
+	}
+
+	if o.Side == bitso.Side_BUY {
+		available := t.available[o.book.Minor.Code]
+		if amount.Mul(rate).GreaterThan(available) {
+			return available.Div(rate).Truncate(int32(o.book.Major.Precision))
+		}
+		return amount
+	}
+
+	return decimal.Min(amount, t.available[o.book.Major.Code])
+}
+
+// funds returns the currency a market order pays with and whether the available funds pay for any of the best level
+// of the latest snapshot. Must be called with the lock held.
+func (t *Trader) funds(o *order) (bitso.CurrencyCode, bool) {
+	snapshot := t.snapshots[o.Book]
+	levels, currency := snapshot.Asks, o.book.Minor.Code
+	if o.Side == bitso.Side_SELL {
+		levels, currency = snapshot.Bids, o.book.Major.Code
+	}
+
+	if len(levels) == 0 {
+		return currency, true
+	}
+	return currency, t.affordable(o, levels[0].Amount, levels[0].Rate).IsPositive()
+}
+
+// fill executes amount of the order at rate, moving balances and charging the maker or taker fee. Must be called
+// with the lock held.
+func (t *Trader) fill(o *order, amount, rate decimal.Decimal, makerSide bitso.Side) bitso.UserTrade {
+	role := bitso.FeeRole_TAKER
+	if makerSide == o.Side {
+		role = bitso.FeeRole_MAKER
+	}
+
+	e := bitso.EstimateFee(o.book, t.fees[o.Book], o.Side, role, amount, rate)
+
+	if o.Side == bitso.Side_BUY {
+		// the value paid is rounded up once per order, so the fills never cost more than the funds locked
+		o.value = o.value.Add(amount.Mul(rate))
+		paid := o.value.RoundCeil(int32(o.book.Minor.Precision))
+		e.GrossMinor = paid.Sub(o.paid)
+		e.NetMinor = e.GrossMinor.Sub(e.FeeMinor)
+		e.Paid = e.GrossMinor
+		o.paid = paid
+	}
+
+	trade := bitso.UserTrade{
+		Book: o.Book,
+		Oid: o.Oid,
+		Side: o.Side,
+		Price: rate,
+		MakerSide: makerSide,
+		CreatedAt: t.clock(),
+		FeesCurrency: e.FeeCurrency,
+	}
+
+	if o.Side == bitso.Side_BUY {
+		t.spend(o, o.book.Minor.Code, e.Paid)
+		t.available[o.book.Major.Code] = t.available[o.book.Major.Code].Add(e.Received)
+
+		trade.Major = e.GrossMajor
+		trade.Minor = e.GrossMinor.Neg()
+		trade.FeesAmount = e.FeeMajor
+	} else {
+		t.spend(o, o.book.Major.Code, e.Paid)
+		t.available[o.book.Minor.Code] = t.available[o.book.Minor.Code].Add(e.Received)
+
+		trade.Major = e.GrossMajor.Neg()
+		trade.Minor = e.GrossMinor
+		trade.FeesAmount = e.FeeMinor
+	}
+
+	t.tradeSeq++
+	trade.Tid = t.tradeSeq
+	t.fills = append(t.fills, trade)
+
+	o.filled = o.filled.Add(amount)
+	if o.OriginalAmount.IsPositive() {
+		o.UnfilledAmount = o.UnfilledAmount.Sub(amount)
+	}
+	o.UpdatedAt = trade.CreatedAt
+
+	if o.Type == bitso.OrderType_LIMIT {
+		if o.UnfilledAmount.IsZero() {
+			o.Status = bitso.OrderStatus_COMPLETED
+			t.release(o)
+		} else {
+			o.Status = bitso.OrderStatus_PARTIALLY_FILLED
+		}
+	}
+
+	return trade
+}
+
+// spend takes the funds of a fill from the order's locked funds, or from the available balance for market orders
+func (t *Trader) spend(o *order, currency bitso.CurrencyCode, amount decimal.Decimal) {
+	if o.lockedCurrency == currency && o.locked.IsPositive() {
+		fromLocked := decimal.Min(amount, o.locked)
+		o.locked = o.locked.Sub(fromLocked)
+		t.locked[currency] = t.locked[currency].Sub(fromLocked)
+		amount = amount.Sub(fromLocked)
+	}
+
+	t.available[currency] = t.available[currency].Sub(amount)
+}
+
+// release returns whatever is still locked for the order to the available balance
+func (t *Trader) release(o *order) {
+	if !o.locked.IsPositive() {
+		return
+	}
+
+	t.locked[o.lockedCurrency] = t.locked[o.lockedCurrency].Sub(o.locked)
+	t.available[o.lockedCurrency] = t.available[o.lockedCurrency].Add(o.locked)
+	o.locked = decimal.Zero
+}
+
+// CancelOrder cancels an active order and releases its locked funds
+func (t *Trader) CancelOrder(oid string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	o, ok := t.orders[oid]
+	if !ok || !o.Status.IsActive() {
+		return fmt.Errorf("paper: order %s is not open", oid)
+	}
+
+	o.Status = bitso.OrderStatus_CANCELLED
+	o.UpdatedAt = t.clock()
+	t.release(o)
+
+	return nil
+}
+
+// OpenOrders returns the active orders of a book, or of every book when empty
+func (t *Trader) OpenOrders(book bitso.BookCode) ([]bitso.Order, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	orders := make([]bitso.Order, 0)
+	for _, oid := range t.orderIds {
+		o := t.orders[oid]
+		if o.Status.IsActive() && (book == "" || o.Book == book) {
+			orders = append(orders, o.Order)
+		}
+	}
+
+	return orders, nil
+}
+
+// LookupOrders returns the orders with the given ids, in any state
+func (t *Trader) LookupOrders(oids ...string) ([]bitso.Order, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	orders := make([]bitso.Order, 0, len(oids))
+	for _, oid := range oids {
+		if o, ok := t.orders[oid]; ok {
+			orders = append(orders, o.Order)
+		}
+	}
+
+	return orders, nil
+}
+
+// LookupOrdersByOrigin returns the orders placed with the given origin ids, in any state
+func (t *Trader) LookupOrdersByOrigin(originIds ...string) ([]bitso.Order, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	orders := make([]bitso.Order, 0, len(originIds))
+	for _, id := range originIds {
+		for _, oid := range t.orderIds {
+			if o := t.orders[oid]; id != "" && o.OriginId == id {
+				orders = append(orders, o.Order)
+			}
+		}
+	}
+
+	return orders, nil
+}
+
+// AccountBalance returns the simulated balances
+func (t *Trader) AccountBalance() (map[bitso.CurrencyCode]bitso.Balance, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := make(map[bitso.CurrencyCode]bitso.Balance)
+
+	for c, available := range t.available {
+		locked := t.locked[c]
+		m[c] = bitso.Balance{Currency: c, Available: available, Locked: locked, Total: available.Add(locked)}
+	}
+	for c, locked := range t.locked {
+		if _, ok := m[c]; !ok {
+			m[c] = bitso.Balance{Currency: c, Available: decimal.Zero, Locked: locked, Total: locked}
+		}
+	}
+
+	return m, nil
+}
+
+// UserTrades returns the simulated fills of a book, or of every book when empty, newest first. Like the API, a non
+// zero marker returns the fills older than that tid and a zero limit returns at most bitso.DEFAULT_PAGE_LIMIT fills.
+func (t *Trader) UserTrades(book bitso.BookCode, marker int64, limit int) ([]bitso.UserTrade, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if limit <= 0 {
+		limit = bitso.DEFAULT_PAGE_LIMIT
+	}
+
+	trades := make([]bitso.UserTrade, 0)
+	for _, f := range t.fills {
+		if (book == "" || f.Book == book) && (marker == 0 || f.Tid < marker) {
+			trades = append(trades, f)
+		}
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Tid > trades[j].Tid })
+	if len(trades) > limit {
+		trades = trades[:limit]
+	}
+
+	return trades, nil
+}
@@ -0,0 +1,285 @@
+package paper
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+var books = map[bitso.BookCode]bitso.Book{
+	bitso.BookCode_BTC_MXN: {
+		BookCode: bitso.BookCode_BTC_MXN,
+		Major: bitso.CurrencyList()[bitso.CurrencyCode_BTC],
+		Minor: bitso.CurrencyList()[bitso.CurrencyCode_MXN],
+		MinimumAmount: decimal.RequireFromString("0.00001"),
+		MaximumAmount: decimal.NewFromInt(500),
+		MinimumPrice: decimal.NewFromInt(1),
+		MaximumPrice: decimal.NewFromInt(10000000),
+		MinimumValue: decimal.NewFromInt(10),
+		MaximumValue: decimal.NewFromInt(10000000),
+	},
+}
+
+var fees = map[bitso.BookCode]bitso.Fee{
+	bitso.BookCode_BTC_MXN: {BookCode: bitso.BookCode_BTC_MXN, TakerFeeDecimal: decimal.RequireFromString("0.0065"), MakerFeeDecimal: decimal.RequireFromString("0.005")},
+}
+
+// funded is 100000 MXN and 1 BTC
+var funded = map[bitso.CurrencyCode]decimal.Decimal{bitso.CurrencyCode_MXN: decimal.NewFromInt(100000), bitso.CurrencyCode_BTC: decimal.NewFromInt(1)}
+
+// lookup returns a single order of the trader
+func lookup(t *testing.T, trader *Trader, oid string) bitso.Order {
+	t.Helper()
+
+	orders, err := trader.LookupOrders(oid)
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("lookup of %s returned %v, %v", oid, orders, err)
+	}
+	return orders[0]
+}
+
+func TestMarketOrderLimits(t *testing.T) {
+	tests := []struct {
+		name 	string
+		side 	bitso.Side
+		major 	string
+		minor 	string
+		limit 	bitso.OrderLimit // empty when accepted
+	}{
+		{"buy major", bitso.Side_BUY, "0.01", "0", ""},
+		{"sell minor", bitso.Side_SELL, "0", "1000", ""},
+		{"amount below minimum", bitso.Side_BUY, "0.000001", "0", bitso.OrderLimit_MINIMUM_AMOUNT},
+		{"minor below minimum", bitso.Side_BUY, "0", "5", bitso.OrderLimit_MINIMUM_VALUE},
+		{"amount above maximum", bitso.Side_SELL, "501", "0", bitso.OrderLimit_MAXIMUM_AMOUNT},
+	}
+
+	for _, tt := range tests {
+		trader := NewTrader(books, fees, funded)
+		trader.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: decimal.NewFromInt(899000), Amount: decimal.NewFromInt(1)}},
+			Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.NewFromInt(1)}},
+		})
+
+		_, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: tt.side, Type: bitso.OrderType_MARKET,
+			Major: decimal.RequireFromString(tt.major), Minor: decimal.RequireFromString(tt.minor)})
+		if limitErr, ok := err.(bitso.OrderLimitError); (tt.limit == "" && err != nil) || (tt.limit != "" && (!ok || limitErr.Limit != tt.limit)) {
+			t.Errorf("%s: received %v, expecting the %q limit", tt.name, err, tt.limit)
+		}
+	}
+}
+
+func TestTakerConsumesBook(t *testing.T) {
+	trader := NewTrader(books, fees, funded)
+	trader.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+		Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.RequireFromString("0.05")}, {Rate: decimal.NewFromInt(901000), Amount: decimal.RequireFromString("0.05")}},
+	})
+
+	tests := []struct {
+		name 	string
+		major 	string
+		fills 	[]string // price x amount
+		status 	bitso.OrderStatus
+	}{
+		{"walks two levels", "0.08", []string{"900000 x 0.05", "901000 x 0.03"}, bitso.OrderStatus_COMPLETED},
+		// the same liquidity is never filled twice, the book runs out
+		{"what is left", "0.03", []string{"901000 x 0.02"}, bitso.OrderStatus_CANCELLED},
+	}
+
+	for _, tt := range tests {
+		before, _ := trader.UserTrades("", 0, 0)
+
+		oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: bitso.Side_BUY, Type: bitso.OrderType_MARKET, Major: decimal.RequireFromString(tt.major)})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		after, _ := trader.UserTrades("", 0, 0)
+		fills := make([]string, 0)
+		for i := len(after) - len(before) - 1; i >= 0; i-- {
+			fills = append(fills, after[i].Price.String() + " x " + after[i].Major.String())
+		}
+		if fmt.Sprint(fills) != fmt.Sprint(tt.fills) {
+			t.Errorf("%s: filled %v, expecting %v", tt.name, fills, tt.fills)
+		}
+
+		if o := lookup(t, trader, oid); o.Status != tt.status {
+			t.Errorf("%s: order is %s, expecting %s", tt.name, o.Status, tt.status)
+		}
+	}
+}
+
+func TestMarketOrderInMinor(t *testing.T) {
+	tests := []struct {
+		name 	string
+		minor 	string
+		status 	bitso.OrderStatus // 0.01 BTC filled either way
+	}{
+		{"filled", "9000", bitso.OrderStatus_COMPLETED},
+		{"rounding leftover", "9000.001", bitso.OrderStatus_COMPLETED},
+		{"book runs out", "18000", bitso.OrderStatus_CANCELLED},
+	}
+
+	for _, tt := range tests {
+		trader := NewTrader(books, fees, funded)
+		trader.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+			Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.RequireFromString("0.01")}},
+		})
+
+		oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: bitso.Side_BUY, Type: bitso.OrderType_MARKET, Minor: decimal.RequireFromString(tt.minor)})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if o := lookup(t, trader, oid); o.Status != tt.status || o.OriginalAmount.String() != "0.01" {
+			t.Errorf("%s: order is %s with %s filled, expecting %s with 0.01", tt.name, o.Status, o.OriginalAmount, tt.status)
+		}
+	}
+}
+
+func TestLimitOrderMatching(t *testing.T) {
+	trader := NewTrader(books, fees, funded)
+	trader.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+		Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.RequireFromString("0.01")}},
+	})
+
+	// marketable up to the best ask, the rest rests at the limit price
+	oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: bitso.Side_BUY, Type: bitso.OrderType_LIMIT,
+		Major: decimal.RequireFromString("0.02"), Price: decimal.NewFromInt(900500)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name 		string
+		rate 		int64 // of the trade printed after the step, none for the placement
+		amount 		string
+		fill 		string // price x amount x maker side x fee of the new fill, empty when none
+		status 		bitso.OrderStatus
+	}{
+		{"taker fill", 0, "", "900000 x 0.01 x SELL x 0.000065", bitso.OrderStatus_PARTIALLY_FILLED},
+		{"trade above the limit", 900600, "1", "", bitso.OrderStatus_PARTIALLY_FILLED},
+		{"maker fill", 900400, "0.005", "900500 x 0.005 x BUY x 0.000025", bitso.OrderStatus_PARTIALLY_FILLED},
+		{"maker fill at the limit", 900500, "1", "900500 x 0.005 x BUY x 0.000025", bitso.OrderStatus_COMPLETED},
+	}
+
+	seen := 0
+	for _, step := range steps {
+		if step.rate > 0 {
+			trader.UpdateTrades(bitso.BookCode_BTC_MXN, []bitso.Trade{{Rate: decimal.NewFromInt(step.rate), Amount: decimal.RequireFromString(step.amount)}})
+		}
+
+		fill := ""
+		trades, _ := trader.UserTrades("", 0, 0)
+		if len(trades) > seen {
+			f := trades[0]
+			fill = fmt.Sprintf("%s x %s x %s x %s", f.Price, f.Major, f.MakerSide, f.FeesAmount)
+		}
+		if fill != step.fill || len(trades) > seen + 1 {
+			t.Errorf("%s: %d new fills, the newest %q, expecting %q", step.name, len(trades) - seen, fill, step.fill)
+		}
+		seen = len(trades)
+
+		if o := lookup(t, trader, oid); o.Status != step.status {
+			t.Errorf("%s: order is %s, expecting %s", step.name, o.Status, step.status)
+		}
+	}
+
+	// 0.02 BTC bought for 9000 + 9005 MXN, minus the fees
+	balances, _ := trader.AccountBalance()
+	if mxn := balances[bitso.CurrencyCode_MXN]; mxn.Available.String() != "81995" || !mxn.Locked.IsZero() {
+		t.Errorf("MXN balance is %s available and %s locked, expecting 81995 and 0", mxn.Available, mxn.Locked)
+	}
+	if btc := balances[bitso.CurrencyCode_BTC]; btc.Available.String() != "1.019885" {
+		t.Errorf("BTC balance is %s, expecting 1.019885", btc.Available)
+	}
+}
+
+func TestLimitOrderLocksFunds(t *testing.T) {
+	tests := []struct {
+		name 		string
+		side 		bitso.Side
+		major 		string
+		price 		int64
+		currency 	bitso.CurrencyCode
+		locked 		string // empty when rejected for lack of funds
+	}{
+		{"buy locks the value", bitso.Side_BUY, "0.01", 800000, bitso.CurrencyCode_MXN, "8000"},
+		{"sell locks the amount", bitso.Side_SELL, "0.5", 1000000, bitso.CurrencyCode_BTC, "0.5"},
+		{"insufficient balance", bitso.Side_BUY, "1", 800000, bitso.CurrencyCode_MXN, ""},
+	}
+
+	for _, tt := range tests {
+		trader := NewTrader(books, fees, funded)
+
+		oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: tt.side, Type: bitso.OrderType_LIMIT,
+			Major: decimal.RequireFromString(tt.major), Price: decimal.NewFromInt(tt.price)})
+		if e, ok := err.(bitso.ApiError); tt.locked == "" && (!ok || e.Code != ErrorCode_INSUFFICIENT_BALANCE) {
+			t.Errorf("%s: received %v, expecting an insufficient balance error", tt.name, err)
+		}
+		if tt.locked == "" {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		balances, _ := trader.AccountBalance()
+		if b := balances[tt.currency]; b.Locked.String() != tt.locked || !b.Available.Add(b.Locked).Equal(funded[tt.currency]) {
+			t.Errorf("%s: %s is %s available and %s locked, expecting %s locked", tt.name, tt.currency, b.Available, b.Locked, tt.locked)
+		}
+
+		// cancelling releases everything
+		if err := trader.CancelOrder(oid); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		balances, _ = trader.AccountBalance()
+		if b := balances[tt.currency]; !b.Locked.IsZero() || !b.Available.Equal(funded[tt.currency]) {
+			t.Errorf("%s: %s is %s available and %s locked after the cancellation, expecting everything released", tt.name, tt.currency, b.Available, b.Locked)
+		}
+	}
+}
+
+func TestMarketOrderWithoutFunds(t *testing.T) {
+	for _, side := range []bitso.Side{bitso.Side_BUY, bitso.Side_SELL} {
+		trader := NewTrader(books, fees, nil)
+		trader.UpdateOrders(bitso.BookCode_BTC_MXN, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: decimal.NewFromInt(899000), Amount: decimal.NewFromInt(1)}},
+			Asks: []bitso.Offer{{Rate: decimal.NewFromInt(900000), Amount: decimal.NewFromInt(1)}},
+		})
+
+		oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: side, Type: bitso.OrderType_MARKET, Major: decimal.RequireFromString("0.01")})
+		if e, ok := err.(bitso.ApiError); !ok || e.Code != ErrorCode_INSUFFICIENT_BALANCE || oid != "" {
+			t.Errorf("%s: placed %q with error %v, expecting an insufficient balance error", side, oid, err)
+		}
+	}
+}
+
+func TestLimitOrderPaysTheLockedFunds(t *testing.T) {
+	trader := NewTrader(books, fees, funded)
+
+	// 10.0000002 MXN locked as 10.01, the fills of a third each round up to 3.34
+	oid, err := trader.PlaceOrder(bitso.OrderRequest{Book: bitso.BookCode_BTC_MXN, Side: bitso.Side_BUY, Type: bitso.OrderType_LIMIT,
+		Major: decimal.RequireFromString("0.00003"), Price: decimal.RequireFromString("333333.34")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		trader.UpdateTrades(bitso.BookCode_BTC_MXN, []bitso.Trade{{Rate: decimal.RequireFromString("333333.34"), Amount: decimal.RequireFromString("0.00001")}})
+	}
+
+	if o := lookup(t, trader, oid); o.Status != bitso.OrderStatus_COMPLETED {
+		t.Fatalf("order is %s, expecting %s", o.Status, bitso.OrderStatus_COMPLETED)
+	}
+
+	paid := decimal.Zero
+	trades, _ := trader.UserTrades("", 0, 0)
+	for _, f := range trades {
+		paid = paid.Sub(f.Minor)
+	}
+	balances, _ := trader.AccountBalance()
+	if mxn := balances[bitso.CurrencyCode_MXN]; paid.String() != "10.01" || mxn.Available.String() != "99989.99" || !mxn.Locked.IsZero() {
+		t.Errorf("paid %s, MXN balance is %s available and %s locked, expecting 10.01 paid and 99989.99 and 0", paid, mxn.Available, mxn.Locked)
+	}
+}
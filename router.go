@@ -0,0 +1,208 @@
+package bitso
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// DEFAULT_MAX_HOPS is the longest route searched by a Router unless SetMaxHops is called
+const DEFAULT_MAX_HOPS = 3
+
+// RouteLeg is one conversion of a route, executed as a taker at the top of the book
+type RouteLeg struct {
+	Book 		BookCode
+	Side 		Side // buy when converting the minor currency into the major
+	From 		CurrencyCode
+	To 			CurrencyCode
+	Rate 		decimal.Decimal // units: minor per major, the best ask when buying and the best bid when selling
+	FeeRate 	decimal.Decimal
+	Factor 		decimal.Decimal // units of To received per unit of From, after the fee
+}
+
+// Route is a path of conversions between two currencies
+type Route struct {
+	From 	CurrencyCode
+	To 		CurrencyCode
+	Legs 	[]RouteLeg
+	Rate 	decimal.Decimal // units of To received per unit of From, after every fee
+}
+
+// Expected returns the amount of To received for an amount of From, ignoring the depth of the books
+func (r Route) Expected(amount decimal.Decimal) decimal.Decimal {
+	return amount.Mul(r.Rate)
+}
+
+// Router finds the best conversion between two currencies across every book, direct or through other currencies
+// (ex. LTC to MXN through BTC), using the top of the books and the taker fee of each book
+type Router struct {
+	books 	map[BookCode]Book
+	fees 	map[BookCode]Fee
+
+	mu 		sync.RWMutex
+	tops 	map[BookCode]topOfBook
+	maxHops int
+}
+
+// topOfBook is the best offer of each side of a book, zero when the side is empty
+type topOfBook struct {
+	bid 		Offer
+	ask 		Offer
+}
+
+func newTopOfBook(orders Orders) topOfBook {
+	top := topOfBook{}
+	if len(orders.Bids) > 0 {
+		top.bid = orders.Bids[0]
+	}
+	if len(orders.Asks) > 0 {
+		top.ask = orders.Asks[0]
+	}
+	return top
+}
+
+// conversionLeg returns the leg converting from into the other currency of the book, at the top of the book
+func conversionLeg(book Book, feeRate decimal.Decimal, top topOfBook, from CurrencyCode) (RouteLeg, bool) {
+	one := decimal.NewFromInt(1)
+
+	switch from {
+	case book.Major.Code:
+		if !top.bid.Rate.IsPositive() {
+			return RouteLeg{}, false
+		}
+		return RouteLeg{
+			Book: book.BookCode,
+			Side: Side_SELL,
+			From: from,
+			To: book.Minor.Code,
+			Rate: top.bid.Rate,
+			FeeRate: feeRate,
+			Factor: top.bid.Rate.Mul(one.Sub(feeRate)),
+		}, true
+
+	case book.Minor.Code:
+		if !top.ask.Rate.IsPositive() {
+			return RouteLeg{}, false
+		}
+		return RouteLeg{
+			Book: book.BookCode,
+			Side: Side_BUY,
+			From: from,
+			To: book.Major.Code,
+			Rate: top.ask.Rate,
+			FeeRate: feeRate,
+			Factor: one.Sub(feeRate).Div(top.ask.Rate),
+		}, true
+	}
+
+	return RouteLeg{}, false
+}
+
+// NewRouter returns a router over the given books, books without fees are considered free of fees
+func NewRouter(books map[BookCode]Book, fees map[BookCode]Fee) *Router {
+	return &Router{
+		books: books,
+		fees: fees,
+		tops: make(map[BookCode]topOfBook),
+		maxHops: DEFAULT_MAX_HOPS,
+	}
+}
+
+// SetMaxHops sets the maximum number of legs of a route
+func (r *Router) SetMaxHops(hops int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.maxHops = hops
+}
+
+// Attach keeps the top of the books up to date from the Orders channel of a websocket, the caller still has to
+// subscribe to it for every book
+func (r *Router) Attach(ws *Websocket) {
+	ws.OnOrders(r.UpdateOrders)
+}
+
+// UpdateOrders takes the top of a book from an Orders snapshot
+func (r *Router) UpdateOrders(book BookCode, orders Orders) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tops[book] = newTopOfBook(orders)
+}
+
+// UpdateTop sets the best bid and ask of a book, a zero rate means that side of the book is empty
+func (r *Router) UpdateTop(book BookCode, bid, ask decimal.Decimal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tops[book] = topOfBook{bid: Offer{Rate: bid, Side: Side_BUY}, ask: Offer{Rate: ask, Side: Side_SELL}}
+}
+
+// legs returns every conversion available from a currency. Must be called with the lock held.
+func (r *Router) legs(from CurrencyCode) []RouteLeg {
+	legs := make([]RouteLeg, 0)
+
+	for code, book := range r.books {
+		if leg, ok := conversionLeg(book, r.fees[code].TakerFeeDecimal, r.tops[code], from); ok {
+			legs = append(legs, leg)
+		}
+	}
+
+	return legs
+}
+
+// Route returns the route converting from into to at the best rate, with at most the maximum hops and without
+// visiting a currency twice
+func (r *Router) Route(from, to CurrencyCode) (Route, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if from == to {
+		return Route{}, fmt.Errorf("cannot route %s to itself", from)
+	}
+
+	best := Route{}
+	found := false
+
+	visited := map[CurrencyCode]bool{from: true}
+	path := make([]RouteLeg, 0, r.maxHops)
+
+	var search func(current CurrencyCode, rate decimal.Decimal)
+	search = func(current CurrencyCode, rate decimal.Decimal) {
+		if len(path) == r.maxHops {
+			return
+		}
+
+		for _, leg := range r.legs(current) {
+			if visited[leg.To] {
+				continue
+			}
+
+			legRate := rate.Mul(leg.Factor)
+			path = append(path, leg)
+
+			if leg.To == to {
+				// prefer fewer legs on ties
+				if !found || legRate.GreaterThan(best.Rate) || (legRate.Equal(best.Rate) && len(path) < len(best.Legs)) {
+					found = true
+					best = Route{From: from, To: to, Legs: append([]RouteLeg(nil), path...), Rate: legRate}
+				}
+			} else {
+				visited[leg.To] = true
+				search(leg.To, legRate)
+				visited[leg.To] = false
+			}
+
+			path = path[:len(path) - 1]
+		}
+	}
+
+	search(from, decimal.NewFromInt(1))
+
+	if !found {
+		return Route{}, fmt.Errorf("no route from %s to %s", from, to)
+	}
+
+	return best, nil
+}
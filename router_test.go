@@ -0,0 +1,76 @@
+package bitso_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/angle/gobitso"
+)
+
+func TestRouterRoute(t *testing.T) {
+	currencies := bitso.CurrencyList()
+	books := map[bitso.BookCode]bitso.Book{
+		bitso.BookCode_BTC_MXN: btcMxn,
+		bitso.BookCode_ETH_MXN: {BookCode: bitso.BookCode_ETH_MXN, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_MXN]},
+		bitso.BookCode_ETH_BTC: {BookCode: bitso.BookCode_ETH_BTC, Major: currencies[bitso.CurrencyCode_ETH], Minor: currencies[bitso.CurrencyCode_BTC]},
+	}
+	fees := map[bitso.BookCode]bitso.Fee{
+		bitso.BookCode_BTC_MXN: {BookCode: bitso.BookCode_BTC_MXN, TakerFeeDecimal: d("0.01")},
+	}
+
+	tests := []struct {
+		name 	string
+		from 	bitso.CurrencyCode
+		to 		bitso.CurrencyCode
+		hops 	int
+		ethMxn 	[]string // bid and ask
+		legs 	[]string // book and side, empty when there is no route
+		rate 	string
+	}{
+		// 0.05 btc per eth at 900000 mxn less the 1% fee is 44550 mxn
+		{"through btc", bitso.CurrencyCode_ETH, bitso.CurrencyCode_MXN, 3, []string{"40000", "40100"}, []string{"eth_btc SELL", "btc_mxn SELL"}, "44550"},
+		{"direct within one hop", bitso.CurrencyCode_ETH, bitso.CurrencyCode_MXN, 1, []string{"40000", "40100"}, []string{"eth_mxn SELL"}, "40000"},
+		{"fewer legs on a tie", bitso.CurrencyCode_ETH, bitso.CurrencyCode_MXN, 3, []string{"44550", "44600"}, []string{"eth_mxn SELL"}, "44550"},
+		{"buying", bitso.CurrencyCode_MXN, bitso.CurrencyCode_ETH, 3, []string{"40000", "40000"}, []string{"eth_mxn BUY"}, "0.000025"},
+		{"through the other side", bitso.CurrencyCode_MXN, bitso.CurrencyCode_ETH, 3, []string{"0", "0"}, []string{"btc_mxn BUY", "eth_btc BUY"}, ""},
+		{"empty book", bitso.CurrencyCode_ETH, bitso.CurrencyCode_MXN, 1, []string{"0", "0"}, nil, ""},
+		{"to itself", bitso.CurrencyCode_MXN, bitso.CurrencyCode_MXN, 3, []string{"40000", "40100"}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		router := bitso.NewRouter(books, fees)
+		router.SetMaxHops(tt.hops)
+		router.UpdateTop(bitso.BookCode_BTC_MXN, d("900000"), d("900000"))
+		router.UpdateOrders(bitso.BookCode_ETH_BTC, bitso.Orders{
+			Bids: []bitso.Offer{{Rate: d("0.05"), Amount: d("1")}},
+			Asks: []bitso.Offer{{Rate: d("0.05"), Amount: d("1")}},
+		})
+		router.UpdateTop(bitso.BookCode_ETH_MXN, d(tt.ethMxn[0]), d(tt.ethMxn[1]))
+
+		route, err := router.Route(tt.from, tt.to)
+		if tt.legs == nil {
+			if err == nil {
+				t.Errorf("%s: received route %v, expecting an error", tt.name, route.Legs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		legs := make([]string, 0, len(route.Legs))
+		for _, leg := range route.Legs {
+			legs = append(legs, fmt.Sprintf("%s %s", leg.Book, leg.Side))
+		}
+		if fmt.Sprint(legs) != fmt.Sprint(tt.legs) {
+			t.Errorf("%s: routed through %v, expecting %v", tt.name, legs, tt.legs)
+		}
+		if tt.rate != "" && !route.Rate.Equal(d(tt.rate)) {
+			t.Errorf("%s: rate %s, expecting %s", tt.name, route.Rate, tt.rate)
+		}
+		if expected := route.Expected(d("2")); !expected.Equal(route.Rate.Mul(d("2"))) {
+			t.Errorf("%s: 2 converts to %s, expecting %s", tt.name, expected, route.Rate.Mul(d("2")))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package bitso
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+var bpsPerUnit = decimal.NewFromInt(10000)
+
+// SlippageEstimate is how a market order would walk the book. Slippage is measured from the best price of the
+// side taken (the best ask when buying, the best bid when selling) to the average fill price.
+type SlippageEstimate struct {
+	Side 			Side
+	Amount 			decimal.Decimal // units: major
+	Value 			decimal.Decimal // units: minor
+	BestPrice 		decimal.Decimal
+	AveragePrice 	decimal.Decimal
+	WorstPrice 		decimal.Decimal
+	SlippageBps 	decimal.Decimal
+	Filled 			bool // EstimateMarketOrder: false when the book is not deep enough for the whole order
+	BudgetReached 	bool // MaxSizeWithinSlippage: false when the whole book fits in the budget
+}
+
+// levels returns the offers a market order of the side takes from, best first
+func (o Orders) levels(side Side) []Offer {
+	if side == Side_BUY {
+		return o.Asks
+	}
+	return o.Bids
+}
+
+func (e *SlippageEstimate) add(amount, price decimal.Decimal) {
+	e.Amount = e.Amount.Add(amount)
+	e.Value = e.Value.Add(amount.Mul(price))
+	e.WorstPrice = price
+}
+
+func (e *SlippageEstimate) finish() {
+	if !e.Amount.IsPositive() || !e.BestPrice.IsPositive() {
+		return
+	}
+
+	e.AveragePrice = e.Value.Div(e.Amount)
+
+	diff := e.AveragePrice.Sub(e.BestPrice)
+	if e.Side == Side_SELL {
+		diff = diff.Neg()
+	}
+	e.SlippageBps = diff.Div(e.BestPrice).Mul(bpsPerUnit).Round(2)
+}
+
+// EstimateMarketOrder walks the book for a market order of the given major amount or, when major is zero, of the
+// given minor amount (spent when buying, received when selling). Amounts are truncated to the precision of the
+// major currency of book.
+func (o Orders) EstimateMarketOrder(book Book, side Side, major, minor decimal.Decimal) SlippageEstimate {
+	e := SlippageEstimate{Side: side}
+	precision := int32(book.Major.Precision)
+
+	levels := o.levels(side)
+	if len(levels) > 0 {
+		e.BestPrice = levels[0].Rate
+	}
+
+	byMinor := !major.IsPositive()
+
+	for _, level := range levels {
+		if !level.Rate.IsPositive() {
+			continue
+		}
+
+		var amount decimal.Decimal
+		if byMinor {
+			remaining := minor.Sub(e.Value)
+			if !remaining.IsPositive() {
+				break
+			}
+			amount = decimal.Min(level.Amount, remaining.Div(level.Rate).Truncate(precision))
+		} else {
+			remaining := major.Sub(e.Amount)
+			if !remaining.IsPositive() {
+				break
+			}
+			amount = decimal.Min(level.Amount, remaining)
+		}
+
+		if !amount.IsPositive() {
+			break
+		}
+		e.add(amount, level.Rate)
+	}
+
+	if byMinor {
+		// the last unit of major precision may leave a fraction of the minor amount unfilled
+		lastRate := e.WorstPrice
+		e.Filled = lastRate.IsPositive() && minor.Sub(e.Value).LessThan(lastRate.Shift(-precision))
+	} else {
+		e.Filled = e.Amount.Equal(major)
+	}
+
+	e.finish()
+
+	return e
+}
+
+// MaxSizeWithinSlippage returns the largest market order whose average price stays within the slippage budget, in
+// basis points from the best price, truncated to the precision of the major currency of book. BudgetReached is false
+// when the whole book fits in the budget, a larger order may still be possible beyond the received depth.
+func (o Orders) MaxSizeWithinSlippage(book Book, side Side, bps decimal.Decimal) (SlippageEstimate, error) {
+	e := SlippageEstimate{Side: side}
+
+	if bps.IsNegative() {
+		return e, fmt.Errorf("slippage budget of %s bps is negative", bps)
+	}
+
+	levels := o.levels(side)
+	if len(levels) == 0 {
+		return e, nil
+	}
+	e.BestPrice = levels[0].Rate
+
+	// the average price limit
+	limit := e.BestPrice.Mul(bpsPerUnit.Add(bps)).Div(bpsPerUnit)
+	if side == Side_SELL {
+		limit = e.BestPrice.Mul(bpsPerUnit.Sub(bps)).Div(bpsPerUnit)
+	}
+
+	for _, level := range levels {
+		within := level.Rate.LessThanOrEqual(limit)
+		if side == Side_SELL {
+			within = level.Rate.GreaterThanOrEqual(limit)
+		}
+
+		if within {
+			e.add(level.Amount, level.Rate)
+			continue
+		}
+
+		// take the part of the level that brings the average price exactly to the limit:
+		// (value + x * rate) / (amount + x) = limit
+		x := limit.Mul(e.Amount).Sub(e.Value).Div(level.Rate.Sub(limit)).Truncate(int32(book.Major.Precision))
+		x = decimal.Min(x, level.Amount)
+		if x.IsPositive() {
+			e.add(x, level.Rate)
+		}
+
+		// the rest of the book is beyond the budget
+		e.BudgetReached = true
+		break
+	}
+
+	e.finish()
+
+	return e, nil
+}
+
+// EstimateMarketOrder walks the current local book, see Orders.EstimateMarketOrder
+func (ob *OrderBook) EstimateMarketOrder(book Book, side Side, major, minor decimal.Decimal) SlippageEstimate {
+	return ob.Snapshot(0).EstimateMarketOrder(book, side, major, minor)
+}
+
+// MaxSizeWithinSlippage walks the current local book, see Orders.MaxSizeWithinSlippage
+func (ob *OrderBook) MaxSizeWithinSlippage(book Book, side Side, bps decimal.Decimal) (SlippageEstimate, error) {
+	return ob.Snapshot(0).MaxSizeWithinSlippage(book, side, bps)
+}
@@ -0,0 +1,101 @@
+package bitso_test
+
+import (
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/shopspring/decimal"
+)
+
+// coarseBook trades btc in hundredths
+var coarseBook = bitso.Book{
+	BookCode: bitso.BookCode_BTC_MXN,
+	Major: bitso.Currency{Code: bitso.CurrencyCode_BTC, Precision: 2},
+	Minor: bitso.CurrencyList()[bitso.CurrencyCode_MXN],
+}
+
+func TestEstimateMarketOrder(t *testing.T) {
+	orders := bitso.Orders{
+		Bids: []bitso.Offer{{Rate: d("899000"), Amount: d("1")}, {Rate: d("890000"), Amount: d("1")}},
+		Asks: []bitso.Offer{{Rate: d("900000"), Amount: d("0.5")}, {Rate: d("910000"), Amount: d("1")}},
+	}
+
+	tests := []struct {
+		name 		string
+		book 		bitso.Book
+		side 		bitso.Side
+		major 		string
+		minor 		string
+		expected 	[]string // amount, value, average price, worst price and slippage
+		filled 		bool
+	}{
+		{"top of the book", btcMxn, bitso.Side_BUY, "0.5", "0", []string{"0.5", "450000", "900000", "900000", "0"}, true},
+		{"two levels", btcMxn, bitso.Side_BUY, "1", "0", []string{"1", "905000", "905000", "910000", "55.56"}, true},
+		{"deeper than the book", btcMxn, bitso.Side_BUY, "2", "0", []string{"1.5", "1360000", "906666.6666666666666667", "910000", "74.07"}, false},
+		{"selling", btcMxn, bitso.Side_SELL, "1.5", "0", []string{"1.5", "1344000", "896000", "890000", "33.37"}, true},
+		{"spending minor", btcMxn, bitso.Side_BUY, "0", "541000", []string{"0.6", "541000", "901666.6666666666666667", "910000", "18.52"}, true},
+		{"spending beyond the book", btcMxn, bitso.Side_BUY, "0", "2000000", []string{"1.5", "1360000", "906666.6666666666666667", "910000", "74.07"}, false},
+		// 0.11111111 at the precision of btc, the 1000 mxn left cannot buy another hundredth
+		{"precision of the book", coarseBook, bitso.Side_BUY, "0", "100000", []string{"0.11", "99000", "900000", "900000", "0"}, true},
+	}
+
+	for _, tt := range tests {
+		e := orders.EstimateMarketOrder(tt.book, tt.side, d(tt.major), d(tt.minor))
+
+		figures := []decimal.Decimal{e.Amount, e.Value, e.AveragePrice, e.WorstPrice, e.SlippageBps}
+		for i := range figures {
+			if !figures[i].Equal(d(tt.expected[i])) {
+				t.Errorf("%s: amount, value, average, worst and slippage are %v, expecting %v", tt.name, figures, tt.expected)
+				break
+			}
+		}
+		if e.Filled != tt.filled {
+			t.Errorf("%s: filled is %t, expecting %t", tt.name, e.Filled, tt.filled)
+		}
+	}
+}
+
+func TestMaxSizeWithinSlippage(t *testing.T) {
+	orders := bitso.Orders{
+		Asks: []bitso.Offer{{Rate: d("900000"), Amount: d("0.5")}, {Rate: d("910000"), Amount: d("1")}},
+	}
+
+	tests := []struct {
+		name 		string
+		book 		bitso.Book
+		orders 		bitso.Orders
+		bps 		string
+		amount 		string
+		reached 	bool
+		err 		bool
+	}{
+		{"no slippage", btcMxn, orders, "0", "0.5", true, false},
+		// (450000 + x * 910000) / (0.5 + x) = 904500
+		{"part of a level", btcMxn, orders, "50", "0.9090909", true, false},
+		{"precision of the book", coarseBook, orders, "50", "0.9", true, false},
+		{"whole book within the budget", btcMxn, orders, "1000", "1.5", false, false},
+		{"empty book", btcMxn, bitso.Orders{}, "50", "0", false, false},
+		{"negative budget", btcMxn, orders, "-1", "0", false, true},
+	}
+
+	for _, tt := range tests {
+		e, err := tt.orders.MaxSizeWithinSlippage(tt.book, bitso.Side_BUY, d(tt.bps))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expecting an error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if !e.Amount.Equal(d(tt.amount)) || e.BudgetReached != tt.reached {
+			t.Errorf("%s: %s with the budget reached %t, expecting %s and %t", tt.name, e.Amount, e.BudgetReached, tt.amount, tt.reached)
+		}
+		if e.SlippageBps.GreaterThan(d(tt.bps)) {
+			t.Errorf("%s: %s bps of slippage, above the budget", tt.name, e.SlippageBps)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package bitso
+
+import (
+	"sync"
+	"time"
+)
+
+// DEFAULT_REQUEST_INTERVAL keeps a ThrottledTrader within the 300 private requests per minute allowed by Bitso
+const DEFAULT_REQUEST_INTERVAL = 200 * time.Millisecond
+
+// Trader is the set of trading operations shared by the real Client and by simulated traders (see the paper
+// package), so a strategy can run unchanged against either one
+type Trader interface {
+	PlaceOrder(order OrderRequest) (string, error)
+	CancelOrder(oid string) error
+	OpenOrders(book BookCode) ([]Order, error)
+	LookupOrders(oids ...string) ([]Order, error)
+	LookupOrdersByOrigin(originIds ...string) ([]Order, error)
+	AccountBalance() (map[CurrencyCode]Balance, error)
+	UserTrades(book BookCode, marker int64, limit int) ([]UserTrade, error)
+}
+
+var _ Trader = (*Client)(nil)
+
+// ThrottledTrader spaces the requests to a Trader at least an interval apart, blocking the callers as needed
+type ThrottledTrader struct {
+	trader 		Trader
+	interval 	time.Duration
+
+	mu 			sync.Mutex
+	next 		time.Time
+}
+
+func NewThrottledTrader(trader Trader, interval time.Duration) *ThrottledTrader {
+	return &ThrottledTrader{trader: trader, interval: interval}
+}
+
+func (t *ThrottledTrader) SetInterval(interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.interval = interval
+}
+
+func (t *ThrottledTrader) wait() {
+	t.mu.Lock()
+	now := time.Now()
+	at := t.next
+	if at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mu.Unlock()
+
+	time.Sleep(at.Sub(now))
+}
+
+func (t *ThrottledTrader) PlaceOrder(order OrderRequest) (string, error) {
+	t.wait()
+	return t.trader.PlaceOrder(order)
+}
+
+func (t *ThrottledTrader) CancelOrder(oid string) error {
+	t.wait()
+	return t.trader.CancelOrder(oid)
+}
+
+func (t *ThrottledTrader) OpenOrders(book BookCode) ([]Order, error) {
+	t.wait()
+	return t.trader.OpenOrders(book)
+}
+
+func (t *ThrottledTrader) LookupOrders(oids ...string) ([]Order, error) {
+	t.wait()
+	return t.trader.LookupOrders(oids...)
+}
+
+func (t *ThrottledTrader) LookupOrdersByOrigin(originIds ...string) ([]Order, error) {
+	t.wait()
+	return t.trader.LookupOrdersByOrigin(originIds...)
+}
+
+func (t *ThrottledTrader) AccountBalance() (map[CurrencyCode]Balance, error) {
+	t.wait()
+	return t.trader.AccountBalance()
+}
+
+func (t *ThrottledTrader) UserTrades(book BookCode, marker int64, limit int) ([]UserTrade, error) {
+	t.wait()
+	return t.trader.UserTrades(book, marker, limit)
+}
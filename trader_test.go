@@ -0,0 +1,33 @@
+package bitso
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestExecutionSharesThrottle(t *testing.T) {
+	book := testBook()
+	throttle := NewThrottledTrader(nil, DEFAULT_REQUEST_INTERVAL)
+
+	twap, err := NewTWAP(throttle, book, Side_BUY, decimal.NewFromInt(1), decimal.Zero, DEFAULT_REQUEST_INTERVAL, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iceberg, err := NewIceberg(throttle, book, Side_SELL, decimal.NewFromInt(1), decimal.Zero, decimal.NewFromInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range []*Execution{twap, iceberg} {
+		if e.throttle != throttle || e.manager.trader != Trader(throttle) {
+			t.Errorf("%s wraps the shared throttle again", e.style)
+		}
+	}
+
+	// any other trader is throttled
+	own, _ := NewTWAP(throttle.trader, book, Side_BUY, decimal.NewFromInt(1), decimal.Zero, DEFAULT_REQUEST_INTERVAL, 1)
+	if own.throttle == throttle || own.throttle == nil {
+		t.Error("twap without a throttle does not get its own")
+	}
+}
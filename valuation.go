@@ -0,0 +1,269 @@
+package bitso
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type ValuationMode string
+
+const (
+	// ValuationMode_MID values holdings at the mid price of the books, without fees
+	ValuationMode_MID 			ValuationMode = "mid"
+	// ValuationMode_LIQUIDATION values holdings at what selling them with market orders would return, after the
+	// taker fees. The depth of the books is walked when an Orders snapshot is known, see Valuer.UpdateOrders, and
+	// only the top of the books is used otherwise.
+	ValuationMode_LIQUIDATION 	ValuationMode = "liquidation"
+)
+
+// HoldingValue is the value of the balance of one currency
+type HoldingValue struct {
+	Currency 		CurrencyCode
+	Available 		decimal.Decimal // units: Currency
+	Locked 			decimal.Decimal
+	Total 			decimal.Decimal
+	Rate 			decimal.Decimal // units of the reference currency per unit of Currency, on average when liquidating
+	AvailableValue 	decimal.Decimal // units: reference currency
+	LockedValue 	decimal.Decimal
+	Value 			decimal.Decimal
+	Route 			[]RouteLeg // conversions used to price Currency, empty for the reference currency
+	Priced 			bool // false when no route to the reference currency exists, the values are then zero
+}
+
+// Valuation is the value of every balance of an account in a reference currency
+type Valuation struct {
+	Currency 	CurrencyCode // the reference currency
+	Mode 		ValuationMode
+	Holdings 	[]HoldingValue // the largest value first
+	Available 	decimal.Decimal // units: Currency
+	Locked 		decimal.Decimal
+	Total 		decimal.Decimal
+	Unpriced 	[]CurrencyCode // currencies held but left out of the totals
+	At 			time.Time
+}
+
+// Valuer values account balances in any currency from the books, converting through other currencies (see Router)
+// when no direct book exists
+type Valuer struct {
+	books 		map[BookCode]Book
+	mid 		*Router
+	liquidation *Router
+
+	mu 			sync.RWMutex
+	depth 		map[BookCode]Orders // latest Orders snapshots, walked by liquidation values
+}
+
+func NewValuer(books map[BookCode]Book, fees map[BookCode]Fee) *Valuer {
+	return &Valuer{
+		books: books,
+		mid: NewRouter(books, nil),
+		liquidation: NewRouter(books, fees),
+		depth: make(map[BookCode]Orders),
+	}
+}
+
+// SetMaxHops sets the maximum number of conversions used to price a currency, DEFAULT_MAX_HOPS by default
+func (v *Valuer) SetMaxHops(hops int) {
+	v.mid.SetMaxHops(hops)
+	v.liquidation.SetMaxHops(hops)
+}
+
+// Attach keeps the books up to date from the Orders channel of a websocket, the caller still has to subscribe to it
+// for every book
+func (v *Valuer) Attach(ws *Websocket) {
+	ws.OnOrders(v.UpdateOrders)
+}
+
+// UpdateOrders takes the top and the depth of a book from an Orders snapshot
+func (v *Valuer) UpdateOrders(book BookCode, orders Orders) {
+	v.mu.Lock()
+	v.depth[book] = orders
+	v.mu.Unlock()
+
+	top := newTopOfBook(orders)
+	v.updateTop(book, top.bid.Rate, top.ask.Rate)
+}
+
+// UpdateTickers takes the top of the books from tickers, ex. from Client.Tickers
+func (v *Valuer) UpdateTickers(tickers []Ticker) {
+	for _, t := range tickers {
+		v.UpdateTop(t.Book, t.Bid, t.Ask)
+	}
+}
+
+// LoadTickers fetches the tickers of every book
+func (v *Valuer) LoadTickers(client *Client) error {
+	tickers, err := client.Tickers()
+	if err != nil {
+		return err
+	}
+
+	v.UpdateTickers(tickers)
+	return nil
+}
+
+// UpdateTop sets the best bid and ask of a book, a zero rate means that side of the book is empty. Books with an
+// empty side have no mid price. The depth of the book from an earlier snapshot is forgotten.
+func (v *Valuer) UpdateTop(book BookCode, bid, ask decimal.Decimal) {
+	v.mu.Lock()
+	delete(v.depth, book)
+	v.mu.Unlock()
+
+	v.updateTop(book, bid, ask)
+}
+
+func (v *Valuer) updateTop(book BookCode, bid, ask decimal.Decimal) {
+	v.liquidation.UpdateTop(book, bid, ask)
+
+	mid := decimal.Zero
+	if bid.IsPositive() && ask.IsPositive() {
+		mid = bid.Add(ask).Div(decimal.NewFromInt(2))
+	}
+	v.mid.UpdateTop(book, mid, mid)
+}
+
+// ValueAccount values the balances of the account of a Trader
+func (v *Valuer) ValueAccount(trader Trader, currency CurrencyCode, mode ValuationMode) (Valuation, error) {
+	balances, err := trader.AccountBalance()
+	if err != nil {
+		return Valuation{}, err
+	}
+
+	return v.Value(balances, currency, mode)
+}
+
+// Value values balances in a reference currency. Holdings without a route to it are listed as Unpriced.
+func (v *Valuer) Value(balances map[CurrencyCode]Balance, currency CurrencyCode, mode ValuationMode) (Valuation, error) {
+	router := v.mid
+	switch mode {
+	case ValuationMode_MID:
+	case ValuationMode_LIQUIDATION:
+		router = v.liquidation
+	default:
+		return Valuation{}, fmt.Errorf("unknown valuation mode %q", mode)
+	}
+
+	precision := int32(v.precision(currency))
+
+	valuation := Valuation{
+		Currency: currency,
+		Mode: mode,
+		Holdings: make([]HoldingValue, 0, len(balances)),
+		Unpriced: make([]CurrencyCode, 0),
+		At: time.Now(),
+	}
+
+	for code, balance := range balances {
+		if balance.Total.IsZero() && balance.Available.IsZero() && balance.Locked.IsZero() {
+			continue
+		}
+
+		h := HoldingValue{
+			Currency: code,
+			Available: balance.Available,
+			Locked: balance.Locked,
+			Total: balance.Total,
+			Route: []RouteLeg{},
+		}
+		liquidated := decimal.Zero
+
+		if code == currency {
+			h.Rate = decimal.NewFromInt(1)
+			h.Priced = true
+		} else if route, err := router.Route(code, currency); err == nil {
+			h.Rate = route.Rate
+			h.Route = route.Legs
+			h.Priced = true
+
+			if mode == ValuationMode_LIQUIDATION && h.Total.IsPositive() {
+				liquidated = v.liquidate(route.Legs, h.Total)
+				h.Rate = liquidated.Div(h.Total)
+			}
+		}
+
+		if !h.Priced {
+			valuation.Unpriced = append(valuation.Unpriced, code)
+			valuation.Holdings = append(valuation.Holdings, h)
+			continue
+		}
+
+		h.AvailableValue = h.Available.Mul(h.Rate).Truncate(precision)
+		h.LockedValue = h.Locked.Mul(h.Rate).Truncate(precision)
+		h.Value = h.Total.Mul(h.Rate).Truncate(precision)
+		if liquidated.IsPositive() {
+			// not rounded through the average rate
+			h.Value = liquidated.Truncate(precision)
+		}
+
+		valuation.Available = valuation.Available.Add(h.AvailableValue)
+		valuation.Locked = valuation.Locked.Add(h.LockedValue)
+		valuation.Total = valuation.Total.Add(h.Value)
+		valuation.Holdings = append(valuation.Holdings, h)
+	}
+
+	sort.Slice(valuation.Holdings, func(i, j int) bool {
+		a, b := valuation.Holdings[i], valuation.Holdings[j]
+		if !a.Value.Equal(b.Value) {
+			return a.Value.GreaterThan(b.Value)
+		}
+		return a.Currency < b.Currency
+	})
+	sort.Slice(valuation.Unpriced, func(i, j int) bool { return valuation.Unpriced[i] < valuation.Unpriced[j] })
+
+	return valuation, nil
+}
+
+// liquidate returns what converting amount through the legs with market orders would return, walking the books with
+// a snapshot and at the rate of the leg otherwise. The part of the amount beyond the depth received is converted at
+// the worst price reached.
+func (v *Valuer) liquidate(legs []RouteLeg, amount decimal.Decimal) decimal.Decimal {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	one := decimal.NewFromInt(1)
+
+	for _, leg := range legs {
+		orders, ok := v.depth[leg.Book]
+		if !ok {
+			amount = amount.Mul(leg.Factor)
+			continue
+		}
+
+		var received decimal.Decimal
+		if leg.Side == Side_SELL {
+			e := orders.EstimateMarketOrder(v.books[leg.Book], Side_SELL, amount, decimal.Zero)
+			received = e.Value.Add(amount.Sub(e.Amount).Mul(worstPrice(e, leg)))
+		} else {
+			e := orders.EstimateMarketOrder(v.books[leg.Book], Side_BUY, decimal.Zero, amount)
+			received = e.Amount.Add(amount.Sub(e.Value).Div(worstPrice(e, leg)))
+		}
+		amount = received.Mul(one.Sub(leg.FeeRate))
+	}
+
+	return amount
+}
+
+// worstPrice returns the last price an estimate reached, the rate of the leg if it reached none
+func worstPrice(e SlippageEstimate, leg RouteLeg) decimal.Decimal {
+	if e.WorstPrice.IsPositive() {
+		return e.WorstPrice
+	}
+	return leg.Rate
+}
+
+// precision returns the precision of a currency from the books, DEFAULT_MINOR_PRECISION if no book trades it
+func (v *Valuer) precision(currency CurrencyCode) int {
+	for _, book := range v.books {
+		if book.Major.Code == currency {
+			return book.Major.Precision
+		}
+		if book.Minor.Code == currency {
+			return book.Minor.Precision
+		}
+	}
+	return DEFAULT_MINOR_PRECISION
+}
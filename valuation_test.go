@@ -0,0 +1,67 @@
+package bitso_test
+
+import (
+	"testing"
+
+	"github.com/angle/gobitso"
+)
+
+func TestValuerLiquidation(t *testing.T) {
+	books := map[bitso.BookCode]bitso.Book{btcMxn.BookCode: btcMxn}
+	fees := map[bitso.BookCode]bitso.Fee{btcMxn.BookCode: {BookCode: btcMxn.BookCode, TakerFeeDecimal: d("0.0065")}}
+	balances := map[bitso.CurrencyCode]bitso.Balance{
+		bitso.CurrencyCode_BTC: {Currency: bitso.CurrencyCode_BTC, Available: d("0.75"), Locked: d("0.25"), Total: d("1")},
+	}
+
+	bids := []bitso.Offer{{Rate: d("900000"), Amount: d("0.5")}, {Rate: d("890000"), Amount: d("1")}}
+	asks := []bitso.Offer{{Rate: d("901000"), Amount: d("1")}}
+
+	tests := []struct {
+		name 		string
+		mode 		bitso.ValuationMode
+		update 		func(v *bitso.Valuer)
+		expected 	string
+	}{
+		{"mid", bitso.ValuationMode_MID, func(v *bitso.Valuer) {
+			v.UpdateOrders(btcMxn.BookCode, bitso.Orders{Bids: bids, Asks: asks})
+		}, "900500"},
+		{"top of the book", bitso.ValuationMode_LIQUIDATION, func(v *bitso.Valuer) {
+			v.UpdateTickers([]bitso.Ticker{{Book: btcMxn.BookCode, Bid: d("900000"), Ask: d("901000")}})
+		}, "894150"},
+		{"depth of the book", bitso.ValuationMode_LIQUIDATION, func(v *bitso.Valuer) {
+			// 0.5 at 900000 and 0.5 at 890000, less the fee
+			v.UpdateOrders(btcMxn.BookCode, bitso.Orders{Bids: bids, Asks: asks})
+		}, "889182.5"},
+		{"beyond the depth received", bitso.ValuationMode_LIQUIDATION, func(v *bitso.Valuer) {
+			// the last 0.25 is sold at the worst price received
+			v.UpdateOrders(btcMxn.BookCode, bitso.Orders{Bids: []bitso.Offer{bids[0], {Rate: d("890000"), Amount: d("0.25")}}, Asks: asks})
+		}, "889182.5"},
+		{"top after a snapshot", bitso.ValuationMode_LIQUIDATION, func(v *bitso.Valuer) {
+			v.UpdateOrders(btcMxn.BookCode, bitso.Orders{Bids: bids, Asks: asks})
+			v.UpdateTop(btcMxn.BookCode, d("900000"), d("901000"))
+		}, "894150"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := bitso.NewValuer(books, fees)
+			tt.update(v)
+
+			valuation, err := v.Value(balances, bitso.CurrencyCode_MXN, tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(valuation.Unpriced) != 0 {
+				t.Fatalf("unpriced %v, expecting none", valuation.Unpriced)
+			}
+			if !valuation.Total.Equal(d(tt.expected)) {
+				t.Errorf("total %s, expecting %s", valuation.Total, tt.expected)
+			}
+
+			h := valuation.Holdings[0]
+			if sum := h.AvailableValue.Add(h.LockedValue); sum.Sub(h.Value).Abs().GreaterThan(d("0.01")) {
+				t.Errorf("available and locked add up to %s, expecting %s", sum, h.Value)
+			}
+		})
+	}
+}
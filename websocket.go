@@ -1,10 +1,13 @@
 package bitso
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/websocket"
-	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 )
@@ -14,53 +17,312 @@ const LOG_PREFIX = "BitsoWebsocket: "
 
 const MAX_FEED_QUEUE_SIZE = 1000
 
+const PING_INTERVAL = 10 * time.Second
+const STALE_TIMEOUT = 30 * time.Second
+const WRITE_TIMEOUT = 5 * time.Second
+const MAX_RECONNECT_BACKOFF = 30 * time.Second
+
 type Websocket struct {
+	endpoint 	string
+	dialer 		*websocket.Dialer
+	headers 	http.Header
+	err 		error // invalid options, returned by Connect
+
+	// dialer settings, applied to a copy of the dialer once every option is set
+	tlsConfig 			*tls.Config
+	proxy 				func(*http.Request) (*url.URL, error)
+	handshakeTimeout 	time.Duration
+	compression 		*bool
+
+	logger 		Logger
+	metrics 	Metrics
+	recorder 	*Recorder
+
 	conn 		*websocket.Conn
+	connMu 		sync.RWMutex // guards conn, which is replaced on every reconnection
+	writeMu 	sync.Mutex // the websocket connection supports only one concurrent writer
+
+	subscriptions 	map[subscription]bool
+	subscriptionsMu sync.Mutex
 
-	feed 		chan FeedMessage
+	pingInterval 	time.Duration
+	staleTimeout 	time.Duration
+	reconnect 		bool
+
+	health 		HealthStatus
+	healthMu 	sync.RWMutex
+
+	feed 		<-chan FeedMessage
+	queue 		*feedQueue
+
+	queueSize 		int
+	overflowPolicy 	OverflowPolicy
 
 	quit 		chan bool
 	quitOnce 	*sync.Once
+
+	handlers 	*feedHandlers
+}
+
+// WebsocketOption configures optional settings of the WebsocketListener
+type WebsocketOption func(ws *Websocket)
+
+// WithFeedQueueSize sets how many messages can be waiting for the consumer, defaults to MAX_FEED_QUEUE_SIZE
+func WithFeedQueueSize(size int) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.queueSize = size
+	}
+}
+
+// WithOverflowPolicy sets what to do when the feed queue is full, defaults to OverflowPolicy_DISCONNECT
+func WithOverflowPolicy(policy OverflowPolicy) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.overflowPolicy = policy
+	}
+}
+
+// WithPingInterval sets how often a ping control frame is sent to the server, defaults to PING_INTERVAL
+func WithPingInterval(interval time.Duration) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.pingInterval = interval
+	}
+}
+
+// WithStaleTimeout sets how long the connection may go without receiving any message (including the server's
+// "ka" heartbeats) before it is considered stale, defaults to STALE_TIMEOUT
+func WithStaleTimeout(timeout time.Duration) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.staleTimeout = timeout
+	}
+}
+
+// WithReconnect makes the websocket redial and resubscribe when the connection fails or goes stale, instead of
+// disconnecting. A Channel_RECONNECTED message is sent to the feed after every successful reconnection.
+func WithReconnect(enabled bool) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.reconnect = enabled
+	}
+}
+
+// WithEndpoint sets the websocket URL to connect to, defaults to WEBSOCKET_ENDPOINT
+func WithEndpoint(endpoint string) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.endpoint = endpoint
+	}
+}
+
+// WithDialer replaces the dialer used to connect, it is copied and never modified. The TLS, proxy, handshake
+// timeout and compression options override its settings whatever their order. Connect fails with a nil dialer.
+func WithDialer(dialer *websocket.Dialer) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.dialer = dialer
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for wss:// endpoints
+func WithTLSConfig(config *tls.Config) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.tlsConfig = config
+	}
+}
+
+// WithProxy sets the function that picks the proxy for the connection, defaults to http.ProxyFromEnvironment.
+// Use http.ProxyURL to always go through the same proxy.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.proxy = proxy
+	}
+}
+
+// WithHandshakeTimeout sets the maximum duration of the opening handshake
+func WithHandshakeTimeout(timeout time.Duration) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.handshakeTimeout = timeout
+	}
+}
+
+// WithCompression asks the server to negotiate per message compression
+func WithCompression(enabled bool) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.compression = &enabled
+	}
+}
+
+// WithHeaders sets additional headers sent with the opening handshake (ex. Origin or an egress proxy token)
+func WithHeaders(headers http.Header) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.headers = headers
+	}
+}
+
+// WithLogger sets the Logger for the connection events, nothing is logged by default. Use NewStdLogger with
+// LOG_PREFIX to log through the standard log package.
+func WithLogger(logger Logger) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.logger = logger
+	}
+}
+
+// WithMetrics sets the instrumentation hooks for message rates, dropped messages, queue depth and reconnections
+func WithMetrics(metrics Metrics) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.metrics = metrics
+	}
+}
+
+// WithRecorder tees every raw frame received from the server to the Recorder, see Replay
+func WithRecorder(recorder *Recorder) WebsocketOption {
+	return func(ws *Websocket) {
+		ws.recorder = recorder
+	}
 }
 
 // NewWebsocketListener returns a pointer to a new instance of the WebsocketListener
-func NewWebsocketListener() *Websocket {
-	return &Websocket{
-		feed: make(chan FeedMessage, MAX_FEED_QUEUE_SIZE),
+func NewWebsocketListener(options ...WebsocketOption) *Websocket {
+	ws := &Websocket{
+		endpoint: WEBSOCKET_ENDPOINT,
+		dialer: websocket.DefaultDialer,
+		logger: NopLogger(),
+		metrics: NopMetrics(),
+		queueSize: MAX_FEED_QUEUE_SIZE,
+		overflowPolicy: OverflowPolicy_DISCONNECT,
+		subscriptions: make(map[subscription]bool),
+		pingInterval: PING_INTERVAL,
+		staleTimeout: STALE_TIMEOUT,
 		quit: make(chan bool),
 		quitOnce: new(sync.Once),
+		handlers: new(feedHandlers),
 	}
+
+	for _, option := range options {
+		option(ws)
+	}
+
+	if ws.dialer == nil {
+		ws.err = NewWebSocketError("websocket dialer is nil")
+	} else {
+		ws.dialer = ws.dialOptions()
+	}
+
+	ws.queue = newFeedQueue(ws.queueSize, ws.overflowPolicy)
+	ws.queue.setMetrics(ws.metrics)
+	ws.feed = ws.queue.out
+
+	return ws
+}
+
+// dialOptions returns a copy of the dialer with the TLS, proxy, handshake timeout and compression options set, so
+// neither the caller's dialer nor the package level default one are modified
+func (ws *Websocket) dialOptions() *websocket.Dialer {
+	dialer := *ws.dialer
+
+	if ws.tlsConfig != nil {
+		dialer.TLSClientConfig = ws.tlsConfig
+	}
+	if ws.proxy != nil {
+		dialer.Proxy = ws.proxy
+	}
+	if ws.handshakeTimeout > 0 {
+		dialer.HandshakeTimeout = ws.handshakeTimeout
+	}
+	if ws.compression != nil {
+		dialer.EnableCompression = *ws.compression
+	}
+
+	return &dialer
 }
 
 // Connect establishes the initial connection to the websocket, must be called before subscribing to a channel
 func (ws *Websocket) Connect() (<-chan FeedMessage, error) {
-	log.Printf(LOG_PREFIX + "connecting to %s", WEBSOCKET_ENDPOINT)
+	if ws.err != nil {
+		return nil, ws.err
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(WEBSOCKET_ENDPOINT, nil)
+	ws.logger.Log(LogLevel_INFO, "connecting", Field("endpoint", ws.endpoint))
+
+	conn, err := ws.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	ws.logger.Log(LogLevel_INFO, "connected!", Field("endpoint", ws.endpoint))
+
+	// the queue only needs its pump once there is something to deliver
+	ws.queue.start()
+	ws.start(conn)
+
+	// Pass down the FeedMessage channel to the consumer
+	return ws.feed, nil
+}
+
+func (ws *Websocket) dial() (*websocket.Conn, error) {
+	conn, _, err := ws.dialer.Dial(ws.endpoint, ws.headers)
 	if err != nil {
 		return nil, NewWebSocketError(fmt.Sprintf("error on dial: %v", err))
 	}
 
+	return conn, nil
+}
+
+// start sets the connection as the current one and launches its reader and writer processes
+func (ws *Websocket) start(conn *websocket.Conn) {
+	ws.connMu.Lock()
 	ws.conn = conn
+	ws.connMu.Unlock()
+
+	ws.launch(conn)
+}
 
-	log.Printf(LOG_PREFIX + "connected!")
+// launch starts the reader and writer processes of a connection that is already the current one
+func (ws *Websocket) launch(conn *websocket.Conn) {
+	ws.setConnected()
+
+	// closed by the reader when the connection fails, it stops the writer
+	done := make(chan bool)
 
 	// Launch the reader process
-	go ws.reader()
+	go ws.reader(conn, done)
 
 	// Launch the writer process
-	go ws.writer()
+	go ws.writer(conn, done)
+}
 
-	// Pass down the FeedMessage channel to the consumer
-	return ws.feed, nil
+func (ws *Websocket) currentConn() *websocket.Conn {
+	ws.connMu.RLock()
+	defer ws.connMu.RUnlock()
+
+	return ws.conn
+}
+
+// write sends a message through the current connection, serializing it with the writer process
+func (ws *Websocket) write(messageType int, data []byte) error {
+	conn := ws.currentConn()
+	if conn == nil {
+		return NewWebSocketError("websocket connection has not been initialized yet")
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	return conn.WriteMessage(messageType, data)
 }
 
 // Subscribe subscribes to the specified channel for an specific book
 func (ws *Websocket) Subscribe(book BookCode, channel Channel) error {
-	if ws.conn == nil {
-		return NewWebSocketError("websocket connection has not been initialized yet")
+	if err := ws.sendSubscribe(book, channel); err != nil {
+		return err
 	}
 
+	// remember the subscription, it will be restored after a reconnection
+	ws.subscriptionsMu.Lock()
+	ws.subscriptions[subscription{book: book, channel: channel}] = true
+	ws.subscriptionsMu.Unlock()
+
+	return nil
+}
+
+func (ws *Websocket) sendSubscribe(book BookCode, channel Channel) error {
 	subscribePayload, err := json.Marshal(SubscribeRequestMessage{
 		Action: ActionType_SUBSCRIBE,
 		Book: book,
@@ -71,7 +333,7 @@ func (ws *Websocket) Subscribe(book BookCode, channel Channel) error {
 		return NewWebSocketError(fmt.Sprintf("subscribe message build failed: %v", err))
 	}
 
-	err = ws.conn.WriteMessage(websocket.TextMessage, subscribePayload)
+	err = ws.write(websocket.TextMessage, subscribePayload)
 	if err != nil {
 		return NewWebSocketError(fmt.Sprintf("subscribe message send failed: %v", err))
 	}
@@ -79,137 +341,166 @@ func (ws *Websocket) Subscribe(book BookCode, channel Channel) error {
 	return nil
 }
 
+// Unsubscribe asks the server to stop sending the specified channel for an specific book
+func (ws *Websocket) Unsubscribe(book BookCode, channel Channel) error {
+	ws.subscriptionsMu.Lock()
+	delete(ws.subscriptions, subscription{book: book, channel: channel})
+	ws.subscriptionsMu.Unlock()
+
+	unsubscribePayload, err := json.Marshal(SubscribeRequestMessage{
+		Action: ActionType_UNSUBSCRIBE,
+		Book: book,
+		Channel: channel,
+	})
+
+	if err != nil {
+		return NewWebSocketError(fmt.Sprintf("unsubscribe message build failed: %v", err))
+	}
+
+	err = ws.write(websocket.TextMessage, unsubscribePayload)
+	if err != nil {
+		return NewWebSocketError(fmt.Sprintf("unsubscribe message send failed: %v", err))
+	}
+
+	return nil
+}
+
 // Disconnect closes the current Websocket connection as cleanly as possible
 func (ws *Websocket) Disconnect() {
 	ws.quitOnce.Do(func() {
-		// Close the quit channel
+		// Close the quit channel, under the connection lock so a reconnection can never adopt its new connection
+		// after we looked for the one to close
+		ws.connMu.Lock()
 		close(ws.quit)
-
-		// when the 'quit' channel is closed, the writer should attempt a clean disconnect
-		// we'll wait a little to allow that last message to be sent
-		time.Sleep(time.Second)
+		conn := ws.conn
+		ws.connMu.Unlock()
 
 		// Now we can close the connection.
-		if err := ws.conn.Close(); err != nil {
-			// Failed to properly close the connection
-			// TODO: verbose error?
+		if conn != nil {
+			// when the 'quit' channel is closed, the writer should attempt a clean disconnect
+			// we'll wait a little to allow that last message to be sent
+			time.Sleep(time.Second)
+
+			if err := conn.Close(); err != nil {
+				// Failed to properly close the connection
+				// TODO: verbose error?
+			}
 		}
 
-		// send a last message to the Feed to notify upstream of the disconnection
-		ws.sendFeedMessage(FeedMessage{Channel: Channel_DISCONNECTED})
+		ws.setState(ConnectionState_DISCONNECTED)
+
+		// send a last message to the Feed to notify upstream of the disconnection, it skips the queue limit
+		ws.queue.pushForce(FeedMessage{Channel: Channel_DISCONNECTED})
 	})
 }
 
-func (ws *Websocket) reader() {
+func (ws *Websocket) reader(conn *websocket.Conn, done chan bool) {
+	// the read deadline is pushed forward once every message is handled, if the server stops sending even its "ka"
+	// heartbeats the read fails and the connection is considered stale. The time spent handling a message, blocked
+	// on a full feed queue with OverflowPolicy_BLOCK for instance, does not count.
+	conn.SetReadDeadline(time.Now().Add(ws.staleTimeout))
+	conn.SetPongHandler(func(string) error {
+		ws.setLastPong(time.Now())
+		return nil
+	})
+
 	ReadLoop:
 	for {
-		_, message, err := ws.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Println(LOG_PREFIX + "read:", err)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				ws.logger.Log(LogLevel_WARN, "connection is stale", Field("endpoint", ws.endpoint), Field("stale_timeout", ws.staleTimeout))
+				ws.setState(ConnectionState_STALE)
+			} else {
+				ws.logger.Log(LogLevel_WARN, "read failed", Field("endpoint", ws.endpoint), Field("error", err))
+			}
 			break ReadLoop
 		}
 		//log.Printf("recv: %s", message)
 
-		// Parse the incoming message
-		incoming := IncomingMessage{}
-		err = json.Unmarshal(message, &incoming)
-		if err != nil {
-			log.Println(LOG_PREFIX + "unknown incoming message format", err)
-			break ReadLoop
-		}
+		ws.setLastMessage(time.Now())
 
-		//log.Println(incoming.Channel, incoming.Action)
-
-		switch incoming.Channel {
-		case Channel_KEEP_ALIVE:
-			// received a server heartbeat, all is good, do nothing.
-			continue ReadLoop
-
-		case Channel_ORDERS:
-			switch incoming.Action {
-			case ActionType_SUBSCRIBE:
-				log.Println(LOG_PREFIX + "ORDERS subscription ok!")
-			case ActionType_NULL:
-				// no action was specified, therefore it's a regular Orders Channel message
-				ordersPayload := Orders{}
-				err = json.Unmarshal(*incoming.Payload, &ordersPayload)
-
-				// pass down the orders message
-				ws.sendFeedMessage(FeedMessage{
-					Channel: Channel_ORDERS,
-					Book: incoming.Book,
-					Payload: ordersPayload,
-				})
-			default:
-				// woah, what happened? unknown action!
-				break ReadLoop
-			}
-
-		case Channel_TRADES:
-			switch incoming.Action {
-			case ActionType_SUBSCRIBE:
-				log.Println(LOG_PREFIX + "TRADES subscription ok!")
-			case ActionType_NULL:
-				// no action was specified, therefore it's a regular Trades Channel message
-				tradesPayload := make([]Trade, 0)
-				err = json.Unmarshal(*incoming.Payload, &tradesPayload)
-
-				// pass down the orders message
-				ws.sendFeedMessage(FeedMessage{
-					Channel: Channel_TRADES,
-					Book: incoming.Book,
-					Payload: tradesPayload,
-				})
-			default:
-				// woah, what happened? unknown action!
-				break ReadLoop
+		if ws.recorder != nil {
+			if err := ws.recorder.Record(time.Now(), message); err != nil {
+				ws.logger.Log(LogLevel_WARN, "record failed", Field("error", err))
 			}
+		}
 
-		default:
-			// unknown channel, not yet implemented
-			log.Printf(LOG_PREFIX + "unknown channel '%s'", string(incoming.Channel))
+		if !ws.handleFrame(message) {
 			break ReadLoop
 		}
+
+		conn.SetReadDeadline(time.Now().Add(ws.staleTimeout))
+	}
+
+	// stop this connection's writer
+	close(done)
+
+	select {
+	case <-ws.quit:
+		// we're already disconnecting
+		return
+	default:
 	}
 
 	// if the loop breaks it means that a message failed to be read or parsed
 	// and we'll consider that as a connection failure.
+	if ws.reconnect {
+		conn.Close()
+		ws.reconnectLoop()
+		return
+	}
+
 	// we'll throw a Disconnect() for good measure
 	ws.Disconnect()
 }
 
 func (ws *Websocket) sendFeedMessage(m FeedMessage) {
-	// attempt to send a FeedMessage upstream
-	select {
-	case ws.feed <- m:
-	default:
+	// attempt to send a FeedMessage upstream, the queue applies the configured overflow policy
+	ok := ws.queue.push(m)
+
+	if !ok {
 		// the queue is full, we'll disconnect ourselves, the upstream is not responding.
-		log.Println(LOG_PREFIX + "feed message queue is full")
+		ws.logger.Log(LogLevel_ERROR, "feed message queue is full", Field("channel", m.Channel), Field("book", m.Book))
 		ws.Disconnect()
 	}
 }
 
-func (ws *Websocket) writer() {
-	ticker := time.NewTicker(time.Second) // keep-alive
+// FeedStats returns the current depth of the feed queue and the delivered, dropped and coalesced message counters
+func (ws *Websocket) FeedStats() FeedStats {
+	return ws.queue.stats()
+}
+
+func (ws *Websocket) writer(conn *websocket.Conn, done chan bool) {
+	ticker := time.NewTicker(ws.pingInterval) // keep-alive
 	defer ticker.Stop()
 
 	for {
 		select {
-		case t := <-ticker.C:
-			err := ws.conn.WriteMessage(websocket.TextMessage, []byte(t.String()))
+		case <-ticker.C:
+			ws.writeMu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WRITE_TIMEOUT))
+			ws.writeMu.Unlock()
 			if err != nil {
-				log.Println(LOG_PREFIX + "write:", err)
+				ws.logger.Log(LogLevel_WARN, "ping failed", Field("error", err))
+				// the reader will notice the failure
+				conn.Close()
 				return
 			}
+		case <-done:
+			// the reader gave up on this connection
+			return
 		case <-ws.quit:
 			// this will only happen
-			log.Println(LOG_PREFIX + "quit, attempting clean disconnect")
+			ws.logger.Log(LogLevel_INFO, "quit, attempting clean disconnect")
 
 			// Cleanly close the connection by sending a close message and then
 			// waiting (with timeout) for the server to close the connection.
-			err := ws.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			ws.writeMu.Lock()
+			err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			ws.writeMu.Unlock()
 			if err != nil {
-				log.Println(LOG_PREFIX + "write close:", err)
+				ws.logger.Log(LogLevel_WARN, "write close failed", Field("error", err))
 			}
 
 			return
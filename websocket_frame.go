@@ -0,0 +1,123 @@
+package bitso
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// payloadError is a frame whose envelope is valid but its payload could not be parsed, the connection can keep
+// going after it
+type payloadError struct {
+	err error
+}
+
+func (e payloadError) Error() string {
+	return fmt.Sprintf("invalid payload: %v", e.err)
+}
+
+// ParseFrame parses a raw websocket frame as sent by the server. Data messages (Orders, Trades and Diff-Orders)
+// are returned with ok set; heartbeats and subscription acknowledgements are valid frames without data.
+func ParseFrame(frame []byte) (msg FeedMessage, ok bool, err error) {
+	_, msg, ok, err = parseFrame(frame)
+	return msg, ok, err
+}
+
+func parseFrame(frame []byte) (incoming IncomingMessage, msg FeedMessage, ok bool, err error) {
+	// Parse the incoming message
+	err = json.Unmarshal(frame, &incoming)
+	if err != nil {
+		return incoming, msg, false, fmt.Errorf("unknown incoming message format: %v", err)
+	}
+
+	switch incoming.Channel {
+	case Channel_KEEP_ALIVE:
+		// received a server heartbeat, all is good, do nothing.
+		return incoming, msg, false, nil
+
+	case Channel_ORDERS, Channel_TRADES, Channel_DIFF_ORDERS:
+		// known channel
+
+	default:
+		// unknown channel, not yet implemented
+		return incoming, msg, false, fmt.Errorf("unknown channel '%s'", string(incoming.Channel))
+	}
+
+	switch incoming.Action {
+	case ActionType_SUBSCRIBE, ActionType_UNSUBSCRIBE:
+		return incoming, msg, false, nil
+	case ActionType_NULL:
+		// no action was specified, therefore it's a regular channel message
+	default:
+		// woah, what happened? unknown action!
+		return incoming, msg, false, fmt.Errorf("unknown action '%s'", string(incoming.Action))
+	}
+
+	if incoming.Payload == nil {
+		return incoming, msg, false, payloadError{err: fmt.Errorf("missing payload")}
+	}
+
+	msg = FeedMessage{
+		Channel: incoming.Channel,
+		Book: incoming.Book,
+		Sequence: incoming.Sequence,
+	}
+
+	switch incoming.Channel {
+	case Channel_ORDERS:
+		ordersPayload := Orders{}
+		err = json.Unmarshal(*incoming.Payload, &ordersPayload)
+		msg.Payload = ordersPayload
+
+	case Channel_TRADES:
+		tradesPayload := make([]Trade, 0)
+		err = json.Unmarshal(*incoming.Payload, &tradesPayload)
+		msg.Payload = tradesPayload
+
+	case Channel_DIFF_ORDERS:
+		// the sequence is required to rebuild the book
+		diffsPayload := make([]DiffOrder, 0)
+		err = json.Unmarshal(*incoming.Payload, &diffsPayload)
+		msg.Payload = diffsPayload
+	}
+
+	if err != nil {
+		return incoming, FeedMessage{}, false, payloadError{err: err}
+	}
+
+	return incoming, msg, true, nil
+}
+
+// handleFrame parses a frame and passes its message down to the feed, it returns false when the frame is broken
+// enough to consider the connection failed
+func (ws *Websocket) handleFrame(frame []byte) bool {
+	incoming, msg, ok, err := parseFrame(frame)
+
+	if incoming.Channel != "" {
+		ws.metrics.ObserveMessage(incoming.Channel, incoming.Book)
+	}
+
+	if err != nil {
+		if _, isPayload := err.(payloadError); isPayload {
+			ws.logger.Log(LogLevel_ERROR, "invalid payload", Field("channel", incoming.Channel), Field("book", incoming.Book), Field("error", err))
+			return true
+		}
+
+		ws.logger.Log(LogLevel_ERROR, "invalid message", Field("channel", incoming.Channel), Field("error", err))
+		return false
+	}
+
+	if !ok {
+		switch incoming.Action {
+		case ActionType_SUBSCRIBE:
+			ws.logger.Log(LogLevel_INFO, "subscription ok!", Field("channel", incoming.Channel))
+		case ActionType_UNSUBSCRIBE:
+			ws.logger.Log(LogLevel_INFO, "unsubscribed", Field("channel", incoming.Channel))
+		}
+		return true
+	}
+
+	// pass down the message
+	ws.sendFeedMessage(msg)
+
+	return true
+}
@@ -0,0 +1,163 @@
+package bitso
+
+import "sync"
+
+// Typed handlers for each of the websocket channels, they are an alternative to reading the raw FeedMessage
+// channel and type-asserting the Payload
+type TradesHandler func(book BookCode, trades []Trade)
+type OrdersHandler func(book BookCode, orders Orders)
+type DiffOrdersHandler func(book BookCode, sequence int64, diffs []DiffOrder)
+type DisconnectHandler func()
+type ReconnectHandler func()
+
+type feedHandlers struct {
+	mu 			sync.RWMutex
+
+	trades 		[]tradesRoute
+	orders 		[]ordersRoute
+	diffOrders 	[]diffOrdersRoute
+	disconnect 	[]DisconnectHandler
+	reconnect 	[]ReconnectHandler
+}
+
+// bookFilter is the set of books a handler was registered for, an empty filter matches every book
+type bookFilter map[BookCode]bool
+
+func newBookFilter(books []BookCode) bookFilter {
+	f := make(bookFilter)
+	for _, b := range books {
+		f[b] = true
+	}
+	return f
+}
+
+func (f bookFilter) matches(book BookCode) bool {
+	return len(f) == 0 || f[book]
+}
+
+type tradesRoute struct {
+	books 	bookFilter
+	handler TradesHandler
+}
+
+type ordersRoute struct {
+	books 	bookFilter
+	handler OrdersHandler
+}
+
+type diffOrdersRoute struct {
+	books 	bookFilter
+	handler DiffOrdersHandler
+}
+
+// OnTrades registers a handler for the Trades channel. If any books are given the handler will only receive
+// messages for those books, otherwise it receives every book the websocket is subscribed to.
+func (ws *Websocket) OnTrades(handler TradesHandler, books ...BookCode) {
+	ws.handlers.mu.Lock()
+	defer ws.handlers.mu.Unlock()
+
+	ws.handlers.trades = append(ws.handlers.trades, tradesRoute{books: newBookFilter(books), handler: handler})
+}
+
+// OnOrders registers a handler for the Orders channel, optionally restricted to the given books
+func (ws *Websocket) OnOrders(handler OrdersHandler, books ...BookCode) {
+	ws.handlers.mu.Lock()
+	defer ws.handlers.mu.Unlock()
+
+	ws.handlers.orders = append(ws.handlers.orders, ordersRoute{books: newBookFilter(books), handler: handler})
+}
+
+// OnDiffOrders registers a handler for the Diff-Orders channel, optionally restricted to the given books
+func (ws *Websocket) OnDiffOrders(handler DiffOrdersHandler, books ...BookCode) {
+	ws.handlers.mu.Lock()
+	defer ws.handlers.mu.Unlock()
+
+	ws.handlers.diffOrders = append(ws.handlers.diffOrders, diffOrdersRoute{books: newBookFilter(books), handler: handler})
+}
+
+// OnDisconnect registers a handler that will be called once the websocket connection is closed
+func (ws *Websocket) OnDisconnect(handler DisconnectHandler) {
+	ws.handlers.mu.Lock()
+	defer ws.handlers.mu.Unlock()
+
+	ws.handlers.disconnect = append(ws.handlers.disconnect, handler)
+}
+
+// OnReconnect registers a handler that will be called after the websocket reconnects, see WithReconnect
+func (ws *Websocket) OnReconnect(handler ReconnectHandler) {
+	ws.handlers.mu.Lock()
+	defer ws.handlers.mu.Unlock()
+
+	ws.handlers.reconnect = append(ws.handlers.reconnect, handler)
+}
+
+// Listen consumes the feed returned by Connect and routes every message to the registered handlers. It blocks
+// until the websocket is disconnected, and it must not be used while another goroutine is also reading the feed.
+func (ws *Websocket) Listen() {
+	for {
+		msg := <-ws.feed
+
+		ws.dispatch(msg)
+
+		if msg.Channel == Channel_DISCONNECTED {
+			return
+		}
+	}
+}
+
+// dispatch calls every handler registered for the message's channel and book. The handler lists are copied
+// before calling them so a handler may register new handlers without deadlocking.
+func (ws *Websocket) dispatch(msg FeedMessage) {
+	ws.handlers.mu.RLock()
+	tradesRoutes := ws.handlers.trades
+	ordersRoutes := ws.handlers.orders
+	diffOrdersRoutes := ws.handlers.diffOrders
+	disconnectHandlers := ws.handlers.disconnect
+	reconnectHandlers := ws.handlers.reconnect
+	ws.handlers.mu.RUnlock()
+
+	switch msg.Channel {
+	case Channel_TRADES:
+		trades, ok := msg.Trades()
+		if !ok {
+			return
+		}
+		for _, r := range tradesRoutes {
+			if r.books.matches(msg.Book) {
+				r.handler(msg.Book, trades)
+			}
+		}
+
+	case Channel_ORDERS:
+		orders, ok := msg.Orders()
+		if !ok {
+			return
+		}
+		for _, r := range ordersRoutes {
+			if r.books.matches(msg.Book) {
+				r.handler(msg.Book, orders)
+			}
+		}
+
+	case Channel_DIFF_ORDERS:
+		diffs, ok := msg.DiffOrders()
+		if !ok {
+			return
+		}
+		for _, r := range diffOrdersRoutes {
+			if r.books.matches(msg.Book) {
+				r.handler(msg.Book, msg.Sequence, diffs)
+			}
+		}
+
+	case Channel_DISCONNECTED:
+		for _, h := range disconnectHandlers {
+			h()
+		}
+
+	case Channel_RECONNECTED:
+		for _, h := range reconnectHandlers {
+			h()
+		}
+	}
+}
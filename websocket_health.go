@@ -0,0 +1,167 @@
+package bitso
+
+import "time"
+
+type ConnectionState int
+
+const (
+	ConnectionState_DISCONNECTED 	ConnectionState = iota
+	ConnectionState_CONNECTED
+	ConnectionState_STALE
+	ConnectionState_RECONNECTING
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionState_DISCONNECTED:
+		return "DISCONNECTED"
+	case ConnectionState_CONNECTED:
+		return "CONNECTED"
+	case ConnectionState_STALE:
+		return "STALE"
+	case ConnectionState_RECONNECTING:
+		return "RECONNECTING"
+	default:
+		return ""
+	}
+}
+
+// HealthStatus describes the state of the websocket connection
+type HealthStatus struct {
+	State 		ConnectionState
+	ConnectedAt time.Time
+	LastMessage time.Time // last message of any channel, including the server's "ka" heartbeats
+	LastPong 	time.Time
+	Reconnects 	int
+}
+
+// Healthy is true when the connection is up and a message was received within the given threshold
+func (h HealthStatus) Healthy(threshold time.Duration) bool {
+	if h.State != ConnectionState_CONNECTED {
+		return false
+	}
+
+	last := h.LastMessage
+	if last.IsZero() {
+		last = h.ConnectedAt
+	}
+
+	return time.Since(last) <= threshold
+}
+
+// subscription is a (book, channel) pair the websocket is subscribed to
+type subscription struct {
+	book 	BookCode
+	channel Channel
+}
+
+// Health returns the current status of the connection
+func (ws *Websocket) Health() HealthStatus {
+	ws.healthMu.RLock()
+	defer ws.healthMu.RUnlock()
+
+	return ws.health
+}
+
+func (ws *Websocket) setState(state ConnectionState) {
+	ws.healthMu.Lock()
+	defer ws.healthMu.Unlock()
+
+	ws.health.State = state
+}
+
+func (ws *Websocket) setConnected() {
+	ws.healthMu.Lock()
+	defer ws.healthMu.Unlock()
+
+	ws.health.State = ConnectionState_CONNECTED
+	ws.health.ConnectedAt = time.Now()
+}
+
+func (ws *Websocket) setLastMessage(t time.Time) {
+	ws.healthMu.Lock()
+	defer ws.healthMu.Unlock()
+
+	ws.health.LastMessage = t
+}
+
+func (ws *Websocket) setLastPong(t time.Time) {
+	ws.healthMu.Lock()
+	defer ws.healthMu.Unlock()
+
+	ws.health.LastPong = t
+}
+
+// reconnectLoop redials with an exponential backoff until it succeeds or the websocket is disconnected, then
+// restores every subscription and notifies the feed
+func (ws *Websocket) reconnectLoop() {
+	ws.setState(ConnectionState_RECONNECTING)
+
+	backoff := time.Second
+
+	for {
+		select {
+		case <-ws.quit:
+			return
+		case <-time.After(backoff):
+		}
+
+		ws.logger.Log(LogLevel_INFO, "reconnecting", Field("endpoint", ws.endpoint))
+
+		conn, err := ws.dial()
+		if err != nil {
+			ws.logger.Log(LogLevel_WARN, "reconnect failed", Field("endpoint", ws.endpoint), Field("error", err), Field("backoff", backoff))
+
+			backoff *= 2
+			if backoff > MAX_RECONNECT_BACKOFF {
+				backoff = MAX_RECONNECT_BACKOFF
+			}
+			continue
+		}
+
+		// the quit check and the swap share the lock Disconnect closes quit with, otherwise it could run in between
+		// and leave this connection open
+		ws.connMu.Lock()
+		select {
+		case <-ws.quit:
+			// disconnected while we were dialing
+			ws.connMu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		ws.conn = conn
+		ws.connMu.Unlock()
+
+		ws.healthMu.Lock()
+		ws.health.Reconnects++
+		ws.healthMu.Unlock()
+
+		ws.metrics.ObserveReconnect()
+
+		// anything built from the previous connection (ex. a local order book) may be missing messages. The marker
+		// is queued before the new reader starts, so it comes ahead of its messages, and skips the queue limit like
+		// the Disconnected one.
+		ws.queue.pushForce(FeedMessage{Channel: Channel_RECONNECTED})
+
+		ws.launch(conn)
+
+		ws.logger.Log(LogLevel_INFO, "reconnected!", Field("endpoint", ws.endpoint))
+
+		// resubscribe from a copy, every request is a network write
+		ws.subscriptionsMu.Lock()
+		subscriptions := make([]subscription, 0, len(ws.subscriptions))
+		for s := range ws.subscriptions {
+			subscriptions = append(subscriptions, s)
+		}
+		ws.subscriptionsMu.Unlock()
+
+		for _, s := range subscriptions {
+			if err := ws.sendSubscribe(s.book, s.channel); err != nil {
+				ws.logger.Log(LogLevel_ERROR, "resubscribe failed", Field("book", s.book), Field("channel", s.channel), Field("error", err))
+			}
+		}
+
+		return
+	}
+}
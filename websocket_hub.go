@@ -0,0 +1,281 @@
+package bitso
+
+import "sync"
+
+// HubFilter selects the messages of a single channel for a single book
+type HubFilter struct {
+	Book 	BookCode
+	Channel Channel
+}
+
+// WebsocketHub owns a single Websocket connection and fans out its feed to many in-process subscribers. The
+// hub subscribes upstream the first time a (book, channel) pair is requested and unsubscribes once the last
+// subscriber interested in it is closed. Like its Websocket, a hub connects once: after Disconnect both must be
+// created again.
+type WebsocketHub struct {
+	ws 			*Websocket
+
+	// upstreamMu is held from a change of interest until the subscription it requires is written, so the writes for
+	// a pair reach the server in the order the interest changed
+	upstreamMu 	sync.Mutex
+
+	mu 			sync.Mutex
+	connecting 	bool
+	connected 	bool
+	closed 		bool
+	interest 	map[HubFilter]int
+	subscribers map[*HubSubscriber]bool
+}
+
+// HubSubscriber receives the messages matching its filters through its own queue, so a slow subscriber only
+// affects itself and never the connection shared by the rest
+type HubSubscriber struct {
+	hub 		*WebsocketHub
+	filters 	map[HubFilter]bool
+	queue 		*feedQueue
+	closeOnce 	sync.Once
+}
+
+// NewWebsocketHub returns a hub for the given (not yet connected) Websocket
+func NewWebsocketHub(ws *Websocket) *WebsocketHub {
+	return &WebsocketHub{
+		ws: ws,
+		interest: make(map[HubFilter]int),
+		subscribers: make(map[*HubSubscriber]bool),
+	}
+}
+
+// Connect establishes the websocket connection, starts distributing the feed to the subscribers and subscribes
+// upstream to every filter requested so far. When one of those subscriptions fails the connection stays up and
+// its error is returned. A hub that was disconnected cannot connect again, a new Websocket and hub are needed.
+func (h *WebsocketHub) Connect() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return NewWebSocketError("websocket hub was disconnected, create a new Websocket and hub")
+	}
+	if h.connected || h.connecting {
+		h.mu.Unlock()
+		return NewWebSocketError("websocket hub is already connected")
+	}
+	h.connecting = true
+	h.mu.Unlock()
+
+	// no lock held while dialing, subscribers may come and go meanwhile
+	feed, err := h.ws.Connect()
+
+	h.upstreamMu.Lock()
+	defer h.upstreamMu.Unlock()
+
+	h.mu.Lock()
+	h.connecting = false
+	if err != nil {
+		h.mu.Unlock()
+		return err
+	}
+
+	// from here on Subscribe handles the new pairs itself, the ones requested so far are subscribed below
+	h.connected = true
+	filters := make([]HubFilter, 0, len(h.interest))
+	for f := range h.interest {
+		filters = append(filters, f)
+	}
+	h.mu.Unlock()
+
+	// the feed is drained before any network write, whatever happens to the subscriptions
+	go h.fanOut(feed)
+
+	for _, f := range filters {
+		if err := h.ws.Subscribe(f.Book, f.Channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Disconnect closes the shared connection for good, every subscriber will receive a Channel_DISCONNECTED message
+func (h *WebsocketHub) Disconnect() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+
+	h.ws.Disconnect()
+}
+
+// Subscribe registers a new subscriber for the given filters. Each subscriber has its own queue with the given
+// size and overflow policy; with OverflowPolicy_DISCONNECT only the subscriber is dropped, not the connection.
+// OverflowPolicy_BLOCK is rejected, a full subscriber would stall the fan-out to every other one.
+func (h *WebsocketHub) Subscribe(queueSize int, policy OverflowPolicy, filters ...HubFilter) (*HubSubscriber, error) {
+	if len(filters) == 0 {
+		return nil, NewWebSocketError("at least one (book, channel) filter is required")
+	}
+	if policy == OverflowPolicy_BLOCK {
+		return nil, NewWebSocketError("hub subscribers cannot use OverflowPolicy_BLOCK")
+	}
+
+	s := &HubSubscriber{
+		hub: h,
+		filters: make(map[HubFilter]bool),
+		queue: newFeedQueue(queueSize, policy),
+	}
+	s.queue.start()
+
+	h.upstreamMu.Lock()
+	defer h.upstreamMu.Unlock()
+
+	// the pairs nobody wanted yet are subscribed upstream once the lock is released
+	subscribe := make([]HubFilter, 0)
+
+	h.mu.Lock()
+	for _, f := range filters {
+		if s.filters[f] {
+			// repeated filter, only count the interest once
+			continue
+		}
+		s.filters[f] = true
+
+		h.interest[f]++
+		if h.interest[f] == 1 && h.connected {
+			subscribe = append(subscribe, f)
+		}
+	}
+	h.subscribers[s] = true
+	h.mu.Unlock()
+
+	for _, f := range subscribe {
+		if err := h.ws.Subscribe(f.Book, f.Channel); err != nil {
+			s.closeOnce.Do(s.drop)
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// release drops the subscriber's interest and returns the pairs nobody else wants, they must be unsubscribed from
+// with unsubscribe once the lock is released. Must be called with the lock held.
+func (h *WebsocketHub) release(s *HubSubscriber) []HubFilter {
+	delete(h.subscribers, s)
+
+	unwanted := make([]HubFilter, 0)
+	for f := range s.filters {
+		h.interest[f]--
+		if h.interest[f] > 0 {
+			continue
+		}
+
+		delete(h.interest, f)
+		if h.connected {
+			unwanted = append(unwanted, f)
+		}
+	}
+
+	return unwanted
+}
+
+// unsubscribe asks the server to stop sending the given pairs, must be called with the upstream lock held and
+// without the lock held since every request is a network write
+func (h *WebsocketHub) unsubscribe(filters []HubFilter) {
+	for _, f := range filters {
+		if err := h.ws.Unsubscribe(f.Book, f.Channel); err != nil {
+			h.ws.logger.Log(LogLevel_WARN, "hub unsubscribe failed", Field("book", f.Book), Field("channel", f.Channel), Field("error", err))
+		}
+	}
+}
+
+func (h *WebsocketHub) fanOut(feed <-chan FeedMessage) {
+	for {
+		msg := <-feed
+
+		h.mu.Lock()
+		if msg.Channel == Channel_DISCONNECTED {
+			// notify everyone and forget about them, the connection is gone
+			h.connected = false
+			subscribers := h.subscribers
+			h.subscribers = make(map[*HubSubscriber]bool)
+			h.interest = make(map[HubFilter]int)
+			h.mu.Unlock()
+
+			for s := range subscribers {
+				s.queue.pushForce(msg)
+			}
+			return
+		}
+
+		// the queues are pushed to without the lock, so Subscribe and Close never wait for the fan-out
+		receivers := make([]*HubSubscriber, 0, len(h.subscribers))
+		f := HubFilter{Book: msg.Book, Channel: msg.Channel}
+		for s := range h.subscribers {
+			// every subscriber may have missed messages while the connection was down
+			if msg.Channel == Channel_RECONNECTED || s.filters[f] {
+				receivers = append(receivers, s)
+			}
+		}
+		h.mu.Unlock()
+
+		for _, s := range receivers {
+			if s.queue.push(msg) {
+				continue
+			}
+
+			// this subscriber is not keeping up, drop it alone
+			h.ws.logger.Log(LogLevel_WARN, "hub subscriber queue is full, dropping subscriber", Field("book", msg.Book), Field("channel", msg.Channel))
+			s.queue.pushForce(FeedMessage{Channel: Channel_DISCONNECTED})
+
+			h.upstreamMu.Lock()
+			var unwanted []HubFilter
+			h.mu.Lock()
+			if h.subscribers[s] {
+				unwanted = h.release(s)
+			}
+			h.mu.Unlock()
+			h.unsubscribe(unwanted)
+			h.upstreamMu.Unlock()
+		}
+	}
+}
+
+// Feed returns the channel with the messages matching the subscriber's filters. A Channel_DISCONNECTED message
+// is sent when the subscriber is dropped or the connection is closed, and a Channel_RECONNECTED message after
+// the connection is restored.
+func (s *HubSubscriber) Feed() <-chan FeedMessage {
+	return s.queue.out
+}
+
+// SetMetrics sets the Metrics notified of the messages dropped by the subscriber's own queue and of its depth, the
+// dropped messages of the subscribers are not reported to the Websocket's Metrics. Each subscriber needs its own
+// queue depth gauge, see bitsoprom.Exporter.Queue.
+func (s *HubSubscriber) SetMetrics(metrics Metrics) {
+	s.queue.setMetrics(metrics)
+}
+
+// Stats returns the counters of the subscriber's own queue
+func (s *HubSubscriber) Stats() FeedStats {
+	return s.queue.stats()
+}
+
+// Close removes the subscriber from the hub, when it was the last one interested in a (book, channel) pair the hub
+// unsubscribes from it upstream
+func (s *HubSubscriber) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.upstreamMu.Lock()
+		defer s.hub.upstreamMu.Unlock()
+
+		s.drop()
+	})
+}
+
+// drop closes the queue and releases the subscriber, must be called with the upstream lock held
+func (s *HubSubscriber) drop() {
+	// close the queue first, the fan-out may still hold this subscriber but nothing else is delivered to it
+	s.queue.close()
+
+	var unwanted []HubFilter
+	s.hub.mu.Lock()
+	if s.hub.subscribers[s] {
+		unwanted = s.hub.release(s)
+	}
+	s.hub.mu.Unlock()
+	s.hub.unsubscribe(unwanted)
+}
@@ -0,0 +1,271 @@
+package bitso_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+func TestWebsocketHubFanOut(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	hub := bitso.NewWebsocketHub(quietListener(server))
+
+	btcTrades := bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES}
+	ethTrades := bitso.HubFilter{Book: "eth_mxn", Channel: bitso.Channel_TRADES}
+
+	a, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, btcTrades)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, btcTrades, ethTrades)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Disconnect()
+
+	eventually(t, "the upstream subscriptions", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1 && server.Subscribers("eth_mxn", bitso.Channel_TRADES) == 1
+	})
+
+	server.PublishTrades("eth_mxn", []bitso.Trade{{Folio: 1, Amount: d("1"), Rate: d("50000")}})
+	server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: 2, Amount: d("0.1"), Rate: d("900000")}})
+
+	tests := []struct {
+		name 		string
+		subscriber 	*bitso.HubSubscriber
+		books 		[]bitso.BookCode
+	}{
+		{"btc only", a, []bitso.BookCode{"btc_mxn"}},
+		{"btc and eth", b, []bitso.BookCode{"eth_mxn", "btc_mxn"}},
+	}
+
+	for _, tt := range tests {
+		for _, book := range tt.books {
+			m := next(t, tt.subscriber.Feed())
+			if m.Channel != bitso.Channel_TRADES || m.Book != book {
+				t.Errorf("%s: received %s %s, expecting trades %s", tt.name, m.Channel, m.Book, book)
+			}
+		}
+	}
+
+	// the eth_mxn trades are only wanted by b, closing it unsubscribes upstream
+	b.Close()
+	eventually(t, "the upstream unsubscription", func() bool {
+		return server.Subscribers("eth_mxn", bitso.Channel_TRADES) == 0
+	})
+	if n := server.Subscribers("btc_mxn", bitso.Channel_TRADES); n != 1 {
+		t.Errorf("btc_mxn trades has %d upstream subscriptions, expecting 1", n)
+	}
+
+	a.Close()
+}
+
+func TestWebsocketHubSlowSubscriber(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	hub := bitso.NewWebsocketHub(quietListener(server))
+	filter := bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES}
+
+	slow, err := hub.Subscribe(1, bitso.OverflowPolicy_DISCONNECT, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Disconnect()
+
+	eventually(t, "the upstream subscription", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+	})
+
+	// nobody reads the slow subscriber, its queue of one overflows before the third trade
+	for i := int64(1); i <= 3; i++ {
+		server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: i, Amount: d("0.1"), Rate: d("900000")}})
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		m := next(t, fast.Feed())
+		if trades, ok := m.Trades(); !ok || trades[0].Folio != i {
+			t.Fatalf("fast subscriber received %v, expecting trade %d", m, i)
+		}
+	}
+
+	received := 0
+	for m := range slow.Feed() {
+		if m.Channel == bitso.Channel_DISCONNECTED {
+			break
+		}
+		received++
+	}
+	if received >= 3 {
+		t.Errorf("slow subscriber received %d trades, expecting it to be dropped before the last one", received)
+	}
+
+	// the connection is still shared by the rest
+	if n := server.Subscribers("btc_mxn", bitso.Channel_TRADES); n != 1 {
+		t.Errorf("btc_mxn trades has %d upstream subscriptions, expecting 1", n)
+	}
+}
+
+func TestWebsocketHubConnectsOnce(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	hub := bitso.NewWebsocketHub(quietListener(server))
+	s, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	hub.Disconnect()
+	if m := next(t, s.Feed()); m.Channel != bitso.Channel_DISCONNECTED {
+		t.Errorf("received %s, expecting %s", m.Channel, bitso.Channel_DISCONNECTED)
+	}
+
+	if err := hub.Connect(); err == nil {
+		t.Error("connected again after Disconnect")
+	}
+}
+
+func TestWebsocketHubConcurrentCloseAndSubscribe(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	hub := bitso.NewWebsocketHub(quietListener(server))
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Disconnect()
+
+	filter := bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES}
+	marker := bitso.HubFilter{Book: "eth_mxn", Channel: bitso.Channel_TRADES}
+
+	current, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		// the last subscriber leaves while a new one arrives
+		var next *bitso.HubSubscriber
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func(s *bitso.HubSubscriber) {
+			defer wg.Done()
+			s.Close()
+		}(current)
+		go func() {
+			defer wg.Done()
+			next, err = hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, filter)
+		}()
+		wg.Wait()
+		if err != nil {
+			t.Fatal(err)
+		}
+		current = next
+
+		// the server handles the requests in order, once it saw the marker it saw the rest
+		m, err := hub.Subscribe(10, bitso.OverflowPolicy_DROP_OLDEST, marker)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the marker subscription", func() bool {
+			return server.Subscribers("eth_mxn", bitso.Channel_TRADES) == 1
+		})
+		if n := server.Subscribers("btc_mxn", bitso.Channel_TRADES); n != 1 {
+			t.Fatalf("iteration %d: btc_mxn trades has %d upstream subscriptions with a subscriber, expecting 1", i, n)
+		}
+		m.Close()
+		eventually(t, "the marker unsubscription", func() bool {
+			return server.Subscribers("eth_mxn", bitso.Channel_TRADES) == 0
+		})
+	}
+
+	current.Close()
+}
+
+func TestWebsocketHubRejectsBlock(t *testing.T) {
+	hub := bitso.NewWebsocketHub(bitso.NewWebsocketListener(bitso.WithLogger(bitso.NopLogger())))
+
+	_, err := hub.Subscribe(10, bitso.OverflowPolicy_BLOCK, bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES})
+	if err == nil {
+		t.Error("expecting an error for OverflowPolicy_BLOCK")
+	}
+}
+
+// queueMetrics records the queue events of a hub subscriber
+type queueMetrics struct {
+	bitso.Metrics
+
+	mu 		sync.Mutex
+	depth 	int
+	dropped int
+}
+
+func (m *queueMetrics) ObserveDropped(channel bitso.Channel, book bitso.BookCode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped++
+}
+
+func (m *queueMetrics) ObserveQueueDepth(depth int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.depth = depth
+}
+
+func TestWebsocketHubSubscriberMetrics(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	hub := bitso.NewWebsocketHub(quietListener(server))
+	filter := bitso.HubFilter{Book: "btc_mxn", Channel: bitso.Channel_TRADES}
+
+	s, err := hub.Subscribe(1, bitso.OverflowPolicy_DROP_OLDEST, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	metrics := &queueMetrics{Metrics: bitso.NopMetrics()}
+	s.SetMetrics(metrics)
+
+	if err := hub.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Disconnect()
+
+	eventually(t, "the upstream subscription", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+	})
+
+	// nobody reads the subscriber, its queue of one drops the older trades
+	for i := int64(1); i <= 4; i++ {
+		server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: i, Amount: d("0.1"), Rate: d("900000")}})
+	}
+
+	eventually(t, "the dropped trades", func() bool {
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		return metrics.dropped > 0 && metrics.depth == 1
+	})
+}
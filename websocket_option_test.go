@@ -0,0 +1,83 @@
+package bitso
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocketDialerOptions(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "ws.example.com"}
+	proxyURL, _ := url.Parse("http://proxy.example.com:3128")
+	proxy := http.ProxyURL(proxyURL)
+
+	settings := []WebsocketOption{
+		WithTLSConfig(tlsConfig),
+		WithProxy(proxy),
+		WithHandshakeTimeout(3 * time.Second),
+		WithCompression(true),
+	}
+
+	tests := []struct {
+		name 	string
+		dialer 	*websocket.Dialer
+		before 	bool // settings given before WithDialer
+	}{
+		{"default dialer", nil, false},
+		{"settings after the dialer", &websocket.Dialer{HandshakeTimeout: time.Second}, false},
+		{"settings before the dialer", &websocket.Dialer{HandshakeTimeout: time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := append([]WebsocketOption{}, settings...)
+			if tt.dialer != nil {
+				if tt.before {
+					options = append(options, WithDialer(tt.dialer))
+				} else {
+					options = append([]WebsocketOption{WithDialer(tt.dialer)}, options...)
+				}
+			}
+			options = append(options, WithLogger(NopLogger()))
+
+			ws := NewWebsocketListener(options...)
+
+			if ws.dialer.TLSClientConfig != tlsConfig {
+				t.Error("TLS config not applied")
+			}
+			if ws.dialer.Proxy == nil {
+				t.Error("proxy not applied")
+			} else if u, _ := ws.dialer.Proxy(&http.Request{URL: &url.URL{Scheme: "https"}}); u == nil || u.String() != proxyURL.String() {
+				t.Errorf("proxy is %v, expecting %v", u, proxyURL)
+			}
+			if ws.dialer.HandshakeTimeout != 3 * time.Second {
+				t.Errorf("handshake timeout is %v, expecting 3s", ws.dialer.HandshakeTimeout)
+			}
+			if !ws.dialer.EnableCompression {
+				t.Error("compression not applied")
+			}
+
+			// neither the given dialer nor the default one are modified
+			if tt.dialer != nil {
+				if tt.dialer == ws.dialer || tt.dialer.TLSClientConfig != nil || tt.dialer.HandshakeTimeout != time.Second || tt.dialer.EnableCompression {
+					t.Error("the given dialer was modified")
+				}
+			}
+			if websocket.DefaultDialer.TLSClientConfig != nil || websocket.DefaultDialer.EnableCompression {
+				t.Error("the default dialer was modified")
+			}
+		})
+	}
+}
+
+func TestWebsocketNilDialer(t *testing.T) {
+	ws := NewWebsocketListener(WithDialer(nil), WithCompression(true), WithLogger(NopLogger()))
+
+	if _, err := ws.Connect(); err == nil {
+		t.Error("expecting an error connecting with a nil dialer")
+	}
+}
@@ -0,0 +1,227 @@
+package bitso
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordedFrame is a raw websocket frame and the time it was received, stored as one JSON line
+type RecordedFrame struct {
+	UnixNanos 	int64 	`json:"t"`
+	Frame 		string 	`json:"frame"`
+}
+
+func (f RecordedFrame) Time() time.Time {
+	return time.Unix(0, f.UnixNanos)
+}
+
+// Recorder writes received frames as JSON lines, optionally gzip compressed
+type Recorder struct {
+	mu 		sync.Mutex
+	enc 	*json.Encoder
+	gz 		*gzip.Writer
+	file 	*os.File
+}
+
+// NewRecorder returns a Recorder writing plain JSON lines to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// NewFileRecorder creates (or truncates) the file at path and records to it, gzip compressed if compress is set
+func NewFileRecorder(path string, compress bool) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{file: f}
+
+	if compress {
+		r.gz = gzip.NewWriter(f)
+		r.enc = json.NewEncoder(r.gz)
+	} else {
+		r.enc = json.NewEncoder(f)
+	}
+
+	return r, nil
+}
+
+// Record writes a frame received at t
+func (r *Recorder) Record(t time.Time, frame []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(RecordedFrame{UnixNanos: t.UnixNano(), Frame: string(frame)})
+}
+
+// Close flushes the compressed stream and closes the file, if the Recorder owns one
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.gz != nil {
+		if err := r.gz.Close(); err != nil {
+			return err
+		}
+	}
+
+	if r.file != nil {
+		return r.file.Close()
+	}
+
+	return nil
+}
+
+// Replayer reads frames written by a Recorder
+type Replayer struct {
+	scanner *bufio.Scanner
+	closers []io.Closer
+	speed 	float64
+}
+
+// NewReplayer reads recorded frames from r, which may be gzip compressed. The speed multiplies the original pace
+// between frames (1 is real time, 10 is ten times faster) and 0 replays as fast as possible.
+func NewReplayer(r io.Reader, speed float64) (*Replayer, error) {
+	br := bufio.NewReader(r)
+
+	rp := &Replayer{speed: speed}
+
+	// gzip streams start with the 0x1f 0x8b magic bytes
+	magic, _ := br.Peek(2)
+	if bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		rp.closers = append(rp.closers, gz)
+		rp.scanner = bufio.NewScanner(gz)
+	} else {
+		rp.scanner = bufio.NewScanner(br)
+	}
+
+	// order book snapshots can be larger than the default 64kb token size
+	rp.scanner.Buffer(make([]byte, 64 * 1024), 16 * 1024 * 1024)
+
+	return rp, nil
+}
+
+// OpenReplayFile opens a file written by NewFileRecorder, compressed or not
+func OpenReplayFile(path string, speed float64) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := NewReplayer(f, speed)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	rp.closers = append(rp.closers, f)
+
+	return rp, nil
+}
+
+// Next returns the next recorded frame, or io.EOF at the end of the recording
+func (rp *Replayer) Next() (RecordedFrame, error) {
+	for rp.scanner.Scan() {
+		line := rp.scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		f := RecordedFrame{}
+		if err := json.Unmarshal(line, &f); err != nil {
+			return RecordedFrame{}, fmt.Errorf("invalid recorded frame: %v", err)
+		}
+		return f, nil
+	}
+
+	if err := rp.scanner.Err(); err != nil {
+		return RecordedFrame{}, err
+	}
+
+	return RecordedFrame{}, io.EOF
+}
+
+// Close releases the underlying reader if it was opened by OpenReplayFile
+func (rp *Replayer) Close() error {
+	var err error
+	for _, c := range rp.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Replay feeds a recording through the same parsing as a live connection, instead of connecting to the server.
+// Handlers, Listen and the returned feed behave as with Connect, and the websocket is disconnected at the end of
+// the recording. The Replayer is closed when done.
+func (ws *Websocket) Replay(replayer *Replayer) (<-chan FeedMessage, error) {
+	if ws.currentConn() != nil {
+		return nil, NewWebSocketError("cannot replay on a connected websocket")
+	}
+
+	ws.setConnected()
+	ws.queue.start()
+
+	go func() {
+		defer ws.Disconnect()
+		defer replayer.Close()
+
+		var previous time.Time
+		start := time.Now()
+		var elapsed time.Duration
+
+		for {
+			f, err := replayer.Next()
+			if err == io.EOF {
+				ws.logger.Log(LogLevel_INFO, "replay finished")
+				return
+			}
+			if err != nil {
+				ws.logger.Log(LogLevel_ERROR, "replay failed", Field("error", err))
+				return
+			}
+
+			// keep the original pace between frames, scaled by the speed
+			if replayer.speed > 0 && !previous.IsZero() {
+				elapsed += time.Duration(float64(f.Time().Sub(previous)) / replayer.speed)
+				wait := elapsed - time.Since(start)
+
+				select {
+				case <-ws.quit:
+					return
+				case <-time.After(wait):
+				}
+			} else {
+				select {
+				case <-ws.quit:
+					return
+				default:
+				}
+			}
+			previous = f.Time()
+
+			ws.setLastMessage(time.Now())
+
+			if !ws.handleFrame([]byte(f.Frame)) {
+				return
+			}
+		}
+	}()
+
+	return ws.feed, nil
+}
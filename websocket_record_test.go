@@ -0,0 +1,77 @@
+package bitso_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+func TestWebsocketRecordReplay(t *testing.T) {
+	tests := []struct {
+		name 		string
+		compress 	bool
+	}{
+		{"plain", false},
+		{"gzip", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.jsonl")
+
+			recorder, err := bitso.NewFileRecorder(path, tt.compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := bitsotest.NewWebsocketServer(0)
+			defer server.Close()
+
+			ws := quietListener(server, bitso.WithRecorder(recorder))
+			feed, err := ws.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ws.Subscribe("btc_mxn", bitso.Channel_TRADES); err != nil {
+				t.Fatal(err)
+			}
+			eventually(t, "the subscription", func() bool {
+				return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+			})
+
+			for folio := int64(1); folio <= 2; folio++ {
+				server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: folio, Amount: d("0.1"), Rate: d("900000")}})
+				next(t, feed)
+			}
+			ws.Disconnect()
+
+			if err := recorder.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the recording goes through the same parsing as the live session
+			replayer, err := bitso.OpenReplayFile(path, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replay := bitso.NewWebsocketListener()
+			replayed, err := replay.Replay(replayer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for folio := int64(1); folio <= 2; folio++ {
+				m := next(t, replayed)
+				if trades, ok := m.Trades(); !ok || m.Book != "btc_mxn" || trades[0].Folio != folio {
+					t.Fatalf("replayed %s %s, expecting btc_mxn trade %d", m.Channel, m.Book, folio)
+				}
+			}
+			if m := next(t, replayed); m.Channel != bitso.Channel_DISCONNECTED {
+				t.Errorf("replayed %s at the end of the recording, expecting %s", m.Channel, bitso.Channel_DISCONNECTED)
+			}
+		})
+	}
+}
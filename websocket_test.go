@@ -0,0 +1,179 @@
+package bitso_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/angle/gobitso"
+	"github.com/angle/gobitso/bitsotest"
+)
+
+func TestWebsocketReconnect(t *testing.T) {
+	tests := []struct {
+		name 	string
+		options []bitso.WebsocketOption
+		drop 	func(t *testing.T, server *bitsotest.WebsocketServer, ws *bitso.Websocket)
+	}{
+		{
+			name: "connection closed",
+			drop: func(t *testing.T, server *bitsotest.WebsocketServer, ws *bitso.Websocket) {
+				server.DisconnectAll()
+			},
+		},
+		{
+			name: "connection stale",
+			options: []bitso.WebsocketOption{bitso.WithStaleTimeout(200 * time.Millisecond)},
+			drop: func(t *testing.T, server *bitsotest.WebsocketServer, ws *bitso.Websocket) {
+				server.SetKeepAlive(false)
+				eventually(t, "the stale connection", func() bool {
+					return ws.Health().State != bitso.ConnectionState_CONNECTED
+				})
+				server.SetKeepAlive(true)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := bitsotest.NewWebsocketServer(50 * time.Millisecond)
+			defer server.Close()
+
+			ws := quietListener(server, append(tt.options, bitso.WithReconnect(true))...)
+			feed, err := ws.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Disconnect()
+
+			if err := ws.Subscribe("btc_mxn", bitso.Channel_TRADES); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.drop(t, server, ws)
+
+			if m := next(t, feed); m.Channel != bitso.Channel_RECONNECTED {
+				t.Fatalf("received %s, expecting %s", m.Channel, bitso.Channel_RECONNECTED)
+			}
+
+			if h := ws.Health(); h.State != bitso.ConnectionState_CONNECTED || h.Reconnects != 1 {
+				t.Errorf("health is %s with %d reconnects, expecting CONNECTED with 1", h.State, h.Reconnects)
+			}
+
+			// the subscription is restored on the new connection
+			eventually(t, "the resubscription", func() bool {
+				return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+			})
+			server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: 1, Amount: d("0.1"), Rate: d("900000")}})
+
+			if m := next(t, feed); m.Channel != bitso.Channel_TRADES {
+				t.Errorf("received %s after the reconnection, expecting %s", m.Channel, bitso.Channel_TRADES)
+			}
+		})
+	}
+}
+
+func TestWebsocketDisconnectWithoutReconnect(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	ws := quietListener(server)
+	feed, err := ws.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.DisconnectAll()
+
+	if m := next(t, feed); m.Channel != bitso.Channel_DISCONNECTED {
+		t.Fatalf("received %s, expecting %s", m.Channel, bitso.Channel_DISCONNECTED)
+	}
+	if state := ws.Health().State; state != bitso.ConnectionState_DISCONNECTED {
+		t.Errorf("state is %s, expecting DISCONNECTED", state)
+	}
+}
+
+// the reconnection marker skips the queue limit, a consumer that fell behind must still learn about the gap
+func TestWebsocketReconnectMarkerNotDropped(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(0)
+	defer server.Close()
+
+	ws := quietListener(server, bitso.WithReconnect(true), bitso.WithFeedQueueSize(1), bitso.WithOverflowPolicy(bitso.OverflowPolicy_DROP_NEWEST))
+	feed, err := ws.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Disconnect()
+
+	if err := ws.Subscribe("btc_mxn", bitso.Channel_TRADES); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the subscription", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+	})
+
+	// nobody reads the feed, publish until the queue is full and drops trades
+	folio := int64(0)
+	eventually(t, "the full queue", func() bool {
+		folio++
+		server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: folio, Amount: d("0.1"), Rate: d("900000")}})
+		stats := ws.FeedStats()
+		return stats.Depth == stats.Capacity && stats.Dropped > 0
+	})
+
+	// the first redial waits a second, longer than eventually
+	server.DisconnectAll()
+	deadline := time.Now().Add(5 * time.Second)
+	for ws.Health().Reconnects == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the reconnection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// whatever was queued before, the marker follows it
+	for i := 0; ; i++ {
+		m := next(t, feed)
+		if m.Channel == bitso.Channel_RECONNECTED {
+			break
+		}
+		if m.Channel != bitso.Channel_TRADES || i > 2 {
+			t.Fatalf("received %s, expecting the queued trades and then %s", m.Channel, bitso.Channel_RECONNECTED)
+		}
+	}
+}
+
+// a reader blocked on a full queue is not reading, the time it waits for the consumer is not staleness
+func TestWebsocketBlockedReaderIsNotStale(t *testing.T) {
+	server := bitsotest.NewWebsocketServer(20 * time.Millisecond)
+	defer server.Close()
+
+	ws := quietListener(server, bitso.WithStaleTimeout(100 * time.Millisecond), bitso.WithFeedQueueSize(1), bitso.WithOverflowPolicy(bitso.OverflowPolicy_BLOCK))
+	feed, err := ws.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Disconnect()
+
+	if err := ws.Subscribe("btc_mxn", bitso.Channel_TRADES); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the subscription", func() bool {
+		return server.Subscribers("btc_mxn", bitso.Channel_TRADES) == 1
+	})
+
+	// the reader blocks on the third trade, while nothing is read for longer than the stale timeout
+	for folio := int64(1); folio <= 3; folio++ {
+		server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: folio, Amount: d("0.1"), Rate: d("900000")}})
+	}
+	time.Sleep(300 * time.Millisecond)
+	server.PublishTrades("btc_mxn", []bitso.Trade{{Folio: 4, Amount: d("0.1"), Rate: d("900000")}})
+
+	for folio := 1; folio <= 4; folio++ {
+		if m := next(t, feed); m.Channel != bitso.Channel_TRADES {
+			t.Fatalf("received %s, expecting trade %d", m.Channel, folio)
+		}
+	}
+	if state := ws.Health().State; state != bitso.ConnectionState_CONNECTED {
+		t.Errorf("state is %s, expecting CONNECTED", state)
+	}
+}